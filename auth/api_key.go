@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/serialization"
+)
+
+//Prefix of generated keys, helps to find leaked keys
+const apiKeyPrefix = "gek_"
+
+//API key stored by its hash, the key itself is known only to the client
+type APIKey struct {
+	ID     string   `yaml:"id"`
+	Hash   string   `yaml:"hash"`
+	Scopes []string `yaml:"scopes"`
+	Keys   []string `yaml:"keys"`
+}
+
+//Loads API keys from YAML file
+func LoadAPIKeys(path string) ([]*APIKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*APIKey, 0)
+
+	if err := serialization.DeserializeFromYaml(&keys, data); err != nil {
+		return nil, fmt.Errorf("Could not parse API keys file due to: %s", err)
+	}
+
+	return keys, nil
+}
+
+//Generates new API key and the hash to put into API keys file
+func GenerateAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	hash, err := config.ComputeHash(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, hash, nil
+}
+
+func (k *APIKey) matches(hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) == 1
+}
+
+func (k *APIKey) principal() *Principal {
+	return &Principal{
+		Subject: k.ID,
+		Scopes:  k.Scopes,
+		Keys:    k.Keys,
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeSegment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(claims)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeSegment(claims)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testJWKS(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+			},
+		},
+	}
+
+	b, _ := json.Marshal(jwks)
+	return b
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := ParseJWKS(testJWKS(rsaKey, ecKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Authenticator{jwks: jwks, issuer: "https://id.golang.org", audience: "go-email"}
+
+	claims := map[string]interface{}{
+		"sub":      "gopher",
+		"iss":      "https://id.golang.org",
+		"aud":      []string{"go-email"},
+		"exp":      time.Now().Add(time.Hour).Unix(),
+		"scope":    "receive send",
+		"accounts": []string{"acme"},
+	}
+
+	p, err := a.Authenticate(signRS256(t, rsaKey, "rsa", claims))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "gopher", p.Subject)
+		assert.True(t, p.HasScope(ScopeReceive))
+		assert.False(t, p.HasScope(ScopeAdmin))
+		assert.NoError(t, p.Authorize(ScopeSend, "acme"))
+		assert.Equal(t, ErrForbidden, p.Authorize(ScopeSend, "other"))
+		assert.Equal(t, ErrForbidden, p.Authorize(ScopeSend, ""))
+	}
+
+	_, err = a.Authenticate(signES256(t, ecKey, "ec", claims))
+	assert.NoError(t, err)
+
+	//signed by RSA key but pointing to EC key
+	_, err = a.Authenticate(signRS256(t, rsaKey, "ec", claims))
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = a.Authenticate(signRS256(t, rsaKey, "rsa", claims))
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "other-service"
+	_, err = a.Authenticate(signRS256(t, rsaKey, "rsa", claims))
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	unsigned := encodeSegment(map[string]string{"alg": "none"}) + "." + encodeSegment(claims) + "."
+	_, err = a.Authenticate(unsigned)
+	assert.Equal(t, ErrUnauthenticated, err)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	key, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "api_keys.yaml")
+	data := fmt.Sprintf("- id: ci\n  hash: %s\n  scopes: [admin]\n  keys: [\"*\"]\n", hash)
+
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(config.ServiceConfig{APIKeysPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, a.Enabled())
+
+	p, err := a.Authenticate(key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ci", p.Subject)
+		assert.NoError(t, p.Authorize(ScopeReceive, "any-account"))
+		assert.NoError(t, p.Authorize(ScopeReceive, ""))
+	}
+
+	_, err = a.Authenticate(key + "x")
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	_, err = a.Authenticate("")
+	assert.Equal(t, ErrUnauthenticated, err)
+
+	//missing API keys file does not disable authentication
+	_, err = NewAuthenticator(config.ServiceConfig{APIKeysPath: path + ".missing"})
+	assert.Error(t, err)
+
+	a, err = NewAuthenticator(config.ServiceConfig{APIKeysPath: path + ".missing", AuthDisabled: true})
+	if assert.NoError(t, err) {
+		assert.False(t, a.Enabled())
+	}
+
+	assert.Equal(t, "token", BearerToken("Bearer token"))
+	assert.Empty(t, BearerToken("Basic dXNlcg=="))
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rlaskowski/go-email/config"
+)
+
+//Validates API keys and JWT bearer tokens
+type Authenticator struct {
+	apiKeys  []*APIKey
+	jwks     *JWKS
+	issuer   string
+	audience string
+	disabled bool
+}
+
+//Creates authenticator from API keys and JWKS files of the service config. When none
+//of them exists authentication is disabled only if it is explicitly allowed, so missing
+//or mistyped file does not open the service
+func NewAuthenticator(sc config.ServiceConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		issuer:   sc.JWTIssuer,
+		audience: sc.JWTAudience,
+	}
+
+	if len(sc.APIKeysPath) > 0 && exists(sc.APIKeysPath) {
+		keys, err := LoadAPIKeys(sc.APIKeysPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load API keys due to: %s", err)
+		}
+
+		a.apiKeys = keys
+	}
+
+	if len(sc.JWKSPath) > 0 {
+		jwks, err := LoadJWKS(sc.JWKSPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load JWKS due to: %s", err)
+		}
+
+		a.jwks = jwks
+	}
+
+	if len(a.apiKeys) > 0 || a.jwks != nil {
+		return a, nil
+	}
+
+	if !sc.AuthDisabled {
+		return nil, fmt.Errorf("Neither API keys file %q nor JWKS is configured, authentication has to be disabled explicitly", sc.APIKeysPath)
+	}
+
+	log.Print("Authentication is disabled, every request is allowed without credentials")
+
+	a.disabled = true
+
+	return a, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+//Checks if credentials are required
+func (a *Authenticator) Enabled() bool {
+	return !a.disabled
+}
+
+//Returns principal of the API key or JWT
+func (a *Authenticator) Authenticate(token string) (*Principal, error) {
+	token = strings.TrimSpace(token)
+	if len(token) == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	if strings.Count(token, ".") == 2 && a.jwks != nil {
+		p, err := a.jwks.Verify(token, a.issuer, a.audience)
+		if err != nil {
+			log.Printf("Rejected JWT due to: %s", err)
+			return nil, ErrUnauthenticated
+		}
+
+		return p, nil
+	}
+
+	hash, err := config.ComputeHash(token)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range a.apiKeys {
+		if k.matches(hash) {
+			return k.principal(), nil
+		}
+	}
+
+	return nil, ErrUnauthenticated
+}
+
+//Token from "Bearer <token>" authorization value
+func BearerToken(authorization string) string {
+	const prefix = "bearer "
+
+	if len(authorization) > len(prefix) && strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return authorization[len(prefix):]
+	}
+
+	return ""
+}
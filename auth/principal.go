@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+//Scopes granted to credentials, webhooks scope allows the service
+//to post events to URLs given by the caller
+const (
+	ScopeSend     = "send"
+	ScopeReceive  = "receive"
+	ScopeWebhooks = "webhooks"
+	ScopeAdmin    = "admin"
+)
+
+//Account key which allows access to every account
+const AllKeys = "*"
+
+var (
+	ErrUnauthenticated = errors.New("Missing or invalid credentials")
+	ErrForbidden       = errors.New("Credentials do not allow this operation")
+)
+
+//Authenticated caller with its scopes and email accounts
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Keys    []string
+}
+
+type principalKey struct{}
+
+//Checks if the principal was granted the scope, admin is granted every scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Checks if the principal could use the email account
+func (p *Principal) CanAccess(key string) bool {
+	for _, k := range p.Keys {
+		if k == AllKeys || k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Checks scope and access to the account, principal restricted to accounts is refused without key
+func (p *Principal) Authorize(scope, key string) error {
+	if !p.HasScope(scope) {
+		return ErrForbidden
+	}
+
+	if !p.CanAccess(key) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+//Principal of the request, nil when authentication is disabled
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -31,8 +31,15 @@ func computeKey() []byte {
 }
 
 func ComputeHash(val string) (string, error) {
-	key := computeKey()
+	return computeHMAC(computeKey(), val)
+}
+
+//HMAC-SHA256 of the value with the secret e.g. signature of webhook payload
+func ComputeSignature(secret, val string) (string, error) {
+	return computeHMAC([]byte(secret), val)
+}
 
+func computeHMAC(key []byte, val string) (string, error) {
 	hash := hmac.New(sha256.New, key)
 
 	if _, err := fmt.Fprintf(hash, "%s", val); err != nil {
@@ -1,6 +1,9 @@
 package config
 
-import "time"
+import (
+	"path/filepath"
+	"time"
+)
 
 type ServiceConfig struct {
 	//Path to store temporary message
@@ -23,11 +26,96 @@ type ServiceConfig struct {
 	//server will read parsing the request header's
 	HttpMaxHeaderSize int
 
+	//Maximum number of bytes of the request body,
+	//zero disables the limit
+	HttpMaxBodySize int64
+
+	//Maximum duration of handling the request,
+	//zero disables the timeout
+	HttpRequestTimeout time.Duration
+
+	//Is every request written to the log
+	HttpAccessLog bool
+
+	//Is response compressed when client accepts gzip
+	HttpGzip bool
+
+	//Origins allowed to call REST API from the browser,
+	//"*" allows all, empty disables CORS
+	HttpCORSAllowOrigins []string
+
+	//Headers allowed in cross-origin requests
+	HttpCORSAllowHeaders []string
+
+	//Duration the browser could cache preflight response
+	HttpCORSMaxAge time.Duration
+
+	//Interval of comments sent to keep idle event stream open
+	HttpStreamHeartbeat time.Duration
+
+	//Path to YAML file with hashed API keys, the service does not start
+	//when neither API keys nor JWKS are configured and AuthDisabled is not set
+	APIKeysPath string
+
+	//Allows requests without credentials when neither API keys nor JWKS are configured,
+	//e.g. for local development
+	AuthDisabled bool
+
+	//Path to JWKS file with keys trusted to sign JWT bearer tokens
+	JWKSPath string
+
+	//Required issuer of JWT, not checked when empty
+	JWTIssuer string
+
+	//Required audience of JWT, not checked when empty
+	JWTAudience string
+
 	//Default GRPC server port
 	GrpcListenPort int
 
 	//Duration when queue will be refreshing
 	QueueRefreshTime time.Duration
+
+	//Path to file with suppressed addresses,
+	//when empty suppressions are kept only in memory
+	SuppressionStorePath string
+
+	//Path to file with idempotency keys of send requests,
+	//when empty keys are kept only in memory
+	IdempotencyStorePath string
+
+	//Duration the result of send request is returned
+	//for repeated idempotency key
+	IdempotencyWindow time.Duration
+
+	//Path to file with messages scheduled for future delivery,
+	//when empty they are kept only in memory and lost on restart
+	ScheduleStorePath string
+
+	//Path to directory with index of received messages,
+	//when empty messages are kept only in memory
+	MessageStorePath string
+
+	//Path to directory with attachments of received messages,
+	//when empty attachments are not stored
+	AttachmentStorePath string
+
+	//Path to file with webhooks and their delivery log,
+	//when empty they are kept only in memory
+	WebhookStorePath string
+
+	//Maximum number of attempts to deliver event to webhook
+	WebhookMaxAttempts int
+
+	//Delay before the first retry of webhook delivery,
+	//it is doubled after every failed attempt
+	WebhookRetryBackoff time.Duration
+
+	//Maximum duration of webhook request
+	WebhookTimeout time.Duration
+
+	//Number of webhook requests sent at the same time
+	WebhookWorkers int
 }
 
 const (
@@ -44,7 +132,26 @@ var (
 		HttpServerReadTimeout:  30 * time.Second,
 		HttpServerWriteTimeout: 30 * time.Second,
 		HttpMaxHeaderSize:      1024 * 4,
+		HttpMaxBodySize:        32 * 1024 * 1024,
+		HttpRequestTimeout:     30 * time.Second,
+		HttpAccessLog:          true,
+		HttpGzip:               true,
+		HttpCORSAllowHeaders:   []string{"Authorization", "Content-Type", "Idempotency-Key", "X-API-Key", "X-Request-ID"},
+		HttpCORSMaxAge:         10 * time.Minute,
+		HttpStreamHeartbeat:    15 * time.Second,
+		APIKeysPath:            filepath.Join(GetWorkingDirectory(), "api_keys.yaml"),
 		GrpcListenPort:         9090,
 		QueueRefreshTime:       5 * time.Second,
+		SuppressionStorePath:   filepath.Join(GetWorkingDirectory(), "suppressions.json"),
+		IdempotencyStorePath:   filepath.Join(GetWorkingDirectory(), "idempotency.json"),
+		IdempotencyWindow:      24 * time.Hour,
+		ScheduleStorePath:      filepath.Join(GetWorkingDirectory(), "scheduled.json"),
+		MessageStorePath:       filepath.Join(GetWorkingDirectory(), "messages"),
+		AttachmentStorePath:    filepath.Join(GetWorkingDirectory(), "attachments"),
+		WebhookStorePath:       filepath.Join(GetWorkingDirectory(), "webhooks.json"),
+		WebhookMaxAttempts:     5,
+		WebhookRetryBackoff:    30 * time.Second,
+		WebhookTimeout:         10 * time.Second,
+		WebhookWorkers:         4,
 	}
 )
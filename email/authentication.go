@@ -0,0 +1,140 @@
+package email
+
+import (
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+type Authentication struct {
+	Verdict string        `json:"verdict"`
+	DKIM    []*DKIMResult `json:"dkim"`
+	SPF     *SPFResult    `json:"spf"`
+	DMARC   *DMARCResult  `json:"dmarc"`
+}
+
+var (
+	receivedIPRegexp   = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+	receivedHeloRegexp = regexp.MustCompile(`(?i)^\s*from\s+([^\s(]+)`)
+)
+
+//Checks if the sender of the message could be trusted
+func (a *Authentication) Trusted() bool {
+	return a != nil && a.Verdict == AuthPass
+}
+
+//Verifies DKIM signatures, SPF of the Received chain and DMARC alignment of the From domain
+func Authenticate(message []byte, header mail.Header, resolver Resolver) *Authentication {
+	a := &Authentication{
+		DKIM: VerifyDKIM(message, resolver),
+	}
+
+	ip, helo := receivedClient(header["Received"])
+	sender := envelopeSender(header.Get("Return-Path"), helo)
+
+	a.SPF = CheckSPF(ip, addressDomain(sender), sender, resolver)
+
+	fromDomain := ""
+	if from, err := mail.ParseAddress(header.Get("From")); err == nil {
+		fromDomain = addressDomain(from.Address)
+	}
+
+	a.DMARC = CheckDMARC(fromDomain, a.DKIM, a.SPF, resolver)
+
+	a.Verdict = a.verdict()
+
+	return a
+}
+
+func (a *Authentication) verdict() string {
+	switch a.DMARC.Status {
+	case AuthPass, AuthFail, AuthTempError:
+		return a.DMARC.Status
+	}
+
+	if a.SPF.Status == AuthPass {
+		return AuthNeutral
+	}
+
+	for _, d := range a.DKIM {
+		if d.Status == AuthPass {
+			return AuthNeutral
+		}
+	}
+
+	return AuthNone
+}
+
+//Finds the first external client in the Received chain, the newest header comes first
+func receivedClient(received []string) (net.IP, string) {
+	for _, r := range received {
+		from := r
+		if i := strings.Index(strings.ToLower(r), " by "); i >= 0 {
+			from = r[:i]
+		}
+
+		m := receivedIPRegexp.FindStringSubmatch(from)
+		if m == nil {
+			continue
+		}
+
+		ip := net.ParseIP(m[1])
+		if ip == nil || isInternalIP(ip) {
+			continue
+		}
+
+		var helo string
+		if h := receivedHeloRegexp.FindStringSubmatch(from); h != nil {
+			helo = strings.Trim(h[1], "[]")
+		}
+
+		return ip, helo
+	}
+
+	return nil, ""
+}
+
+func envelopeSender(returnPath, helo string) string {
+	rp := strings.Trim(strings.TrimSpace(returnPath), "<>")
+
+	if len(rp) == 0 {
+		if len(helo) == 0 {
+			return ""
+		}
+		return "postmaster@" + helo
+	}
+
+	return rp
+}
+
+func addressDomain(address string) string {
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(address[i+1:]))
+}
+
+var internalNetworks = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+func isInternalIP(ip net.IP) bool {
+	for _, n := range internalNetworks {
+		_, network, _ := net.ParseCIDR(n)
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
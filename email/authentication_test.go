@@ -0,0 +1,203 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResolver struct {
+	txt map[string][]string
+	ip  map[string][]net.IP
+	mx  map[string][]*net.MX
+}
+
+func newTestResolver() *testResolver {
+	return &testResolver{
+		txt: make(map[string][]string),
+		ip:  make(map[string][]net.IP),
+		mx:  make(map[string][]*net.MX),
+	}
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *testResolver) LookupTXT(name string) ([]string, error) {
+	if t, ok := r.txt[name]; ok {
+		return t, nil
+	}
+	return nil, notFound(name)
+}
+
+func (r *testResolver) LookupIP(host string) ([]net.IP, error) {
+	if ip, ok := r.ip[host]; ok {
+		return ip, nil
+	}
+	return nil, notFound(host)
+}
+
+func (r *testResolver) LookupMX(name string) ([]*net.MX, error) {
+	if mx, ok := r.mx[name]; ok {
+		return mx, nil
+	}
+	return nil, notFound(name)
+}
+
+//Builds MessageInfo the same way as it is read from POP3 server
+func newTestMessageInfo(t *testing.T, raw []byte) *MessageInfo {
+	b := &bytes.Buffer{}
+	w := textproto.NewWriter(bufio.NewWriter(b))
+
+	dw := w.DotWriter()
+	if _, err := dw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMessageInfo(textproto.NewReader(bufio.NewReader(b)))
+	if m == nil {
+		t.Fatal("Could not read test message")
+	}
+
+	return m
+}
+
+func signedTestMessage(t *testing.T, key *rsa.PrivateKey, received string) []byte {
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewDKIMSigner(&DKIMConfig{
+		Selector:       "sel",
+		Domain:         "golang.org",
+		PrivateKeyPath: writeTestKey(t, key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := signer.Sign(mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := fmt.Sprintf("Return-Path: <%s>\r\nReceived: %s\r\n", senderAddress, received)
+
+	return append([]byte(header), signed...)
+}
+
+func authTestResolver(t *testing.T, key *rsa.PrivateKey) *testResolver {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver()
+	r.txt["sel._domainkey.golang.org"] = []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)}
+	r.txt["golang.org"] = []string{"google-site-verification=abc", "v=spf1 include:_spf.golang.org -all"}
+	r.txt["_spf.golang.org"] = []string{"v=spf1 ip4:192.0.2.0/24 a:mail.golang.org ~all"}
+	r.txt["_dmarc.golang.org"] = []string{"v=DMARC1; p=reject; adkim=s"}
+	r.ip["mail.golang.org"] = []net.IP{net.ParseIP("198.51.100.7")}
+
+	return r
+}
+
+func TestAuthenticatePass(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := "from mail.golang.org (mail.golang.org [198.51.100.7])\r\n\tby mx.example.com with ESMTPS; Mon, 1 Mar 2021 10:00:00 +0000"
+
+	mi := newTestMessageInfo(t, signedTestMessage(t, key, received))
+	a := mi.Authenticate(authTestResolver(t, key))
+
+	if assert.Len(t, a.DKIM, 1) {
+		assert.Equal(t, AuthPass, a.DKIM[0].Status, a.DKIM[0].Error)
+		assert.Equal(t, "golang.org", a.DKIM[0].Domain)
+	}
+
+	assert.Equal(t, AuthPass, a.SPF.Status, a.SPF.Error)
+	assert.Equal(t, "198.51.100.7", a.SPF.IP)
+	assert.Equal(t, AuthPass, a.DMARC.Status)
+	assert.Equal(t, "reject", a.DMARC.Policy)
+	assert.True(t, mi.Authentication().Trusted())
+}
+
+func TestAuthenticateFail(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := "from attacker.example (unknown [203.0.113.9]) by mx.example.com; Mon, 1 Mar 2021 10:00:00 +0000"
+
+	raw := signedTestMessage(t, key, received)
+	raw = bytes.Replace(raw, []byte(subject), []byte("Forged subject"), 1)
+
+	mi := newTestMessageInfo(t, raw)
+	a := mi.Authenticate(authTestResolver(t, key))
+
+	if assert.Len(t, a.DKIM, 1) {
+		assert.Equal(t, AuthFail, a.DKIM[0].Status)
+	}
+
+	assert.Equal(t, AuthFail, a.SPF.Status)
+	assert.Equal(t, AuthFail, a.DMARC.Status)
+	assert.Equal(t, AuthFail, a.Verdict)
+	assert.False(t, a.Trusted())
+}
+
+func TestAuthenticateNoPolicy(t *testing.T) {
+	raw := "From: someone@example.net\r\nReceived: from relay (relay [10.0.0.1]) by mx\r\nSubject: Hi\r\n\r\nHello\r\n"
+
+	mi := newTestMessageInfo(t, []byte(raw))
+	a := mi.Authenticate(newTestResolver())
+
+	assert.Empty(t, a.DKIM)
+	assert.Equal(t, AuthNone, a.SPF.Status)
+	assert.Equal(t, AuthNone, a.DMARC.Status)
+	assert.Equal(t, AuthNone, a.Verdict)
+}
+
+func TestSPFLookupLimit(t *testing.T) {
+	r := newTestResolver()
+
+	for i := 0; i < 12; i++ {
+		r.txt[fmt.Sprintf("d%d.example", i)] = []string{fmt.Sprintf("v=spf1 include:d%d.example -all", i+1)}
+	}
+
+	res := CheckSPF(net.ParseIP("192.0.2.1"), "d0.example", "a@d0.example", r)
+
+	assert.Equal(t, AuthPermError, res.Status)
+	assert.True(t, strings.Contains(res.Error, "limit"))
+}
+
+func TestOrganizationalDomain(t *testing.T) {
+	assert.Equal(t, "golang.org", organizationalDomain("mail.golang.org"))
+	assert.Equal(t, "example.co.uk", organizationalDomain("a.b.example.co.uk"))
+	assert.True(t, domainAligned("golang.org", "mail.golang.org", "r"))
+	assert.False(t, domainAligned("golang.org", "mail.golang.org", "s"))
+}
@@ -0,0 +1,310 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+const (
+	BounceHard = "hard"
+	BounceSoft = "soft"
+)
+
+var (
+	bounceSubject  = regexp.MustCompile(`(?i)(undeliver|undelivered|delivery (status )?(notification|failure)|returned mail|mail delivery (failed|system)|failure notice|delivery has failed|could not be delivered|nondeliverable)`)
+	bounceSender   = regexp.MustCompile(`(?i)^(mailer-daemon|postmaster|mail-daemon|mail\.daemon)@`)
+	enhancedStatus = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+	smtpCode       = regexp.MustCompile(`\b([45]\d\d)[ -]`)
+	bounceAddress  = regexp.MustCompile(`<?([a-zA-Z0-9._%+\-=]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,})>?`)
+	messageIDLine  = regexp.MustCompile(`(?im)^message-id:\s*<([^>]+)>`)
+)
+
+//Delivery failure report received for an outbound message
+type Bounce struct {
+	Standard          bool                `json:"standard"`
+	ReportingMTA      string              `json:"reporting_mta,omitempty"`
+	OriginalMessageID string              `json:"original_message_id,omitempty"`
+	Recipients        []*BouncedRecipient `json:"recipients"`
+}
+
+type BouncedRecipient struct {
+	Address    string `json:"address"`
+	Action     string `json:"action"`
+	Status     string `json:"status"`
+	Diagnostic string `json:"diagnostic,omitempty"`
+	Type       string `json:"type"`
+}
+
+//Addresses which failed permanently
+func (b *Bounce) HardBounced() []string {
+	addresses := make([]string, 0)
+
+	for _, r := range b.Recipients {
+		if r.Type == BounceHard {
+			addresses = append(addresses, r.Address)
+		}
+	}
+
+	return addresses
+}
+
+//Delivery failure carried by the message, nil for ordinary messages
+func (m *MessageInfo) Bounce() *Bounce {
+	return m.bounce
+}
+
+func (m *MessageInfo) detectBounce() {
+	if m.root == nil {
+		return
+	}
+
+	var report *Bounce
+
+	m.root.Walk(func(p *Part) error {
+		switch p.ContentType {
+		case "message/delivery-status", "message/global-delivery-status":
+			if report == nil {
+				report = parseDeliveryStatus(p.Data)
+			}
+		}
+		return nil
+	})
+
+	if report == nil && m.isBounceLike() {
+		report = m.parseBounceText()
+	}
+
+	if report == nil || len(report.Recipients) == 0 {
+		return
+	}
+
+	if len(report.OriginalMessageID) == 0 {
+		report.OriginalMessageID = m.originalMessageID()
+	}
+
+	m.bounce = report
+}
+
+//Parses message/delivery-status body (RFC 3464)
+func parseDeliveryStatus(data []byte) *Bounce {
+	b := &Bounce{
+		Standard:   true,
+		Recipients: make([]*BouncedRecipient, 0),
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+
+	for first := true; ; first = false {
+		fields, err := reader.ReadMIMEHeader()
+		if len(fields) > 0 {
+			if first {
+				b.ReportingMTA = typedValue(fields.Get("Reporting-MTA"))
+			} else if r := deliveryRecipient(fields); r != nil {
+				b.Recipients = append(b.Recipients, r)
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	return b
+}
+
+func deliveryRecipient(fields textproto.MIMEHeader) *BouncedRecipient {
+	action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+
+	//delivered, relayed and expanded recipients are not failures
+	if action != "failed" && action != "delayed" {
+		return nil
+	}
+
+	address := typedValue(fields.Get("Final-Recipient"))
+	if len(address) == 0 {
+		address = typedValue(fields.Get("Original-Recipient"))
+	}
+
+	if len(address) == 0 {
+		return nil
+	}
+
+	r := &BouncedRecipient{
+		Address:    strings.ToLower(strings.Trim(address, "<>")),
+		Action:     action,
+		Status:     strings.TrimSpace(fields.Get("Status")),
+		Diagnostic: typedValue(fields.Get("Diagnostic-Code")),
+	}
+
+	r.Type = bounceType(r.Status, r.Diagnostic)
+	if action == "delayed" {
+		r.Type = BounceSoft
+	}
+
+	return r
+}
+
+//Removes type prefix e.g. rfc822; user@example.com
+func typedValue(v string) string {
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = v[i+1:]
+	}
+
+	return strings.TrimSpace(v)
+}
+
+func (m *MessageInfo) isBounceLike() bool {
+	if len(m.message.Header.Get("X-Failed-Recipients")) > 0 {
+		return true
+	}
+
+	if bounceSender.MatchString(m.Sender().Address) {
+		return true
+	}
+
+	//null reverse path is used only by delivery notifications
+	returnPath := strings.TrimSpace(m.message.Header.Get("Return-Path"))
+
+	return returnPath == "<>" && bounceSubject.MatchString(m.Subject())
+}
+
+//Parses bounces which are not RFC 3464 reports e.g. qmail or Exim plain text notices
+func (m *MessageInfo) parseBounceText() *Bounce {
+	b := &Bounce{
+		Recipients: make([]*BouncedRecipient, 0),
+	}
+
+	text := &strings.Builder{}
+	for _, c := range m.contents {
+		if !c.HTMLType {
+			text.Write(c.Data)
+			text.WriteString("\n")
+		}
+	}
+
+	body := text.String()
+
+	//diagnostic is usually the first line with SMTP reply code
+	diagnostic := ""
+	for _, line := range strings.Split(body, "\n") {
+		if enhancedStatus.MatchString(line) || smtpCode.MatchString(line) {
+			diagnostic = strings.TrimSpace(line)
+			break
+		}
+	}
+
+	status := ""
+	if s := enhancedStatus.FindStringSubmatch(diagnostic); s != nil {
+		status = s[1]
+	} else if c := smtpCode.FindStringSubmatch(diagnostic); c != nil {
+		status = c[1]
+	}
+
+	addresses := make([]string, 0)
+
+	for _, h := range m.message.Header["X-Failed-Recipients"] {
+		for _, a := range strings.Split(h, ",") {
+			if a = strings.TrimSpace(a); len(a) > 0 {
+				addresses = append(addresses, a)
+			}
+		}
+	}
+
+	if len(addresses) == 0 {
+		addresses = m.bouncedAddresses(body)
+	}
+
+	for _, a := range addresses {
+		b.Recipients = append(b.Recipients, &BouncedRecipient{
+			Address:    strings.ToLower(a),
+			Action:     "failed",
+			Status:     status,
+			Diagnostic: diagnostic,
+			Type:       bounceType(status, diagnostic),
+		})
+	}
+
+	return b
+}
+
+//Addresses mentioned in the notice before the quoted original message
+func (m *MessageInfo) bouncedAddresses(body string) []string {
+	ignored := map[string]bool{
+		strings.ToLower(m.Sender().Address): true,
+	}
+
+	for _, a := range m.To() {
+		ignored[strings.ToLower(a.Address)] = true
+	}
+
+	if i := messageIDLine.FindStringIndex(body); i != nil {
+		body = body[:i[0]]
+	}
+
+	addresses := make([]string, 0)
+
+	for _, match := range bounceAddress.FindAllStringSubmatch(body, -1) {
+		a := strings.ToLower(match[1])
+		if ignored[a] {
+			continue
+		}
+
+		ignored[a] = true
+		addresses = append(addresses, a)
+	}
+
+	return addresses
+}
+
+//Message-ID of the bounced message from the returned copy or its headers
+func (m *MessageInfo) originalMessageID() string {
+	id := ""
+
+	m.root.Walk(func(p *Part) error {
+		if len(id) > 0 {
+			return nil
+		}
+
+		switch p.ContentType {
+		case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+			if match := messageIDLine.FindSubmatch(p.Data); match != nil {
+				id = string(match[1])
+			}
+		}
+		return nil
+	})
+
+	if len(id) > 0 {
+		return id
+	}
+
+	for _, c := range m.contents {
+		if match := messageIDLine.FindSubmatch(c.Data); match != nil {
+			return string(match[1])
+		}
+	}
+
+	return ""
+}
+
+//Permanent failures are hard bounces except full mailbox which could be emptied later
+func bounceType(status, diagnostic string) string {
+	if strings.HasPrefix(status, "5.2.2") || strings.HasPrefix(status, "552") {
+		return BounceSoft
+	}
+
+	if strings.HasPrefix(status, "5") {
+		return BounceHard
+	}
+
+	if len(status) == 0 {
+		if c := smtpCode.FindStringSubmatch(diagnostic); c != nil && strings.HasPrefix(c[1], "5") && c[1] != "552" {
+			return BounceHard
+		}
+	}
+
+	return BounceSoft
+}
@@ -0,0 +1,91 @@
+package email
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestMessage(t *testing.T, name string) *MessageInfo {
+	raw, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi := newTestMessageInfo(t, raw)
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	return mi
+}
+
+func TestDeliveryStatusBounce(t *testing.T) {
+	b := readTestMessage(t, "bounce-postfix-dsn.eml").Bounce()
+
+	if assert.NotNil(t, b) && assert.Len(t, b.Recipients, 2) {
+		assert.True(t, b.Standard)
+		assert.Equal(t, "mx.golang.org", b.ReportingMTA)
+		assert.Equal(t, "4f2a9c@golang.org", b.OriginalMessageID)
+
+		assert.Equal(t, "missing@example.com", b.Recipients[0].Address)
+		assert.Equal(t, "5.1.1", b.Recipients[0].Status)
+		assert.Contains(t, b.Recipients[0].Diagnostic, "User unknown")
+		assert.Equal(t, BounceHard, b.Recipients[0].Type)
+
+		assert.Equal(t, BounceSoft, b.Recipients[1].Type)
+		assert.Equal(t, []string{"missing@example.com"}, b.HardBounced())
+	}
+}
+
+func TestTextBounces(t *testing.T) {
+	tests := []struct {
+		file      string
+		address   string
+		status    string
+		messageID string
+	}{
+		{"bounce-qmail.eml", "nobody@example.net", "5.1.1", "8c1d3e@golang.org"},
+		{"bounce-exim.eml", "gone@example.org", "550", "e71b0a@golang.org"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			b := readTestMessage(t, test.file).Bounce()
+
+			if assert.NotNil(t, b) && assert.Len(t, b.Recipients, 1) {
+				assert.False(t, b.Standard)
+				assert.Equal(t, test.address, b.Recipients[0].Address)
+				assert.Equal(t, test.status, b.Recipients[0].Status)
+				assert.Equal(t, BounceHard, b.Recipients[0].Type)
+				assert.Equal(t, test.messageID, b.OriginalMessageID)
+			}
+		})
+	}
+}
+
+func TestNoBounce(t *testing.T) {
+	assert.Nil(t, readTestMessage(t, "8bit-utf8.eml").Bounce())
+}
+
+func TestSuppressedRecipients(t *testing.T) {
+	s := NewSuppressionList()
+	s.Suppress("account", "Missing@example.com", "Hard bounce")
+
+	e := NewEmail()
+	e.SetSuppressions(s)
+
+	c := &Config{Key: "account"}
+
+	r, err := e.deliverable(c, []string{"Missing <missing@example.com>", firstRecipientEmail})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{firstRecipientEmail}, r)
+
+	_, err = e.deliverable(c, []string{"missing@example.com"})
+	assert.Equal(t, ErrAllRecipientsSuppressed, err)
+
+	assert.False(t, s.IsSuppressed("other", "missing@example.com"))
+}
@@ -0,0 +1,430 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CalendarRequest = "REQUEST"
+	CalendarCancel  = "CANCEL"
+	CalendarReply   = "REPLY"
+
+	CalendarMimeType = "text/calendar"
+
+	PartStatNeedsAction = "NEEDS-ACTION"
+	PartStatAccepted    = "ACCEPTED"
+	PartStatDeclined    = "DECLINED"
+	PartStatTentative   = "TENTATIVE"
+
+	calendarDateTime    = "20060102T150405"
+	calendarDateTimeUTC = "20060102T150405Z"
+	calendarDate        = "20060102"
+)
+
+var ErrCalendarMethod = errors.New("Calendar method has to be REQUEST, CANCEL or REPLY")
+
+//iCalendar object carried in text/calendar part (RFC 5545, iTIP RFC 5546)
+type Calendar struct {
+	Method string   `json:"method"`
+	Events []*Event `json:"events"`
+}
+
+type Event struct {
+	UID         string      `json:"uid"`
+	Sequence    int         `json:"sequence"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description"`
+	Location    string      `json:"location"`
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	AllDay      bool        `json:"all_day"`
+	Status      string      `json:"status"`
+	Organizer   *Attendee   `json:"organizer"`
+	Attendees   []*Attendee `json:"attendees"`
+	Stamp       time.Time   `json:"stamp"`
+}
+
+type Attendee struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Role    string `json:"role,omitempty"`
+	Status  string `json:"status,omitempty"`
+	RSVP    bool   `json:"rsvp"`
+}
+
+func NewCalendar(method string, events ...*Event) (*Calendar, error) {
+	method = strings.ToUpper(method)
+
+	switch method {
+	case CalendarRequest, CalendarCancel, CalendarReply:
+	default:
+		return nil, ErrCalendarMethod
+	}
+
+	return &Calendar{
+		Method: method,
+		Events: events,
+	}, nil
+}
+
+//Serializes calendar to iCalendar format
+func (c *Calendar) Bytes() []byte {
+	b := &bytes.Buffer{}
+
+	writeCalendarLine(b, "BEGIN:VCALENDAR")
+	writeCalendarLine(b, "PRODID:-//rlaskowski//go-email//EN")
+	writeCalendarLine(b, "VERSION:2.0")
+	writeCalendarLine(b, "CALSCALE:GREGORIAN")
+	writeCalendarLine(b, "METHOD:"+c.Method)
+
+	for _, e := range c.Events {
+		c.writeEvent(b, e)
+	}
+
+	writeCalendarLine(b, "END:VCALENDAR")
+
+	return b.Bytes()
+}
+
+func (c *Calendar) writeEvent(b *bytes.Buffer, e *Event) {
+	stamp := e.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	writeCalendarLine(b, "BEGIN:VEVENT")
+	writeCalendarLine(b, "UID:"+escapeCalendarText(e.UID))
+	writeCalendarLine(b, "DTSTAMP:"+stamp.UTC().Format(calendarDateTimeUTC))
+
+	if e.AllDay {
+		writeCalendarLine(b, "DTSTART;VALUE=DATE:"+e.Start.Format(calendarDate))
+		if !e.End.IsZero() {
+			writeCalendarLine(b, "DTEND;VALUE=DATE:"+e.End.Format(calendarDate))
+		}
+	} else {
+		writeCalendarLine(b, "DTSTART:"+e.Start.UTC().Format(calendarDateTimeUTC))
+		if !e.End.IsZero() {
+			writeCalendarLine(b, "DTEND:"+e.End.UTC().Format(calendarDateTimeUTC))
+		}
+	}
+
+	writeCalendarLine(b, fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+
+	if len(e.Summary) > 0 {
+		writeCalendarLine(b, "SUMMARY:"+escapeCalendarText(e.Summary))
+	}
+
+	if len(e.Description) > 0 {
+		writeCalendarLine(b, "DESCRIPTION:"+escapeCalendarText(e.Description))
+	}
+
+	if len(e.Location) > 0 {
+		writeCalendarLine(b, "LOCATION:"+escapeCalendarText(e.Location))
+	}
+
+	status := e.Status
+	if c.Method == CalendarCancel {
+		status = "CANCELLED"
+	}
+
+	if len(status) > 0 {
+		writeCalendarLine(b, "STATUS:"+status)
+	}
+
+	if e.Organizer != nil {
+		writeCalendarLine(b, "ORGANIZER"+attendeeParams(e.Organizer, false))
+	}
+
+	for _, a := range e.Attendees {
+		writeCalendarLine(b, "ATTENDEE"+attendeeParams(a, true))
+	}
+
+	writeCalendarLine(b, "END:VEVENT")
+}
+
+func attendeeParams(a *Attendee, attendee bool) string {
+	s := &strings.Builder{}
+
+	if len(a.Name) > 0 {
+		fmt.Fprintf(s, ";CN=%s", quoteCalendarParam(a.Name))
+	}
+
+	if attendee {
+		role := a.Role
+		if len(role) == 0 {
+			role = "REQ-PARTICIPANT"
+		}
+
+		status := a.Status
+		if len(status) == 0 {
+			status = PartStatNeedsAction
+		}
+
+		fmt.Fprintf(s, ";ROLE=%s;PARTSTAT=%s;RSVP=%s", role, status, strings.ToUpper(strconv.FormatBool(a.RSVP)))
+	}
+
+	fmt.Fprintf(s, ":mailto:%s", a.Address)
+
+	return s.String()
+}
+
+//Writes content line folded at 75 octets (RFC 5545 3.1)
+func writeCalendarLine(b *bytes.Buffer, line string) {
+	for len(line) > 75 {
+		n := 75
+		for n > 0 && !isRuneStart(line[n]) {
+			n--
+		}
+
+		b.WriteString(line[:n])
+		b.WriteString("\r\n ")
+		line = line[n:]
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func escapeCalendarText(s string) string {
+	r := strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+	)
+
+	return r.Replace(s)
+}
+
+func unescapeCalendarText(s string) string {
+	r := strings.NewReplacer(
+		"\\\\", "\\",
+		"\\;", ";",
+		"\\,", ",",
+		"\\n", "\n",
+		"\\N", "\n",
+	)
+
+	return r.Replace(s)
+}
+
+func quoteCalendarParam(s string) string {
+	s = strings.ReplaceAll(s, "\"", "'")
+
+	if strings.ContainsAny(s, ":;,") {
+		return "\"" + s + "\""
+	}
+
+	return s
+}
+
+type calendarProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+//Parses iCalendar data, only VEVENT components are read
+func ParseCalendar(data []byte) (*Calendar, error) {
+	c := &Calendar{
+		Events: make([]*Event, 0),
+	}
+
+	var event *Event
+	depth := 0
+
+	for _, line := range unfoldCalendarLines(data) {
+		p, err := parseCalendarProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch p.name {
+		case "BEGIN":
+			depth++
+			if strings.EqualFold(p.value, "VEVENT") {
+				event = &Event{Attendees: make([]*Attendee, 0)}
+				depth = 1
+			}
+			continue
+		case "END":
+			depth--
+			if strings.EqualFold(p.value, "VEVENT") && event != nil {
+				c.Events = append(c.Events, event)
+				event = nil
+				depth = 0
+			}
+			continue
+		case "METHOD":
+			c.Method = strings.ToUpper(p.value)
+			continue
+		}
+
+		//properties of nested components e.g. VALARM are skipped
+		if event == nil || depth != 1 {
+			continue
+		}
+
+		if err := event.setProperty(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.Events) == 0 {
+		return nil, errors.New("Calendar does not contain any event")
+	}
+
+	return c, nil
+}
+
+func (e *Event) setProperty(p *calendarProperty) error {
+	var err error
+
+	switch p.name {
+	case "UID":
+		e.UID = p.value
+	case "SEQUENCE":
+		e.Sequence, _ = strconv.Atoi(p.value)
+	case "SUMMARY":
+		e.Summary = unescapeCalendarText(p.value)
+	case "DESCRIPTION":
+		e.Description = unescapeCalendarText(p.value)
+	case "LOCATION":
+		e.Location = unescapeCalendarText(p.value)
+	case "STATUS":
+		e.Status = strings.ToUpper(p.value)
+	case "DTSTAMP":
+		e.Stamp, err = parseCalendarTime(p)
+	case "DTSTART":
+		e.Start, err = parseCalendarTime(p)
+		e.AllDay = p.params["VALUE"] == "DATE" || len(p.value) == len(calendarDate)
+	case "DTEND":
+		e.End, err = parseCalendarTime(p)
+	case "ORGANIZER":
+		e.Organizer = parseAttendee(p)
+	case "ATTENDEE":
+		e.Attendees = append(e.Attendees, parseAttendee(p))
+	}
+
+	return err
+}
+
+func parseAttendee(p *calendarProperty) *Attendee {
+	address := p.value
+	if strings.HasPrefix(strings.ToLower(address), "mailto:") {
+		address = address[len("mailto:"):]
+	}
+
+	return &Attendee{
+		Name:    p.params["CN"],
+		Address: address,
+		Role:    strings.ToUpper(p.params["ROLE"]),
+		Status:  strings.ToUpper(p.params["PARTSTAT"]),
+		RSVP:    strings.EqualFold(p.params["RSVP"], "TRUE"),
+	}
+}
+
+func parseCalendarTime(p *calendarProperty) (time.Time, error) {
+	v := p.value
+
+	if strings.HasSuffix(v, "Z") {
+		return time.Parse(calendarDateTimeUTC, v)
+	}
+
+	if len(v) == len(calendarDate) {
+		return time.Parse(calendarDate, v)
+	}
+
+	location := time.UTC
+	if tzid, ok := p.params["TZID"]; ok {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			location = l
+		}
+	}
+
+	return time.ParseInLocation(calendarDateTime, v, location)
+}
+
+func unfoldCalendarLines(data []byte) []string {
+	lines := make([]string, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func parseCalendarProperty(line string) (*calendarProperty, error) {
+	p := &calendarProperty{
+		params: make(map[string]string),
+	}
+
+	quoted := false
+	start := 0
+	var name string
+
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ';', ':':
+			if quoted {
+				continue
+			}
+
+			token := line[start:i]
+			if len(name) == 0 {
+				name = strings.ToUpper(token)
+			} else if kv := strings.SplitN(token, "=", 2); len(kv) == 2 {
+				p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], "\"")
+			}
+
+			start = i + 1
+
+			if line[i] == ':' {
+				p.name = name
+				p.value = line[i+1:]
+				return p, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("Bad calendar line %s", line)
+}
+
+//Attendee of the event with the address
+func (e *Event) Attendee(address string) *Attendee {
+	for _, a := range e.Attendees {
+		if strings.EqualFold(a.Address, address) {
+			return a
+		}
+	}
+
+	return nil
+}
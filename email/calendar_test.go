@@ -0,0 +1,147 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const calendarReply = "Received: from mx.golang.org\r\n" +
+	"From: First Recipient <first.recipient@golang.org>\r\n" +
+	"To: sender.gopher@golang.org\r\n" +
+	"Subject: Accepted: Planning\r\n" +
+	"Message-ID: <reply@golang.org>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=reply\r\n" +
+	"\r\n" +
+	"--reply\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Accepted\r\n" +
+	"--reply\r\n" +
+	"Content-Type: text/calendar; charset=UTF-8; method=REPLY\r\n" +
+	"\r\n" +
+	"BEGIN:VCALENDAR\r\n" +
+	"METHOD:REPLY\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Warsaw\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:planning-1\r\n" +
+	"DTSTART;TZID=Europe/Warsaw:20210315T100000\r\n" +
+	"DTEND;TZID=Europe/Warsaw:20210315T110000\r\n" +
+	"SUMMARY:Planning\\, Q2\r\n" +
+	"ATTENDEE;PARTSTAT=ACCEPTED;CN=\"Recipient, First\":mailto:first.recipient@go\r\n" +
+	" lang.org\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"SUMMARY:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n" +
+	"--reply--\r\n"
+
+func TestCalendarInvitation(t *testing.T) {
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2021, 3, 15, 9, 0, 0, 0, time.UTC)
+
+	c, err := NewCalendar(CalendarRequest, &Event{
+		UID:         "planning-1",
+		Summary:     "Planning, Q2",
+		Description: "Agenda:\nbudget",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		Attendees: []*Attendee{
+			{Address: firstRecipientEmail, RSVP: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.SetCalendar(c)
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(mb), "Content-Type: text/calendar; charset=UTF-8; method=REQUEST")
+
+	mi := newTestMessageInfo(t, mb)
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, mi.Contents(), 1)
+
+	parsed := mi.Calendar()
+	if assert.NotNil(t, parsed) && assert.Len(t, parsed.Events, 1) {
+		e := parsed.Events[0]
+
+		assert.Equal(t, CalendarRequest, parsed.Method)
+		assert.Equal(t, "planning-1", e.UID)
+		assert.Equal(t, "Planning, Q2", e.Summary)
+		assert.Equal(t, "Agenda:\nbudget", e.Description)
+		assert.True(t, start.Equal(e.Start))
+		assert.Equal(t, senderAddress, e.Organizer.Address)
+
+		if a := e.Attendee(firstRecipientEmail); assert.NotNil(t, a) {
+			assert.Equal(t, PartStatNeedsAction, a.Status)
+			assert.True(t, a.RSVP)
+		}
+	}
+}
+
+func TestCalendarReply(t *testing.T) {
+	mi := newTestMessageInfo(t, []byte(calendarReply))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := mi.Calendar()
+	if assert.NotNil(t, c) && assert.Len(t, c.Events, 1) {
+		e := c.Events[0]
+
+		assert.Equal(t, CalendarReply, c.Method)
+		assert.Equal(t, "Planning, Q2", e.Summary)
+		assert.Equal(t, time.Date(2021, 3, 15, 9, 0, 0, 0, time.UTC), e.Start.UTC())
+
+		if a := e.Attendee(firstRecipientEmail); assert.NotNil(t, a) {
+			assert.Equal(t, PartStatAccepted, a.Status)
+			assert.Equal(t, "Recipient, First", a.Name)
+		}
+	}
+}
+
+func TestCalendarCancel(t *testing.T) {
+	c, err := NewCalendar("cancel", &Event{UID: "planning-1", Sequence: 1, Summary: strings.Repeat("Long summary ", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := string(c.Bytes())
+
+	assert.Contains(t, data, "STATUS:CANCELLED")
+
+	for _, line := range strings.Split(data, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+
+	parsed, err := ParseCalendar(c.Bytes())
+	if assert.NoError(t, err) {
+		assert.Equal(t, c.Events[0].Summary, parsed.Events[0].Summary)
+		assert.Equal(t, 1, parsed.Events[0].Sequence)
+	}
+
+	_, err = NewCalendar("PUBLISH")
+	assert.Equal(t, ErrCalendarMethod, err)
+}
@@ -0,0 +1,140 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	ClassNormal        = "normal"
+	ClassAutoReply     = "auto_reply"
+	ClassAutoSubmitted = "auto_submitted"
+	ClassBulk          = "bulk"
+)
+
+var (
+	autoReplySubject = regexp.MustCompile(`(?i)^\s*(out of (the )?office|automatic reply|auto(matic)?[ -]?(reply|response)|autoreply|abwesenheitsnotiz|automatische antwort|odpowied[zź] automatyczna|r[ée]ponse automatique|auto:)`)
+	noReplySender    = regexp.MustCompile(`(?i)^(no-?reply|do-?not-?reply|mailer-daemon|postmaster)@`)
+)
+
+//Kind of the message deciding if it was written by a person
+type Classification struct {
+	Class         string   `json:"class"`
+	AutoReply     bool     `json:"auto_reply"`
+	AutoSubmitted bool     `json:"auto_submitted"`
+	Bulk          bool     `json:"bulk"`
+	Reasons       []string `json:"reasons"`
+}
+
+//Checks if the message was sent automatically
+func (c *Classification) Automated() bool {
+	return c.AutoReply || c.AutoSubmitted || c.Bulk
+}
+
+func (c *Classification) add(class, reason string) {
+	switch class {
+	case ClassAutoReply:
+		c.AutoReply = true
+	case ClassAutoSubmitted:
+		c.AutoSubmitted = true
+	case ClassBulk:
+		c.Bulk = true
+	}
+
+	c.Reasons = append(c.Reasons, reason)
+}
+
+//Classifies the message as auto-reply, auto-submitted or bulk using its headers (RFC 3834)
+func (m *MessageInfo) Classification() *Classification {
+	c := &Classification{
+		Reasons: make([]string, 0),
+	}
+
+	header := m.message.Header
+
+	switch v := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted"))); {
+	case v == "auto-replied":
+		c.add(ClassAutoReply, "Auto-Submitted: "+v)
+	case len(v) > 0 && v != "no":
+		c.add(ClassAutoSubmitted, "Auto-Submitted: "+v)
+	}
+
+	for _, h := range []string{"X-Autoreply", "X-Autorespond", "X-Auto-Reply"} {
+		if len(header.Get(h)) > 0 {
+			c.add(ClassAutoReply, h)
+		}
+	}
+
+	if v := strings.ToLower(header.Get("X-Autogenerated")); len(v) > 0 {
+		if v == "reply" {
+			c.add(ClassAutoReply, "X-Autogenerated: "+v)
+		} else {
+			c.add(ClassAutoSubmitted, "X-Autogenerated: "+v)
+		}
+	}
+
+	switch v := strings.ToLower(strings.TrimSpace(header.Get("Precedence"))); v {
+	case "bulk", "list", "junk":
+		c.add(ClassBulk, "Precedence: "+v)
+	case "auto_reply":
+		c.add(ClassAutoReply, "Precedence: "+v)
+	}
+
+	for _, v := range strings.Split(strings.ToLower(header.Get("X-Auto-Response-Suppress")), ",") {
+		switch v = strings.TrimSpace(v); v {
+		case "all", "oof", "autoreply":
+			c.add(ClassAutoSubmitted, "X-Auto-Response-Suppress: "+v)
+		}
+	}
+
+	if len(header.Get("List-Id")) > 0 || len(header.Get("List-Unsubscribe")) > 0 {
+		c.add(ClassBulk, "List-Id or List-Unsubscribe")
+	}
+
+	if strings.TrimSpace(header.Get("Return-Path")) == "<>" {
+		c.add(ClassAutoSubmitted, "Null Return-Path")
+	}
+
+	if noReplySender.MatchString(m.Sender().Address) {
+		c.add(ClassAutoSubmitted, "Sender "+m.Sender().Address)
+	}
+
+	if autoReplySubject.MatchString(m.Subject()) {
+		c.add(ClassAutoReply, "Subject")
+	}
+
+	if m.bounce != nil {
+		c.add(ClassAutoSubmitted, "Delivery status notification")
+	}
+
+	switch {
+	case c.AutoReply:
+		c.Class = ClassAutoReply
+	case c.AutoSubmitted:
+		c.Class = ClassAutoSubmitted
+	case c.Bulk:
+		c.Class = ClassBulk
+	default:
+		c.Class = ClassNormal
+	}
+
+	return c
+}
+
+//Sets account filter of received messages
+func (m *MessageInfo) SetFilter(filter *FilterConfig) {
+	m.filter = filter
+}
+
+//Checks if the account filter excludes the message
+func (m *MessageInfo) Filtered() bool {
+	if m.filter == nil {
+		return false
+	}
+
+	c := m.Classification()
+
+	return (m.filter.AutoReply && c.AutoReply) ||
+		(m.filter.AutoSubmitted && c.AutoSubmitted) ||
+		(m.filter.Bulk && c.Bulk)
+}
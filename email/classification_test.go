@@ -0,0 +1,58 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassification(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		class   string
+	}{
+		{"normal", "From: sender.gopher@golang.org\r\nSubject: Hello\r\n", ClassNormal},
+		{"auto-submitted no", "From: sender.gopher@golang.org\r\nAuto-Submitted: no\r\nSubject: Hello\r\n", ClassNormal},
+		{"vacation", "From: sender.gopher@golang.org\r\nAuto-Submitted: auto-replied\r\nSubject: Away\r\n", ClassAutoReply},
+		{"x-autoreply", "From: sender.gopher@golang.org\r\nX-Autoreply: yes\r\nSubject: Away\r\n", ClassAutoReply},
+		{"outlook", "From: sender.gopher@golang.org\r\nX-Auto-Response-Suppress: All\r\nSubject: Automatic reply: Hello\r\n", ClassAutoReply},
+		{"generated", "From: sender.gopher@golang.org\r\nAuto-Submitted: auto-generated\r\nSubject: Report\r\n", ClassAutoSubmitted},
+		{"no-reply", "From: no-reply@golang.org\r\nSubject: Your order\r\n", ClassAutoSubmitted},
+		{"null return path", "Return-Path: <>\r\nFrom: sender.gopher@golang.org\r\nSubject: Receipt\r\n", ClassAutoSubmitted},
+		{"precedence", "From: sender.gopher@golang.org\r\nPrecedence: bulk\r\nSubject: News\r\n", ClassBulk},
+		{"mailing list", "From: sender.gopher@golang.org\r\nList-Id: <golang-nuts.googlegroups.com>\r\nSubject: Generics\r\n", ClassBulk},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mi := newTestMessageInfo(t, []byte(test.headers+"\r\nBody\r\n"))
+
+			if err := mi.ParseBody(); err != nil {
+				t.Fatal(err)
+			}
+
+			c := mi.Classification()
+			assert.Equal(t, test.class, c.Class)
+			assert.Equal(t, test.class != ClassNormal, c.Automated())
+		})
+	}
+}
+
+func TestClassificationBounce(t *testing.T) {
+	mi := readTestMessage(t, "bounce-postfix-dsn.eml")
+
+	assert.True(t, mi.Classification().AutoSubmitted)
+}
+
+func TestFiltered(t *testing.T) {
+	mi := newTestMessageInfo(t, []byte("From: sender.gopher@golang.org\r\nPrecedence: list\r\nSubject: News\r\n\r\nBody\r\n"))
+
+	assert.False(t, mi.Filtered())
+
+	mi.SetFilter(&FilterConfig{AutoReply: true})
+	assert.False(t, mi.Filtered())
+
+	mi.SetFilter(&FilterConfig{Bulk: true})
+	assert.True(t, mi.Filtered())
+}
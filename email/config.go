@@ -1,13 +1,18 @@
 package email
 
 type Config struct {
-	Key         string     `yaml:"key"`
-	Description string     `yaml:"description"`
-	SMTP        ServerInfo `yaml:"smtp"`
-	POP3        ServerInfo `yaml:"pop3"`
-	Email       string     `yaml:"email"`
-	Username    string     `yaml:"username"`
-	Password    string     `yaml:"password"`
+	Key         string             `yaml:"key"`
+	Description string             `yaml:"description"`
+	SMTP        ServerInfo         `yaml:"smtp"`
+	POP3        ServerInfo         `yaml:"pop3"`
+	Email       string             `yaml:"email"`
+	Username    string             `yaml:"username"`
+	Password    string             `yaml:"password"`
+	DKIM        *DKIMConfig        `yaml:"dkim"`
+	SMIME       *SMIMEConfig       `yaml:"smime"`
+	PGP         *PGPConfig         `yaml:"pgp"`
+	Unsubscribe *UnsubscribeConfig `yaml:"unsubscribe"`
+	Filter      *FilterConfig      `yaml:"filter"`
 }
 
 type ServerInfo struct {
@@ -15,3 +20,84 @@ type ServerInfo struct {
 	Port       int    `yaml:"port"`
 	Encryption bool   `yaml:"encryption"`
 }
+
+type DKIMConfig struct {
+	//Selector published under <selector>._domainkey.<domain>
+	Selector string `yaml:"selector"`
+
+	//Signing domain (d= tag)
+	Domain string `yaml:"domain"`
+
+	//Path to PEM encoded RSA or Ed25519 private key
+	PrivateKeyPath string `yaml:"private_key_path"`
+
+	//Signing algorithm, rsa or ed25519,
+	//when empty it is taken from the key type
+	Algorithm string `yaml:"algorithm"`
+
+	//List of signed headers, when empty DefaultDKIMHeaders is used
+	Headers []string `yaml:"headers"`
+
+	//Header and body canonicalization e.g. relaxed/simple
+	Canonicalization string `yaml:"canonicalization"`
+}
+
+type SMIMEConfig struct {
+	//Path to PEM encoded account certificate
+	CertificatePath string `yaml:"certificate_path"`
+
+	//Path to PEM encoded private key of the account certificate
+	PrivateKeyPath string `yaml:"private_key_path"`
+
+	//Directory with PEM encoded recipient certificates
+	RecipientCertificatesPath string `yaml:"recipient_certificates_path"`
+
+	//PEM bundle of CA certificates trusted when verifying signers,
+	//when empty only the signature itself is verified
+	TrustedCAPath string `yaml:"trusted_ca_path"`
+
+	//Sign every outgoing message
+	Sign bool `yaml:"sign"`
+
+	//Encrypt every outgoing message
+	Encrypt bool `yaml:"encrypt"`
+}
+
+type PGPConfig struct {
+	//Path to armored or binary keyring with account private key
+	KeyringPath string `yaml:"keyring_path"`
+
+	//Path to keyring with recipient public keys
+	PublicKeyringPath string `yaml:"public_keyring_path"`
+
+	//Passphrase protecting account private key
+	Passphrase string `yaml:"passphrase"`
+
+	//Sign every outgoing message
+	Sign bool `yaml:"sign"`
+
+	//Encrypt every outgoing message
+	Encrypt bool `yaml:"encrypt"`
+}
+
+type UnsubscribeConfig struct {
+	//Public URL of the one-click unsubscribe endpoint e.g. https://mail.example.com/unsubscribe
+	URL string `yaml:"url"`
+
+	//Secret signing unsubscribe tokens
+	Secret string `yaml:"secret"`
+
+	//Optional address receiving unsubscribe requests by email
+	Mailto string `yaml:"mailto"`
+}
+
+type FilterConfig struct {
+	//Skips vacation and other automatic replies
+	AutoReply bool `yaml:"auto_reply"`
+
+	//Skips notifications generated by machines e.g. bounces or no-reply senders
+	AutoSubmitted bool `yaml:"auto_submitted"`
+
+	//Skips newsletters and mailing lists
+	Bulk bool `yaml:"bulk"`
+}
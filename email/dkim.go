@@ -0,0 +1,355 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	DKIMSignatureHeader = "DKIM-Signature"
+
+	DKIMAlgorithmRSA     = "rsa"
+	DKIMAlgorithmEd25519 = "ed25519"
+
+	DKIMCanonicalizationSimple  = "simple"
+	DKIMCanonicalizationRelaxed = "relaxed"
+)
+
+var (
+	DefaultDKIMHeaders = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post"}
+
+	ErrDKIMNoFrom = errors.New("DKIM signed headers have to include From")
+)
+
+type DKIMSigner struct {
+	selector    string
+	domain      string
+	algorithm   string
+	headers     []string
+	headerCanon string
+	bodyCanon   string
+	signer      crypto.Signer
+	now         func() time.Time
+}
+
+//Creates DKIM signer from account configuration
+func NewDKIMSigner(config *DKIMConfig) (*DKIMSigner, error) {
+	if len(config.Selector) == 0 || len(config.Domain) == 0 {
+		return nil, errors.New("DKIM selector and domain are required")
+	}
+
+	pemData, err := ioutil.ReadFile(config.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read DKIM private key due to: %s", err)
+	}
+
+	signer, err := parsePrivateKey(pemData)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := dkimKeyAlgorithm(signer, config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	headerCanon, bodyCanon, err := parseDKIMCanonicalization(config.Canonicalization)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := config.Headers
+	if len(headers) == 0 {
+		headers = DefaultDKIMHeaders
+	}
+
+	if !containsFold(headers, "From") {
+		return nil, ErrDKIMNoFrom
+	}
+
+	return &DKIMSigner{
+		selector:    config.Selector,
+		domain:      config.Domain,
+		algorithm:   algorithm,
+		headers:     headers,
+		headerCanon: headerCanon,
+		bodyCanon:   bodyCanon,
+		signer:      signer,
+		now:         time.Now,
+	}, nil
+}
+
+//Signs raw message and returns it with DKIM-Signature header prepended
+func (d *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	header, body := splitMessage(message)
+
+	fields := parseHeaderFields(header)
+
+	bh := sha256.Sum256(canonicalBody(body, d.bodyCanon))
+
+	tags := []string{
+		"v=1",
+		fmt.Sprintf("a=%s-sha256", d.algorithm),
+		fmt.Sprintf("c=%s/%s", d.headerCanon, d.bodyCanon),
+		fmt.Sprintf("d=%s", d.domain),
+		fmt.Sprintf("s=%s", d.selector),
+		fmt.Sprintf("t=%d", d.now().Unix()),
+		fmt.Sprintf("h=%s", strings.Join(d.headers, ":")),
+		fmt.Sprintf("bh=%s", base64.StdEncoding.EncodeToString(bh[:])),
+		"b=",
+	}
+
+	signature := fmt.Sprintf("%s: %s", DKIMSignatureHeader, strings.Join(tags, ";\r\n\t"))
+
+	hash := sha256.New()
+	for _, f := range selectHeaderFields(fields, d.headers) {
+		hash.Write([]byte(canonicalHeader(f, d.headerCanon)))
+	}
+
+	sigHeader := canonicalHeader(signature+"\r\n", d.headerCanon)
+	hash.Write([]byte(strings.TrimSuffix(sigHeader, "\r\n")))
+
+	b, err := d.sign(hash.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("Could not compute DKIM signature due to: %s", err)
+	}
+
+	signed := &bytes.Buffer{}
+	signed.WriteString(signature)
+	signed.WriteString(base64.StdEncoding.EncodeToString(b))
+	signed.WriteString("\r\n")
+	signed.Write(normalizeCRLF(message))
+
+	return signed.Bytes(), nil
+}
+
+func (d *DKIMSigner) sign(digest []byte) ([]byte, error) {
+	switch d.algorithm {
+	case DKIMAlgorithmEd25519:
+		return d.signer.Sign(rand.Reader, digest, crypto.Hash(0))
+	default:
+		return d.signer.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+}
+
+func dkimKeyAlgorithm(signer crypto.Signer, algorithm string) (string, error) {
+	var keyAlgorithm string
+
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		keyAlgorithm = DKIMAlgorithmRSA
+	case ed25519.PrivateKey:
+		keyAlgorithm = DKIMAlgorithmEd25519
+	default:
+		return "", errors.New("Unsupported DKIM private key type")
+	}
+
+	algorithm = strings.ToLower(strings.TrimSuffix(algorithm, "-sha256"))
+
+	if len(algorithm) > 0 && algorithm != keyAlgorithm {
+		return "", fmt.Errorf("DKIM algorithm %s does not match %s private key", algorithm, keyAlgorithm)
+	}
+
+	return keyAlgorithm, nil
+}
+
+func parseDKIMCanonicalization(c string) (string, string, error) {
+	if len(c) == 0 {
+		return DKIMCanonicalizationRelaxed, DKIMCanonicalizationRelaxed, nil
+	}
+
+	hc, bc := c, DKIMCanonicalizationSimple
+	if i := strings.Index(c, "/"); i >= 0 {
+		hc, bc = c[:i], c[i+1:]
+	}
+
+	for _, v := range []string{hc, bc} {
+		if v != DKIMCanonicalizationSimple && v != DKIMCanonicalizationRelaxed {
+			return "", "", fmt.Errorf("Unknown DKIM canonicalization %s", c)
+		}
+	}
+
+	return hc, bc, nil
+}
+
+//Splits message into header block and body, header keeps trailing CRLF of the last field
+func splitMessage(message []byte) ([]byte, []byte) {
+	message = normalizeCRLF(message)
+
+	if bytes.HasPrefix(message, []byte("\r\n")) {
+		return nil, message[2:]
+	}
+
+	i := bytes.Index(message, []byte("\r\n\r\n"))
+	if i < 0 {
+		return message, nil
+	}
+
+	return message[:i+2], message[i+4:]
+}
+
+//Converts bare LF line endings to CRLF
+func normalizeCRLF(b []byte) []byte {
+	if !bytes.Contains(b, []byte("\n")) {
+		return b
+	}
+
+	out := bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n"))
+}
+
+//Returns raw header fields including folded continuation lines and trailing CRLF
+func parseHeaderFields(header []byte) []string {
+	fields := make([]string, 0)
+
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+
+		fields = append(fields, line)
+	}
+
+	return fields
+}
+
+func headerFieldName(field string) string {
+	i := strings.Index(field, ":")
+	if i < 0 {
+		return strings.TrimSpace(field)
+	}
+
+	return strings.TrimSpace(field[:i])
+}
+
+//Picks signed header fields, multiple instances are taken from the bottom up
+func selectHeaderFields(fields []string, names []string) []string {
+	used := make(map[int]bool)
+	selected := make([]string, 0, len(names))
+
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(headerFieldName(fields[i]), name) {
+				continue
+			}
+
+			used[i] = true
+			selected = append(selected, fields[i])
+			break
+		}
+	}
+
+	return selected
+}
+
+func canonicalHeader(field string, canon string) string {
+	if canon == DKIMCanonicalizationSimple {
+		return field
+	}
+
+	name := field
+	value := ""
+
+	if i := strings.Index(field, ":"); i >= 0 {
+		name, value = field[:i], field[i+1:]
+	}
+
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+
+	return fmt.Sprintf("%s:%s\r\n", strings.ToLower(strings.TrimSpace(name)), value)
+}
+
+func canonicalBody(body []byte, canon string) []byte {
+	lines := strings.SplitAfter(string(normalizeCRLF(body)), "\r\n")
+
+	b := &strings.Builder{}
+
+	for _, line := range lines {
+		if canon == DKIMCanonicalizationRelaxed {
+			hasCRLF := strings.HasSuffix(line, "\r\n")
+			line = strings.TrimRightFunc(strings.TrimSuffix(line, "\r\n"), isWSP)
+			line = compressWSP(line)
+
+			if hasCRLF {
+				line += "\r\n"
+			}
+		}
+
+		b.WriteString(line)
+	}
+
+	c := b.String()
+
+	if len(c) > 0 && !strings.HasSuffix(c, "\r\n") {
+		c += "\r\n"
+	}
+
+	for strings.HasSuffix(c, "\r\n\r\n") {
+		c = strings.TrimSuffix(c, "\r\n")
+	}
+
+	if c == "\r\n" && canon == DKIMCanonicalizationRelaxed {
+		c = ""
+	}
+
+	if len(c) == 0 && canon == DKIMCanonicalizationSimple {
+		c = "\r\n"
+	}
+
+	return []byte(c)
+}
+
+func compressWSP(s string) string {
+	b := &strings.Builder{}
+	wsp := false
+
+	for _, r := range s {
+		if isWSP(r) {
+			wsp = true
+			continue
+		}
+
+		if wsp {
+			b.WriteRune(' ')
+			wsp = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	if wsp {
+		b.WriteRune(' ')
+	}
+
+	return b.String()
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,178 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestKey(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "dkim")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "dkim.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+//Verifies DKIM-Signature of the message with independent verifier, DNS record of the selector
+//is answered with the given public key
+func verifyWithKey(message []byte, pub crypto.PublicKey) error {
+	var record string
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			return err
+		}
+		record = "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	case ed25519.PublicKey:
+		record = "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k)
+	default:
+		return fmt.Errorf("Unsupported key %T", pub)
+	}
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(message), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "test._domainkey.golang.org" {
+				return nil, fmt.Errorf("Unexpected DNS query for %s", domain)
+			}
+
+			return []string{record}, nil
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(verifications) != 1 {
+		return fmt.Errorf("Expected one signature, got %d", len(verifications))
+	}
+
+	return verifications[0].Err
+}
+
+func TestDKIMSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		algorithm string
+		canon     string
+		key       interface{}
+		pub       crypto.PublicKey
+	}{
+		{DKIMAlgorithmRSA, "relaxed/relaxed", rsaKey, &rsaKey.PublicKey},
+		{DKIMAlgorithmRSA, "simple/simple", rsaKey, &rsaKey.PublicKey},
+		{DKIMAlgorithmEd25519, "relaxed/simple", edKey, edPub},
+		{"", "simple/relaxed", edKey, edPub},
+	}
+
+	for _, c := range cases {
+		m, err := createTestMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mb, err := m.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signer, err := NewDKIMSigner(&DKIMConfig{
+			Selector:         "test",
+			Domain:           "golang.org",
+			PrivateKeyPath:   writeTestKey(t, c.key),
+			Algorithm:        c.algorithm,
+			Canonicalization: c.canon,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signed, err := signer.Sign(mb)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := mail.ReadMessage(strings.NewReader(string(signed))); err != nil {
+			t.Errorf("Bad signed message format: %s", err)
+		}
+
+		assert.NoErrorf(t, verifyWithKey(signed, c.pub), "Signature verification failed for %s %s", c.algorithm, c.canon)
+
+		tampered := strings.Replace(string(signed), contentText, "Changed text", 1)
+		tampered = strings.Replace(tampered, subject, "Changed subject", 1)
+		assert.Errorf(t, verifyWithKey([]byte(tampered), c.pub), "Tampered message verified for %s %s", c.algorithm, c.canon)
+	}
+}
+
+func TestDKIMAlgorithmMismatch(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewDKIMSigner(&DKIMConfig{
+		Selector:       "test",
+		Domain:         "golang.org",
+		PrivateKeyPath: writeTestKey(t, edKey),
+		Algorithm:      DKIMAlgorithmRSA,
+	})
+
+	assert.Error(t, err, "Algorithm mismatch should fail")
+}
+
+func TestCanonicalBody(t *testing.T) {
+	body := []byte(" C \r\nD \t E\r\n\r\n\r\n")
+
+	assert.Equal(t, " C\r\nD E\r\n", string(canonicalBody(body, DKIMCanonicalizationRelaxed)))
+	assert.Equal(t, " C \r\nD \t E\r\n", string(canonicalBody(body, DKIMCanonicalizationSimple)))
+	assert.Equal(t, "\r\n", string(canonicalBody(nil, DKIMCanonicalizationSimple)))
+	assert.Equal(t, "", string(canonicalBody(nil, DKIMCanonicalizationRelaxed)))
+}
+
+func TestCanonicalHeader(t *testing.T) {
+	field := "SUBJect \t:  A  test\r\n\t  subject \r\n"
+
+	assert.Equal(t, "subject:A test subject\r\n", canonicalHeader(field, DKIMCanonicalizationRelaxed))
+	assert.Equal(t, field, canonicalHeader(field, DKIMCanonicalizationSimple))
+}
@@ -0,0 +1,252 @@
+package email
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AuthPass      = "pass"
+	AuthFail      = "fail"
+	AuthNone      = "none"
+	AuthNeutral   = "neutral"
+	AuthSoftFail  = "softfail"
+	AuthTempError = "temperror"
+	AuthPermError = "permerror"
+)
+
+type DKIMResult struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+//Verifies every DKIM-Signature header of the raw message
+func VerifyDKIM(message []byte, resolver Resolver) []*DKIMResult {
+	header, body := splitMessage(message)
+	fields := parseHeaderFields(header)
+
+	results := make([]*DKIMResult, 0)
+
+	for _, f := range fields {
+		if !strings.EqualFold(headerFieldName(f), DKIMSignatureHeader) {
+			continue
+		}
+
+		results = append(results, verifyDKIMField(f, fields, body, resolver))
+	}
+
+	return results
+}
+
+func verifyDKIMField(field string, fields []string, body []byte, resolver Resolver) *DKIMResult {
+	result := &DKIMResult{}
+
+	fail := func(status string, err error) *DKIMResult {
+		result.Status = status
+		result.Error = err.Error()
+		return result
+	}
+
+	tags, err := parseTagList(field[strings.Index(field, ":")+1:])
+	if err != nil {
+		return fail(AuthPermError, err)
+	}
+
+	result.Domain = strings.ToLower(tags["d"])
+	result.Selector = tags["s"]
+
+	for _, t := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[t]; !ok {
+			return fail(AuthPermError, fmt.Errorf("Missing %s= tag", t))
+		}
+	}
+
+	if tags["v"] != "1" {
+		return fail(AuthPermError, errors.New("Unsupported DKIM version"))
+	}
+
+	headerCanon, bodyCanon, err := parseDKIMCanonicalization(tags["c"])
+	if len(tags["c"]) == 0 {
+		headerCanon, bodyCanon = DKIMCanonicalizationSimple, DKIMCanonicalizationSimple
+	}
+	if err != nil {
+		return fail(AuthPermError, err)
+	}
+
+	signed := strings.Split(removeWSP(tags["h"]), ":")
+	if !containsFold(signed, "From") {
+		return fail(AuthPermError, ErrDKIMNoFrom)
+	}
+
+	if x, ok := tags["x"]; ok {
+		exp, err := strconv.ParseInt(x, 10, 64)
+		if err == nil && time.Now().Unix() > exp {
+			return fail(AuthFail, errors.New("Signature expired"))
+		}
+	}
+
+	cb := canonicalBody(body, bodyCanon)
+	if l, ok := tags["l"]; ok {
+		n, err := strconv.Atoi(l)
+		if err != nil || n > len(cb) {
+			return fail(AuthPermError, errors.New("Bad body length tag"))
+		}
+		cb = cb[:n]
+	}
+
+	bh := sha256.Sum256(cb)
+	if base64.StdEncoding.EncodeToString(bh[:]) != removeWSP(tags["bh"]) {
+		return fail(AuthFail, errors.New("Body hash did not verify"))
+	}
+
+	pub, err := lookupDKIMKey(result.Selector, result.Domain, resolver)
+	if err != nil {
+		if isNotFound(err) {
+			return fail(AuthPermError, err)
+		}
+		return fail(AuthTempError, err)
+	}
+
+	hash := sha256.New()
+	for _, f := range selectHeaderFields(fields, signed) {
+		hash.Write([]byte(canonicalHeader(f, headerCanon)))
+	}
+
+	sigHeader := canonicalHeader(stripSignatureValue(field), headerCanon)
+	hash.Write([]byte(strings.TrimSuffix(sigHeader, "\r\n")))
+
+	sig, err := base64.StdEncoding.DecodeString(removeWSP(tags["b"]))
+	if err != nil {
+		return fail(AuthPermError, err)
+	}
+
+	if err := verifyDKIMSignature(tags["a"], pub, hash.Sum(nil), sig); err != nil {
+		return fail(AuthFail, err)
+	}
+
+	result.Status = AuthPass
+
+	return result
+}
+
+func verifyDKIMSignature(algorithm string, pub crypto.PublicKey, digest, sig []byte) error {
+	switch algorithm {
+	case "rsa-sha256":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("Key type does not match rsa-sha256")
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig)
+	case "ed25519-sha256":
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("Key type does not match ed25519-sha256")
+		}
+		if !ed25519.Verify(key, digest, sig) {
+			return errors.New("Signature did not verify")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported signing algorithm %s", algorithm)
+}
+
+func lookupDKIMKey(selector, domain string, resolver Resolver) (crypto.PublicKey, error) {
+	txt, err := resolver.LookupTXT(fmt.Sprintf("%s._domainkey.%s", selector, domain))
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := parseTagList(strings.Join(txt, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	p := removeWSP(tags["p"])
+	if len(p) == 0 {
+		return nil, errors.New("DKIM key has been revoked")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tags["k"] {
+	case "", DKIMAlgorithmRSA:
+		if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+			return key, nil
+		}
+		return x509.ParsePKCS1PublicKey(der)
+	case DKIMAlgorithmEd25519:
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("Bad ed25519 key size")
+		}
+		return ed25519.PublicKey(der), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported DKIM key type %s", tags["k"])
+}
+
+//Parses tag=value list used by DKIM signatures, DKIM keys and DMARC records
+func parseTagList(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	for _, t := range strings.Split(s, ";") {
+		t = strings.TrimSpace(t)
+		if len(t) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Bad tag %s", t)
+		}
+
+		name := strings.TrimSpace(kv[0])
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("Duplicated tag %s", name)
+		}
+
+		tags[name] = strings.TrimSpace(kv[1])
+	}
+
+	return tags, nil
+}
+
+//Removes value of the b= tag leaving the rest of the signature field untouched
+func stripSignatureValue(field string) string {
+	i := strings.Index(field, ":")
+	if i < 0 {
+		return field
+	}
+
+	parts := strings.Split(field[i+1:], ";")
+	for n, p := range parts {
+		if strings.TrimSpace(strings.SplitN(p, "=", 2)[0]) == "b" {
+			parts[n] = p[:strings.Index(p, "=")+1]
+		}
+	}
+
+	s := field[:i+1] + strings.Join(parts, ";")
+	if !strings.HasSuffix(s, "\r\n") {
+		s += "\r\n"
+	}
+
+	return s
+}
+
+func removeWSP(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,136 @@
+package email
+
+import (
+	"strings"
+)
+
+type DMARCResult struct {
+	Domain string `json:"domain"`
+	Policy string `json:"policy"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type dmarcRecord struct {
+	policy          string
+	subdomainPolicy string
+	adkim           string
+	aspf            string
+}
+
+//Computes DMARC result for the From domain using already evaluated DKIM and SPF results
+func CheckDMARC(fromDomain string, dkim []*DKIMResult, spf *SPFResult, resolver Resolver) *DMARCResult {
+	result := &DMARCResult{
+		Domain: fromDomain,
+		Status: AuthNone,
+	}
+
+	if len(fromDomain) == 0 {
+		return result
+	}
+
+	record, err := lookupDMARC(fromDomain, resolver)
+	if err != nil {
+		result.Status = AuthTempError
+		result.Error = err.Error()
+		return result
+	}
+
+	if record == nil {
+		return result
+	}
+
+	result.Policy = record.policy
+
+	for _, d := range dkim {
+		if d.Status == AuthPass && domainAligned(fromDomain, d.Domain, record.adkim) {
+			result.Status = AuthPass
+			return result
+		}
+	}
+
+	if spf != nil && spf.Status == AuthPass && domainAligned(fromDomain, spf.Domain, record.aspf) {
+		result.Status = AuthPass
+		return result
+	}
+
+	result.Status = AuthFail
+
+	return result
+}
+
+func lookupDMARC(domain string, resolver Resolver) (*dmarcRecord, error) {
+	record, err := queryDMARC(domain, resolver)
+	if err != nil || record != nil {
+		return record, err
+	}
+
+	org := organizationalDomain(domain)
+	if org == domain {
+		return nil, nil
+	}
+
+	record, err = queryDMARC(org, resolver)
+	if record != nil && len(record.subdomainPolicy) > 0 {
+		record.policy = record.subdomainPolicy
+	}
+
+	return record, err
+}
+
+func queryDMARC(domain string, resolver Resolver) (*dmarcRecord, error) {
+	txt, err := resolver.LookupTXT("_dmarc." + domain)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, t := range txt {
+		if !strings.HasPrefix(strings.ToLower(t), "v=dmarc1") {
+			continue
+		}
+
+		tags, err := parseTagList(t)
+		if err != nil {
+			continue
+		}
+
+		return &dmarcRecord{
+			policy:          strings.ToLower(tags["p"]),
+			subdomainPolicy: strings.ToLower(tags["sp"]),
+			adkim:           strings.ToLower(tags["adkim"]),
+			aspf:            strings.ToLower(tags["aspf"]),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func domainAligned(fromDomain, domain, mode string) bool {
+	fromDomain = strings.ToLower(fromDomain)
+	domain = strings.ToLower(domain)
+
+	if mode == "s" {
+		return fromDomain == domain
+	}
+
+	return organizationalDomain(fromDomain) == organizationalDomain(domain)
+}
+
+//Approximates organizational domain as the last two labels, or three for common second level registries
+func organizationalDomain(domain string) string {
+	labels := strings.Split(strings.Trim(strings.ToLower(domain), "."), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+
+	n := 2
+	switch labels[len(labels)-2] {
+	case "co", "com", "net", "org", "gov", "edu", "ac":
+		n = 3
+	}
+
+	return strings.Join(labels[len(labels)-n:], ".")
+}
@@ -6,9 +6,11 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/mail"
 	"net/smtp"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,10 +22,38 @@ import (
 
 type ReceiveFunc func(info Stat) error
 
+//Sends message with SMTP, replaced in tests
+var sendMail = smtp.SendMail
+
+//Error of message sent separately to every recipient,
+//recipients the message was delivered to should not be sent it again
+type DeliveryError struct {
+	Delivered []string
+	Failed    map[string]error
+}
+
+func (d *DeliveryError) Error() string {
+	failed := make([]string, 0, len(d.Failed))
+
+	for r, err := range d.Failed {
+		failed = append(failed, fmt.Sprintf("%s (%s)", r, err))
+	}
+
+	sort.Strings(failed)
+
+	delivered := "none"
+	if len(d.Delivered) > 0 {
+		delivered = strings.Join(d.Delivered, ",")
+	}
+
+	return fmt.Sprintf("Could not deliver message to %s, delivered to %s", strings.Join(failed, ", "), delivered)
+}
+
 type Email struct {
-	config []*Config
-	smtp   *SMTPServer
-	mutex  *sync.Mutex
+	config       []*Config
+	smtp         *SMTPServer
+	mutex        *sync.Mutex
+	suppressions Suppressions
 }
 
 func NewEmail() *Email {
@@ -117,30 +147,178 @@ func (e *Email) ReadMessage(key string, number int64) (*MessageInfo, error) {
 		return nil, err
 	}
 
-	return NewMessageInfo(r), nil
+	mi := NewMessageInfo(r)
+	if mi == nil {
+		return nil, fmt.Errorf("Could not read message %d, client key %s", number, key)
+	}
+
+	if err := e.prepare(key, mi); err != nil {
+		return nil, err
+	}
+
+	return mi, nil
+}
+
+//Message info of raw message received by the account, body is not parsed yet
+func (e *Email) ParseMessage(key string, raw []byte) (*MessageInfo, error) {
+	mi, err := ParseMessageInfo(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse message due to: %s, client key %s", err, key)
+	}
+
+	if err := e.prepare(key, mi); err != nil {
+		return nil, err
+	}
+
+	return mi, nil
+}
+
+//Applies S/MIME, PGP and filter settings of the account
+func (e *Email) prepare(key string, mi *MessageInfo) error {
+	c, err := e.configByKey(key)
+	if err != nil {
+		return err
+	}
+
+	if c.SMIME != nil {
+		identity, roots, err := e.smimeReader(c)
+		if err != nil {
+			log.Printf("Could not load S/MIME identity due to: %s, client key %s", err, key)
+		} else {
+			mi.SetSMIME(identity, roots)
+		}
+	}
+
+	if c.PGP != nil {
+		keyring, err := LoadPGPAccountKeyring(c.PGP)
+		if err != nil {
+			log.Printf("Could not load PGP keyring due to: %s, client key %s", err, key)
+		} else {
+			mi.SetPGP(keyring)
+		}
+	}
+
+	mi.SetFilter(c.Filter)
+
+	return nil
 }
 
 func (e *Email) send(config *Config, msg *Message) error {
-	auth := e.smtp.LoginAuth(config)
+	recipients, err := e.deliverable(config, msg.EnvelopeRecipients())
+	if err != nil {
+		return err
+	}
 
-	recipients := strings.Split(msg.Recipients(), ",")
+	if config.Unsubscribe == nil {
+		return e.deliver(config, msg, recipients)
+	}
 
-	mb, err := msg.Bytes()
+	//unsubscribe link is personal so every recipient gets own copy,
+	//all copies are built first so broken configuration does not deliver some of them
+	copies := make([][]byte, 0, len(recipients))
+
+	for _, r := range recipients {
+		address := strings.TrimSpace(r)
+		if a, err := mail.ParseAddress(address); err == nil {
+			address = a.Address
+		}
+
+		if err := msg.SetListUnsubscribe(config.Unsubscribe, config.Key, address); err != nil {
+			return err
+		}
+
+		mb, err := e.build(config, msg)
+		if err != nil {
+			return err
+		}
+
+		copies = append(copies, mb)
+	}
+
+	deliveryErr := &DeliveryError{
+		Delivered: make([]string, 0),
+		Failed:    make(map[string]error),
+	}
+
+	for i, r := range recipients {
+		if err := e.transmit(config, msg, []string{r}, copies[i]); err != nil {
+			deliveryErr.Failed[r] = err
+			continue
+		}
+
+		deliveryErr.Delivered = append(deliveryErr.Delivered, r)
+	}
+
+	if len(deliveryErr.Failed) > 0 {
+		return deliveryErr
+	}
+
+	return nil
+}
+
+func (e *Email) deliver(config *Config, msg *Message, recipients []string) error {
+	mb, err := e.build(config, msg)
 	if err != nil {
 		return err
 	}
 
-	err = smtp.SendMail(fmt.Sprintf("%s:%d", config.SMTP.Hostname, config.SMTP.Port), auth, msg.SenderAddress(), recipients, mb)
+	return e.transmit(config, msg, recipients, mb)
+}
+
+//Message signed and encrypted with the account settings
+func (e *Email) build(config *Config, msg *Message) ([]byte, error) {
+	mb, err := msg.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if (msg.smimeSign || msg.smimeEncrypt) && (msg.pgpSign || msg.pgpEncrypt) {
+		return nil, ErrSMIMEAndPGP
+	}
+
+	mb, err = e.smime(config, msg, mb)
+	if err != nil {
+		return nil, err
+	}
+
+	mb, err = e.pgp(config, msg, mb)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DKIM != nil {
+		mb, err = e.dkimSign(config, mb)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mb, nil
+}
+
+func (e *Email) transmit(config *Config, msg *Message, recipients []string, mb []byte) error {
+	auth := e.smtp.LoginAuth(config)
+
+	err := sendMail(fmt.Sprintf("%s:%d", config.SMTP.Hostname, config.SMTP.Port), auth, msg.SenderAddress(), recipients, mb)
 	if err != nil {
 		log.Printf("Error when try to send email due to: %s, client key %s", err, config.Key)
 		return err
 	}
 
-	log.Printf("Email was sended successful to %s, client key %s", msg.Recipients(), config.Key)
+	log.Printf("Email %s was sended successful to %s, client key %s", msg.MessageID(), strings.Join(recipients, ","), config.Key)
 
 	return nil
 }
 
+func (e *Email) dkimSign(config *Config, message []byte) ([]byte, error) {
+	signer, err := NewDKIMSigner(config.DKIM)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create DKIM signer due to: %s, client key %s", err, config.Key)
+	}
+
+	return signer.Sign(message)
+}
+
 func (e *Email) client(key string) (*pop3.Client, error) {
 	c, err := e.configByKey(key)
 	if err != nil {
@@ -185,7 +363,7 @@ func (e *Email) loadConfig() ([]*Config, error) {
 
 func (e *Email) configByKey(key string) (*Config, error) {
 	for _, c := range e.config {
-		if strings.Contains(key, c.Key) {
+		if c.Key == key {
 			return c, nil
 		}
 	}
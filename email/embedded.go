@@ -0,0 +1,57 @@
+package email
+
+import (
+	"bytes"
+	"log"
+	"net/mail"
+)
+
+//Deeper forwarded messages are kept as .eml files
+const maxMessageDepth = 8
+
+//Messages attached as message/rfc822 parts e.g. forwarded as attachment
+func (m *MessageInfo) Messages() []*MessageInfo {
+	return m.messages
+}
+
+func isEmbeddedMessage(mediatype string) bool {
+	return mediatype == "message/rfc822" || mediatype == "message/global"
+}
+
+func (m *MessageInfo) putMessage(part *Part) error {
+	if m.depth >= maxMessageDepth {
+		return m.putFile(part)
+	}
+
+	nested, err := newEmbeddedMessageInfo(part.Data, m.depth+1, m.options...)
+	if err != nil {
+		log.Printf("Could not parse message attached to %s due to: %s", m.MessageId(), err)
+		return m.putFile(part)
+	}
+
+	m.messages = append(m.messages, nested)
+
+	return nil
+}
+
+func newEmbeddedMessageInfo(data []byte, depth int, options ...ParseOption) (*MessageInfo, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MessageInfo{
+		message:  message,
+		raw:      data,
+		files:    make([]*File, 0),
+		contents: make([]*Content, 0),
+		messages: make([]*MessageInfo, 0),
+		depth:    depth,
+	}
+
+	if err := m.ParseBody(options...); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,84 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const forwardedMessage = "From: Gopher <sender.gopher@golang.org>\r\n" +
+	"To: first.recipient@golang.org\r\n" +
+	"Subject: Fwd: Invoice\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"See the attached message\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"Content-Disposition: attachment\r\n" +
+	"\r\n" +
+	"From: Customer <customer@golang.org>\r\n" +
+	"Subject: Invoice\r\n" +
+	"Message-ID: <invoice@golang.org>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Invoice attached\r\n" +
+	"--inner\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQ=\r\n" +
+	"--inner--\r\n" +
+	"\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmbeddedMessage(t *testing.T) {
+	mi := newTestMessageInfo(t, []byte(forwardedMessage))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, mi.Contents(), 1)
+	assert.Empty(t, mi.Files())
+
+	if !assert.Len(t, mi.Messages(), 1) {
+		return
+	}
+
+	nested := mi.Messages()[0]
+	assert.Equal(t, "Invoice", nested.Subject())
+	assert.Equal(t, "customer@golang.org", nested.Sender().Address)
+	assert.Equal(t, "invoice@golang.org", nested.MessageId())
+
+	if assert.Len(t, nested.Contents(), 1) {
+		assert.Equal(t, "Invoice attached", string(nested.Contents()[0].Data))
+	}
+
+	if assert.Len(t, nested.Files(), 1) {
+		assert.Equal(t, "invoice.pdf", nested.Files()[0].Name)
+		assert.Equal(t, "%PDF-1.4", string(nested.Files()[0].Data))
+	}
+}
+
+func TestEmbeddedMessageDepth(t *testing.T) {
+	mi := &MessageInfo{depth: maxMessageDepth}
+
+	if err := mi.putMessage(&Part{ContentType: "message/rfc822", Data: []byte("Subject: Deep\r\n\r\nBody")}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, mi.Messages())
+
+	if assert.Len(t, mi.Files(), 1) {
+		assert.Equal(t, "part-1.eml", mi.Files()[0].Name)
+	}
+}
@@ -2,15 +2,23 @@ package email
 
 import (
 	"bytes"
+	"encoding/base64"
 	"io"
 	"io/ioutil"
 	"mime"
+	"mime/quotedprintable"
+	"regexp"
 	"strings"
 
 	"github.com/paulrosania/go-charset/charset"
 )
 
 func decode(encoded string) (string, error) {
+	return wordDecoder().DecodeHeader(encoded)
+}
+
+//Decoder of RFC 2047 encoded words converting every charset to UTF-8
+func wordDecoder() *mime.WordDecoder {
 	wd := new(mime.WordDecoder)
 
 	wd.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
@@ -26,7 +34,7 @@ func decode(encoded string) (string, error) {
 		return input, nil
 	}
 
-	return wd.DecodeHeader(encoded)
+	return wd
 }
 
 func decodeCharset(ch string, r io.Reader) ([]byte, error) {
@@ -42,3 +50,56 @@ func decodeCharset(ch string, r io.Reader) ([]byte, error) {
 
 	return c, nil
 }
+
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)`)
+
+//Converts text in the charset to UTF-8
+func toUTF8(ch string, data []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(ch)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return data, nil
+	}
+
+	return decodeCharset(ch, bytes.NewReader(data))
+}
+
+//Finds charset declared by the HTML meta tag
+func sniffHTMLCharset(data []byte) string {
+	if len(data) > 4096 {
+		data = data[:4096]
+	}
+
+	m := metaCharset.FindSubmatch(data)
+	if m == nil {
+		return ""
+	}
+
+	return strings.ToLower(string(m[1]))
+}
+
+//Declares UTF-8 in HTML meta tags of content converted from other charset
+func rewriteHTMLCharset(data []byte) []byte {
+	return metaCharset.ReplaceAllFunc(data, func(tag []byte) []byte {
+		loc := metaCharset.FindSubmatchIndex(tag)
+
+		rewritten := make([]byte, 0, len(tag))
+		rewritten = append(rewritten, tag[:loc[2]]...)
+		rewritten = append(rewritten, "utf-8"...)
+
+		return append(rewritten, tag[loc[3]:]...)
+	})
+}
+
+//Returns reader removing the content transfer encoding
+func transferDecoder(cte string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+
+	//7bit, 8bit and binary bodies are not encoded
+
+	return r
+}
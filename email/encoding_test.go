@@ -0,0 +1,62 @@
+package email
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCorpus(t *testing.T) {
+	tests := []struct {
+		file     string
+		subject  string
+		contents []string
+	}{
+		{"quoted-printable-latin2.eml", "Zażółć", []string{"Zażółć gęślą jaźń\n"}},
+		{"html-meta-charset.eml", "Meta charset", []string{
+			"Pozdrawiam, Łukasz",
+			`<html><head><meta http-equiv="Content-Type" content="text/html; charset=utf-8"></head><body><p>Pozdrawiam, Łukasz</p></body></html>`,
+		}},
+		{"quoted-printable-soft-breaks.eml", "Soft breaks", []string{
+			"<p>Café crème – this line is long enough to be wrapped by the quoted-printable soft line break rule.</p>\n",
+		}},
+		{"8bit-utf8.eml", "8bit", []string{"Grüße aus München\n"}},
+		{"base64-koi8r.eml", "KOI8-R", []string{"Привет, мир"}},
+		{"invalid-content-type.eml", "Broken header", []string{"Still readable"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			raw, err := ioutil.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mi := newTestMessageInfo(t, raw)
+
+			if err := mi.ParseBody(); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, test.subject, mi.Subject())
+
+			if assert.Len(t, mi.Contents(), len(test.contents)) {
+				for i, c := range test.contents {
+					assert.Equal(t, c, string(mi.Contents()[i].Data))
+				}
+			}
+		})
+	}
+}
+
+func TestSniffHTMLCharset(t *testing.T) {
+	assert.Equal(t, "iso-8859-2", sniffHTMLCharset([]byte(`<meta charset="ISO-8859-2">`)))
+	assert.Equal(t, "windows-1250", sniffHTMLCharset([]byte(`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=windows-1250">`)))
+	assert.Empty(t, sniffHTMLCharset([]byte(`<p>charset=utf-8</p>`)))
+}
+
+func TestRewriteHTMLCharset(t *testing.T) {
+	assert.Equal(t, `<meta charset="utf-8"><p>charset=latin2</p>`, string(rewriteHTMLCharset([]byte(`<meta charset="ISO-8859-2"><p>charset=latin2</p>`))))
+}
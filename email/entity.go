@@ -0,0 +1,169 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+//Splits raw message into top level header fields and the MIME entity built from Content-* fields and body
+func splitEntity(message []byte) ([]string, []byte) {
+	header, body := splitMessage(message)
+
+	outer := make([]string, 0)
+	entity := &bytes.Buffer{}
+
+	for _, f := range parseHeaderFields(header) {
+		if strings.HasPrefix(strings.ToLower(headerFieldName(f)), "content-") {
+			entity.WriteString(f)
+			continue
+		}
+
+		outer = append(outer, f)
+	}
+
+	entity.WriteString("\r\n")
+	entity.Write(body)
+
+	return outer, entity.Bytes()
+}
+
+//Builds message from top level header fields, entity header fields and body
+func joinEntity(outer []string, header []string, body []byte) []byte {
+	b := &bytes.Buffer{}
+
+	for _, f := range outer {
+		b.WriteString(f)
+	}
+
+	for _, f := range header {
+		b.WriteString(f)
+		b.WriteString("\r\n")
+	}
+
+	b.WriteString("\r\n")
+	b.Write(body)
+
+	return b.Bytes()
+}
+
+//Splits multipart/signed body (RFC 1847) into the signed entity and raw signature part
+func splitSignedBody(body []byte, boundary string) ([]byte, []byte, error) {
+	b := append([]byte("\r\n"), normalizeCRLF(body)...)
+	delimiter := []byte("\r\n--" + boundary)
+
+	parts := make([][]byte, 0, 2)
+	offset := bytes.Index(b, delimiter)
+
+	for offset >= 0 && len(parts) < 2 {
+		start := offset + len(delimiter)
+
+		eol := bytes.Index(b[start:], []byte("\r\n"))
+		if eol < 0 {
+			break
+		}
+		start += eol + 2
+
+		end := bytes.Index(b[start:], delimiter)
+		if end < 0 {
+			break
+		}
+
+		parts = append(parts, b[start:start+end])
+		offset = start + end
+	}
+
+	if len(parts) != 2 {
+		return nil, nil, errors.New("Signed body has to contain entity and signature parts")
+	}
+
+	return parts[0], parts[1], nil
+}
+
+//Decrypts and verifies S/MIME and PGP/MIME layers replacing message entity with the inner content
+func (m *MessageInfo) unwrapEntity() error {
+	for {
+		mediatype, params, err := mime.ParseMediaType(m.message.Header.Get("Content-Type"))
+		if err != nil {
+			return nil
+		}
+
+		protocol := strings.ToLower(params["protocol"])
+
+		switch {
+		case isPKCS7Mime(mediatype):
+			if err := m.unwrapPKCS7Mime(params); err != nil {
+				m.smimeStatus().Error = err.Error()
+				return err
+			}
+		case mediatype == "multipart/signed" && isPKCS7Signature(protocol):
+			if err := m.unwrapSignedSMIME(params["boundary"]); err != nil {
+				m.smimeStatus().Error = err.Error()
+				return err
+			}
+		case mediatype == "multipart/signed" && protocol == PGPSignatureType:
+			if err := m.unwrapSignedPGP(params["boundary"]); err != nil {
+				m.pgpStatus().Error = err.Error()
+				return err
+			}
+		case mediatype == "multipart/encrypted" && protocol == PGPEncryptedType:
+			if err := m.unwrapEncryptedPGP(params["boundary"]); err != nil {
+				m.pgpStatus().Error = err.Error()
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+//Replaces Content-* headers and body of the message with the given MIME entity
+func (m *MessageInfo) replaceEntity(entity []byte) error {
+	inner, err := mail.ReadMessage(bytes.NewReader(normalizeCRLF(entity)))
+	if err != nil {
+		return fmt.Errorf("Could not read inner entity due to: %s", err)
+	}
+
+	header := make(mail.Header)
+
+	for k, v := range m.message.Header {
+		if !strings.HasPrefix(strings.ToLower(k), "content-") {
+			header[k] = v
+		}
+	}
+
+	for k, v := range inner.Header {
+		header[k] = v
+	}
+
+	m.message = &mail.Message{
+		Header: header,
+		Body:   inner.Body,
+	}
+
+	return nil
+}
+
+//Reads whole body of the entity and removes its transfer encoding
+func readEntityPart(entity []byte) (string, map[string]string, []byte, error) {
+	part, err := mail.ReadMessage(bytes.NewReader(normalizeCRLF(entity)))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	mediatype, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	body, err := ioutil.ReadAll(transferDecoder(part.Header.Get("Content-Transfer-Encoding"), part.Body))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return mediatype, params, body, nil
+}
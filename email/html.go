@@ -0,0 +1,463 @@
+package email
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//Builds URL of the attachment referenced by cid: link
+type AttachmentURLFunc func(contentID string) string
+
+var (
+	//elements removed together with their content
+	htmlDropped = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Head: true, atom.Title: true,
+		atom.Iframe: true, atom.Frame: true, atom.Frameset: true, atom.Object: true,
+		atom.Embed: true, atom.Applet: true, atom.Noscript: true, atom.Template: true,
+		atom.Svg: true, atom.Math: true, atom.Input: true, atom.Button: true,
+		atom.Select: true, atom.Textarea: true, atom.Link: true, atom.Meta: true,
+		atom.Base: true, atom.Audio: true, atom.Video: true,
+	}
+
+	htmlAllowed = map[atom.Atom]bool{
+		atom.A: true, atom.Abbr: true, atom.B: true, atom.Blockquote: true, atom.Br: true,
+		atom.Caption: true, atom.Center: true, atom.Cite: true, atom.Code: true, atom.Col: true,
+		atom.Colgroup: true, atom.Dd: true, atom.Del: true, atom.Div: true, atom.Dl: true,
+		atom.Dt: true, atom.Em: true, atom.Font: true, atom.H1: true, atom.H2: true,
+		atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true,
+		atom.I: true, atom.Img: true, atom.Ins: true, atom.Kbd: true, atom.Li: true,
+		atom.Ol: true, atom.P: true, atom.Pre: true, atom.Q: true, atom.S: true,
+		atom.Small: true, atom.Span: true, atom.Strike: true, atom.Strong: true, atom.Sub: true,
+		atom.Sup: true, atom.Table: true, atom.Tbody: true, atom.Td: true, atom.Tfoot: true,
+		atom.Th: true, atom.Thead: true, atom.Tr: true, atom.Tt: true, atom.U: true,
+		atom.Ul: true,
+	}
+
+	htmlAllowedAttributes = map[string]bool{
+		"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true,
+		"cellspacing": true, "class": true, "color": true, "colspan": true, "dir": true,
+		"face": true, "height": true, "lang": true, "rowspan": true, "size": true,
+		"start": true, "style": true, "title": true, "type": true, "valign": true,
+		"width": true,
+	}
+
+	//block elements separated by new lines in plain text
+	htmlBlocks = map[atom.Atom]bool{
+		atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Center: true,
+		atom.Div: true, atom.Dl: true, atom.Dd: true, atom.Dt: true, atom.Footer: true,
+		atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+		atom.H6: true, atom.Header: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+		atom.Section: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+	}
+
+	//layout and text properties kept in style attribute, others could load remote resources or cover the page
+	styleProperties = map[string]bool{
+		"color": true, "background-color": true, "font-family": true, "font-size": true,
+		"font-style": true, "font-weight": true, "text-align": true, "text-decoration": true,
+		"text-transform": true, "line-height": true, "letter-spacing": true, "vertical-align": true,
+		"white-space": true, "width": true, "height": true, "max-width": true,
+		"margin": true, "margin-top": true, "margin-right": true, "margin-bottom": true, "margin-left": true,
+		"padding": true, "padding-top": true, "padding-right": true, "padding-bottom": true, "padding-left": true,
+		"border": true, "border-top": true, "border-right": true, "border-bottom": true, "border-left": true,
+		"border-color": true, "border-style": true, "border-width": true, "border-collapse": true,
+		"list-style-type": true,
+	}
+
+	//values without escapes, comments and functions other than rgb colors, so url() could not be hidden
+	styleValue = regexp.MustCompile(`^(?:[a-zA-Z0-9#%.,'" !-]|rgba?\([0-9., %]*\))*$`)
+	whitespace = regexp.MustCompile(`[ \t\r\n\f]+`)
+	emptyLines = regexp.MustCompile(`\n{3,}`)
+)
+
+//Removes scripts, event handlers and remote resources from HTML, cid: images are linked with attachmentURL
+func SanitizeHTML(data []byte, attachmentURL AttachmentURLFunc) ([]byte, error) {
+	nodes, err := parseHTMLBody(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+
+	for _, n := range nodes {
+		for _, s := range sanitizeNode(n, attachmentURL) {
+			if err := html.Render(b, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+//Content of the document body, fragments without body are returned as they are
+func parseHTMLBody(data []byte) ([]*html.Node, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+
+	nodes := make([]*html.Node, 0)
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+
+	return nodes, nil
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if f := findElement(c, a); f != nil {
+			return f
+		}
+	}
+
+	return nil
+}
+
+//Returns detached copies of the allowed nodes, unknown elements are replaced with their children
+func sanitizeNode(n *html.Node, attachmentURL AttachmentURLFunc) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+
+	if htmlDropped[n.DataAtom] {
+		return nil
+	}
+
+	children := make([]*html.Node, 0)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, sanitizeNode(c, attachmentURL)...)
+	}
+
+	if !htmlAllowed[n.DataAtom] {
+		return children
+	}
+
+	clean := &html.Node{
+		Type:     html.ElementNode,
+		Data:     n.Data,
+		DataAtom: n.DataAtom,
+		Attr:     sanitizeAttributes(n, attachmentURL),
+	}
+
+	for _, c := range children {
+		clean.AppendChild(c)
+	}
+
+	return []*html.Node{clean}
+}
+
+func sanitizeAttributes(n *html.Node, attachmentURL AttachmentURLFunc) []html.Attribute {
+	attrs := make([]html.Attribute, 0)
+
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		value := strings.TrimSpace(a.Val)
+
+		switch {
+		case len(a.Namespace) > 0:
+		case key == "href" && n.DataAtom == atom.A:
+			if safeLink(value) {
+				attrs = append(attrs,
+					html.Attribute{Key: "href", Val: value},
+					html.Attribute{Key: "target", Val: "_blank"},
+					html.Attribute{Key: "rel", Val: "noopener noreferrer"},
+				)
+			}
+		case key == "src" && n.DataAtom == atom.Img:
+			attrs = append(attrs, imageSource(value, attachmentURL))
+		case key == "style":
+			if style := sanitizeStyle(value); len(style) > 0 {
+				attrs = append(attrs, html.Attribute{Key: key, Val: style})
+			}
+		case htmlAllowedAttributes[key]:
+			attrs = append(attrs, html.Attribute{Key: key, Val: value})
+		}
+	}
+
+	return attrs
+}
+
+//Keeps declarations of allowed properties with plain values
+func sanitizeStyle(style string) string {
+	declarations := make([]string, 0)
+
+	for _, d := range strings.Split(style, ";") {
+		i := strings.Index(d, ":")
+		if i < 0 {
+			continue
+		}
+
+		property := strings.ToLower(strings.TrimSpace(d[:i]))
+		value := strings.TrimSpace(d[i+1:])
+
+		if !styleProperties[property] || len(value) == 0 || !styleValue.MatchString(value) {
+			continue
+		}
+
+		declarations = append(declarations, property+":"+value)
+	}
+
+	return strings.Join(declarations, ";")
+}
+
+func safeLink(link string) bool {
+	l := strings.ToLower(link)
+
+	for _, scheme := range []string{"http://", "https://", "mailto:", "tel:", "#"} {
+		if strings.HasPrefix(l, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Remote images are blocked because they reveal when the message was read
+func imageSource(src string, attachmentURL AttachmentURLFunc) html.Attribute {
+	l := strings.ToLower(src)
+
+	switch {
+	case strings.HasPrefix(l, "cid:"):
+		if attachmentURL != nil {
+			return html.Attribute{Key: "src", Val: attachmentURL(strings.Trim(src[4:], "<> "))}
+		}
+		return html.Attribute{Key: "src", Val: src}
+	case strings.HasPrefix(l, "data:image/") && !strings.HasPrefix(l, "data:image/svg"):
+		return html.Attribute{Key: "src", Val: src}
+	}
+
+	return html.Attribute{Key: "data-blocked-src", Val: src}
+}
+
+//Converts HTML to plain text keeping links and list items
+func HTMLToText(data []byte) ([]byte, error) {
+	nodes, err := parseHTMLBody(data)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &textWriter{}
+
+	for _, n := range nodes {
+		w.node(n)
+	}
+
+	text := emptyLines.ReplaceAllString(w.String(), "\n\n")
+
+	return []byte(strings.TrimSpace(text)), nil
+}
+
+type textWriter struct {
+	strings.Builder
+	pre   int
+	quote int
+	lists []int
+	space bool
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode, html.DocumentNode:
+	default:
+		return
+	}
+
+	if htmlDropped[n.DataAtom] {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		w.newline()
+		return
+	case atom.Hr:
+		w.block()
+		w.write("---")
+		w.block()
+		return
+	case atom.Img:
+		if alt := attribute(n, "alt"); len(strings.TrimSpace(alt)) > 0 {
+			w.text("[" + alt + "]")
+		}
+		return
+	case atom.A:
+		w.link(n)
+		return
+	case atom.Li:
+		w.item()
+	case atom.Td, atom.Th:
+		if n.PrevSibling != nil {
+			w.write(" ")
+		}
+	case atom.Pre:
+		w.pre++
+		defer func() { w.pre-- }()
+	case atom.Blockquote:
+		w.quote++
+		defer func() { w.quote-- }()
+	case atom.Ul:
+		w.lists = append(w.lists, 0)
+		defer func() { w.lists = w.lists[:len(w.lists)-1] }()
+	case atom.Ol:
+		w.lists = append(w.lists, 1)
+		defer func() { w.lists = w.lists[:len(w.lists)-1] }()
+	}
+
+	//nested lists continue the outer list without blank lines
+	nested := (n.DataAtom == atom.Ul || n.DataAtom == atom.Ol) && len(w.lists) > 1
+
+	if htmlBlocks[n.DataAtom] && !nested {
+		w.block()
+		defer w.block()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+
+	if n.DataAtom == atom.Li && !w.atLineStart() {
+		w.newline()
+	}
+}
+
+func (w *textWriter) link(n *html.Node) {
+	start := w.Len()
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+
+	href := strings.TrimSpace(attribute(n, "href"))
+	if len(href) == 0 || strings.HasPrefix(href, "#") {
+		return
+	}
+
+	label := strings.TrimSpace(w.String()[start:])
+	target := strings.TrimPrefix(href, "mailto:")
+
+	if label != href && label != target {
+		w.write(" (" + href + ")")
+	}
+}
+
+func (w *textWriter) item() {
+	if !w.atLineStart() {
+		w.newline()
+	}
+
+	depth := len(w.lists)
+	if depth == 0 {
+		w.write("- ")
+		return
+	}
+
+	w.write(strings.Repeat("  ", depth-1))
+
+	if n := w.lists[depth-1]; n > 0 {
+		w.write(strconv.Itoa(n) + ". ")
+		w.lists[depth-1]++
+		return
+	}
+
+	w.write("- ")
+}
+
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				w.newline()
+			}
+			w.write(line)
+		}
+		return
+	}
+
+	s = whitespace.ReplaceAllString(s, " ")
+	if s == " " {
+		w.space = true
+		return
+	}
+
+	if strings.HasPrefix(s, " ") {
+		w.space = true
+		s = s[1:]
+	}
+
+	trailing := strings.HasSuffix(s, " ")
+	w.write(strings.TrimSuffix(s, " "))
+	w.space = trailing
+}
+
+func (w *textWriter) write(s string) {
+	if len(s) == 0 {
+		return
+	}
+
+	if w.atLineStart() {
+		w.space = false
+		if w.quote > 0 {
+			w.WriteString(strings.Repeat("> ", w.quote))
+		}
+	} else if w.space {
+		w.WriteString(" ")
+	}
+
+	w.space = false
+	w.WriteString(s)
+}
+
+func (w *textWriter) newline() {
+	w.space = false
+	w.WriteString("\n")
+}
+
+func (w *textWriter) block() {
+	if w.Len() == 0 {
+		return
+	}
+
+	if !w.atLineStart() {
+		w.newline()
+	}
+
+	if !strings.HasSuffix(w.String(), "\n\n") {
+		w.newline()
+	}
+}
+
+func (w *textWriter) atLineStart() bool {
+	return w.Len() == 0 || strings.HasSuffix(w.String(), "\n")
+}
+
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+
+	return ""
+}
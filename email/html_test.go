@@ -0,0 +1,107 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	dirty := `<html><head><title>T</title><style>body{}</style></head><body>` +
+		`<p onclick="steal()" style="color:red">Hello <script>alert(1)</script><b>world</b></p>` +
+		`<a href="javascript:alert(1)">bad</a><a href="https://golang.org">good</a>` +
+		`<img src="https://tracker.example.com/pixel.gif"><img src="cid:logo@golang.org">` +
+		`<div style="background:url(https://tracker.example.com)">bg</div>` +
+		`<form action="/x"><input name="password">kept</form><iframe src="https://golang.org"></iframe>` +
+		`</body></html>`
+
+	clean, err := SanitizeHTML([]byte(dirty), func(cid string) string {
+		return "/attachment?cid=" + cid
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `<p style="color:red">Hello <b>world</b></p>`+
+		`<a>bad</a><a href="https://golang.org" target="_blank" rel="noopener noreferrer">good</a>`+
+		`<img data-blocked-src="https://tracker.example.com/pixel.gif"/><img src="/attachment?cid=logo@golang.org"/>`+
+		`<div>bg</div>kept`, string(clean))
+}
+
+func TestHTMLToText(t *testing.T) {
+	doc := `<html><head><style>p{}</style></head><body>` +
+		`<h1>Title</h1><p>First   paragraph with a <a href="https://golang.org">link</a> ` +
+		`and <a href="mailto:gopher@golang.org">gopher@golang.org</a>.</p>` +
+		`<ul><li>one</li><li>two<ol><li>nested</li><li>second</li></ol></li></ul>` +
+		`<blockquote><p>Quoted</p></blockquote><p>Line<br>break</p>` +
+		`</body></html>`
+
+	text, err := HTMLToText([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Title\n\n"+
+		"First paragraph with a link (https://golang.org) and gopher@golang.org.\n\n"+
+		"- one\n- two\n  1. nested\n  2. second\n\n"+
+		"> Quoted\n\n"+
+		"Line\nbreak", string(text))
+}
+
+func TestParseBodyHTMLFormat(t *testing.T) {
+	raw := "From: sender.gopher@golang.org\r\n" +
+		"Subject: Html\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n" +
+		"\r\n" +
+		"<p>Hi<script>alert(1)</script></p>\r\n"
+
+	mi := newTestMessageInfo(t, []byte(raw))
+
+	options, err := HTMLFormatOptions(HTMLSanitized, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mi.ParseBody(options...); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.True(t, mi.Contents()[0].HTMLType)
+		assert.Equal(t, "<p>Hi</p>\n", string(mi.Contents()[0].Data))
+	}
+
+	mi = newTestMessageInfo(t, []byte(raw))
+
+	if err := mi.ParseBody(WithHTMLText()); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.False(t, mi.Contents()[0].HTMLType)
+		assert.Equal(t, "Hi", string(mi.Contents()[0].Data))
+	}
+
+	_, err = HTMLFormatOptions("pdf", nil)
+	assert.Equal(t, ErrHTMLFormat, err)
+}
+
+func TestSanitizeStyle(t *testing.T) {
+	assert.Equal(t, "color:red;font-size:12px;background-color:rgb(1, 2, 3)", sanitizeStyle("COLOR: red; font-size:12px;background-color: rgb(1, 2, 3);"))
+
+	for style, expected := range map[string]string{
+		"background:url(https://tracker.example.com)":                        "",
+		`background-color: u\72 l(https://tracker.example.com)`:              "",
+		"color: red; background-color: url/**/(https://tracker.example.com)": "color:red",
+		"width: expression(alert(1))":                                        "",
+		"position: fixed":                                                    "",
+		"behavior: url(x.htc)":                                               "",
+	} {
+		assert.Equal(t, expected, sanitizeStyle(style), style)
+	}
+
+	clean, err := SanitizeHTML([]byte(`<p style="background-color: &#117;rl(https://tracker.example.com)">x</p>`), nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "<p>x</p>", string(clean))
+	}
+}
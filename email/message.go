@@ -14,23 +14,37 @@ import (
 	"net/textproto"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
 	SenderHeader    = "From:"
 	RecipientHeader = "To:"
+	CcHeader        = "Cc:"
+	BccHeader       = "Bcc:"
 	SubjectHeader   = "Subject:"
+	MessageIDHeader = "Message-ID:"
+
+	ListUnsubscribeHeader     = "List-Unsubscribe:"
+	ListUnsubscribePostHeader = "List-Unsubscribe-Post:"
 )
 
 var (
 	ErrSubjectExist = errors.New("Subject of the message is already exists")
 	ErrNoRecipient  = errors.New("No recipient")
+	ErrSMIMEAndPGP  = errors.New("Message could not be protected with both S/MIME and PGP")
 )
 
 type Message struct {
-	header   textproto.MIMEHeader
-	files    []*File
-	contents []*Content
+	header       textproto.MIMEHeader
+	files        []*File
+	contents     []*Content
+	smimeSign    bool
+	smimeEncrypt bool
+	pgpSign      bool
+	pgpEncrypt   bool
+	calendar     *Calendar
+	delivered    map[string]bool
 }
 
 func NewMessage() *Message {
@@ -53,6 +67,15 @@ func (m *Message) AddRecipient(recipient string) {
 	m.header.Add(RecipientHeader, recipient)
 }
 
+func (m *Message) AddCc(recipient string) {
+	m.header.Add(CcHeader, recipient)
+}
+
+//Blind carbon copy recipient, used only as envelope recipient and never written in the header
+func (m *Message) AddBcc(recipient string) {
+	m.header.Add(BccHeader, recipient)
+}
+
 func (m *Message) SetSubject(subject string) {
 	m.header.Set(SubjectHeader, subject)
 }
@@ -65,6 +88,35 @@ func (m *Message) AttachFile(file *File) {
 	m.files = append(m.files, file)
 }
 
+//Signs message with the account S/MIME certificate when sending
+func (m *Message) SetSMIMESign(sign bool) {
+	m.smimeSign = sign
+}
+
+//Encrypts message for every recipient with S/MIME when sending
+func (m *Message) SetSMIMEEncrypt(encrypt bool) {
+	m.smimeEncrypt = encrypt
+}
+
+//Signs message with the account PGP key when sending
+func (m *Message) SetPGPSign(sign bool) {
+	m.pgpSign = sign
+}
+
+//Encrypts message for every recipient with PGP/MIME when sending
+func (m *Message) SetPGPEncrypt(encrypt bool) {
+	m.pgpEncrypt = encrypt
+}
+
+//Adds calendar invitation as text/calendar alternative part
+func (m *Message) SetCalendar(calendar *Calendar) {
+	m.calendar = calendar
+}
+
+func (m *Message) Calendar() *Calendar {
+	return m.calendar
+}
+
 func (m *Message) values(headerType string) []string {
 	return m.header.Values(headerType)
 }
@@ -74,6 +126,53 @@ func (m *Message) Recipients() string {
 	return strings.Join(r, ",")
 }
 
+func (m *Message) CcRecipients() string {
+	r := m.values(CcHeader)
+	return strings.Join(r, ",")
+}
+
+func (m *Message) BccRecipients() string {
+	r := m.values(BccHeader)
+	return strings.Join(r, ",")
+}
+
+//Recipients which already got the message, e.g. before the failed attempt.
+//They are left out of the envelope while the headers are kept
+func (m *Message) SetDelivered(recipients []string) {
+	m.delivered = make(map[string]bool, len(recipients))
+
+	for _, r := range recipients {
+		m.delivered[strings.ToLower(strings.TrimSpace(r))] = true
+	}
+}
+
+//Addresses the message is delivered to, including Cc and Bcc recipients
+func (m *Message) EnvelopeRecipients() []string {
+	recipients := make([]string, 0)
+
+	add := func(address string) {
+		if !m.delivered[strings.ToLower(address)] {
+			recipients = append(recipients, address)
+		}
+	}
+
+	for _, h := range []string{RecipientHeader, CcHeader, BccHeader} {
+		for _, v := range m.values(h) {
+			list, err := mail.ParseAddressList(v)
+			if err != nil {
+				add(strings.TrimSpace(v))
+				continue
+			}
+
+			for _, a := range list {
+				add(a.Address)
+			}
+		}
+	}
+
+	return recipients
+}
+
 func (m *Message) Sender() string {
 	return m.header.Get(SenderHeader)
 }
@@ -100,6 +199,30 @@ func (m *Message) Subject() string {
 	return m.header.Get(SubjectHeader)
 }
 
+//Sets Message-ID, e.g. to keep ID of the message queued before restart
+func (m *Message) SetMessageID(id string) {
+	m.header.Set(MessageIDHeader, "<"+strings.Trim(id, "<>")+">")
+}
+
+//Message-ID without angle brackets, generated with the sender domain on first use
+func (m *Message) MessageID() string {
+	if id := m.header.Get(MessageIDHeader); len(id) > 0 {
+		return strings.Trim(id, "<>")
+	}
+
+	domain := "localhost"
+	if s, err := m.parseSender(); err == nil {
+		if at := strings.LastIndex(s.Address, "@"); at >= 0 {
+			domain = s.Address[at+1:]
+		}
+	}
+
+	id := fmt.Sprintf("%s@%s", newBoundary()[:32], domain)
+	m.header.Set(MessageIDHeader, "<"+id+">")
+
+	return id
+}
+
 func (m *Message) parseSender() (*mail.Address, error) {
 	s := m.Sender()
 	return mail.ParseAddress(s)
@@ -110,6 +233,10 @@ func (m *Message) encode(value []byte) string {
 }
 
 func (m *Message) boundary() string {
+	return newBoundary()
+}
+
+func newBoundary() string {
 	var buf [30]byte
 	_, err := io.ReadFull(rand.Reader, buf[:])
 	if err != nil {
@@ -163,14 +290,14 @@ func (m *Message) write() (*bytes.Buffer, error) {
 	}
 
 	if m.IsFile() {
-		text.PrintfLine("Content-Type: multipart/mixed; boundary=%s", boundary)
+		text.PrintfLine("Content-Type: multipart/mixed; boundary=%s\r\n", boundary)
 
 		if err := m.mixedBody(boundary, b); err != nil {
 			return nil, err
 		}
 
 	} else {
-		text.PrintfLine("Content-Type: multipart/alternative; boundary=%s", boundary)
+		text.PrintfLine("Content-Type: multipart/alternative; boundary=%s\r\n", boundary)
 
 		if err := m.alternativeBody(boundary, b); err != nil {
 			return nil, err
@@ -183,13 +310,23 @@ func (m *Message) write() (*bytes.Buffer, error) {
 func (m *Message) writeHeader(writer *textproto.Writer) error {
 	writer.PrintfLine("From: %s", m.Sender())
 	writer.PrintfLine("To: %s", m.Recipients())
-	writer.PrintfLine("Subject: %s", m.Subject())
-	writer.PrintfLine("MIME-Version: 1.0")
 
-	if _, err := fmt.Fprint(writer.W, "\r\n"); err != nil {
-		return err
+	if cc := m.CcRecipients(); len(cc) > 0 {
+		writer.PrintfLine("Cc: %s", cc)
 	}
 
+	//subject is encoded when it has non-ASCII or control characters, so it could not break the header
+	writer.PrintfLine("Subject: %s", mime.QEncoding.Encode("utf-8", m.Subject()))
+	writer.PrintfLine("Date: %s", time.Now().Format(time.RFC1123Z))
+	writer.PrintfLine("Message-ID: <%s>", m.MessageID())
+
+	if lu := m.header.Get(ListUnsubscribeHeader); len(lu) > 0 {
+		writer.PrintfLine("List-Unsubscribe: %s", lu)
+		writer.PrintfLine("List-Unsubscribe-Post: %s", m.header.Get(ListUnsubscribePostHeader))
+	}
+
+	writer.PrintfLine("MIME-Version: 1.0")
+
 	return nil
 }
 
@@ -200,7 +337,7 @@ func (m *Message) mixedBody(boundary string, writer io.Writer) error {
 	h := make(textproto.MIMEHeader)
 
 	alternativeBoundary := m.boundary()
-	h.Set("Content-Type", fmt.Sprintf("mutlipart/alternative; boundary=%s", alternativeBoundary))
+	h.Set("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%s", alternativeBoundary))
 
 	w, err := mw.CreatePart(h)
 	if err != nil {
@@ -270,20 +407,75 @@ func (m *Message) writeContent(boundary string, writer io.Writer) (*multipart.Wr
 
 	}
 
+	if m.calendar != nil {
+		if err := m.writeCalendar(mw); err != nil {
+			return nil, err
+		}
+	}
+
 	return mw, nil
 }
 
+func (m *Message) writeCalendar(writer *multipart.Writer) error {
+	h := make(textproto.MIMEHeader)
+
+	h.Set("Content-Type", fmt.Sprintf("%s; charset=UTF-8; method=%s", CalendarMimeType, m.calendar.Method))
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	w, err := writer.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, m.encode(m.calendarData()))
+
+	return err
+}
+
+//Calendar data with the sender as organizer of events which does not have one
+func (m *Message) calendarData() []byte {
+	c := *m.calendar
+	c.Events = make([]*Event, len(m.calendar.Events))
+
+	sender, err := m.parseSender()
+
+	for i, e := range m.calendar.Events {
+		if e.Organizer == nil && err == nil && c.Method != CalendarReply {
+			event := *e
+			event.Organizer = &Attendee{
+				Name:    sender.Name,
+				Address: sender.Address,
+			}
+			e = &event
+		}
+
+		c.Events[i] = e
+	}
+
+	return c.Bytes()
+}
+
 func (m *Message) writeFile(writer *multipart.Writer) error {
 	for _, file := range m.files {
 
-		ext := filepath.Ext(file.Name)
-		mimetype := mime.TypeByExtension(ext)
+		mimetype := file.ContentType
+		if len(mimetype) == 0 {
+			mimetype = mime.TypeByExtension(filepath.Ext(file.Name))
+		}
+
+		if len(mimetype) == 0 {
+			mimetype = "application/octet-stream"
+		}
 
 		h := make(textproto.MIMEHeader)
 
 		h.Set("Content-Type", mimetype)
 		h.Set("Content-Transfer-Encoding", "base64")
-		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename==?UTF-8?B?%s?=\r\n", m.encode([]byte(file.Name))))
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", mime.BEncoding.Encode("UTF-8", file.Name)))
+
+		if len(file.ContentID) > 0 {
+			h.Set("Content-ID", fmt.Sprintf("<%s>", strings.Trim(file.ContentID, "<>")))
+		}
 
 		encode := m.encode(file.Data)
 		b := bytes.NewBufferString(encode)
@@ -2,10 +2,9 @@ package email
 
 import (
 	"bytes"
-	"encoding/base64"
-	"errors"
+	"crypto/x509"
 	"io"
-	"mime"
+	"log"
 	"mime/multipart"
 	"net/mail"
 	"net/textproto"
@@ -13,13 +12,29 @@ import (
 	"time"
 
 	_ "github.com/paulrosania/go-charset/data"
+	"golang.org/x/crypto/openpgp"
 )
 
 type MessageInfo struct {
-	reader   *textproto.Reader
-	message  *mail.Message
-	files    []*File
-	contents []*Content
+	reader         *textproto.Reader
+	message        *mail.Message
+	raw            []byte
+	files          []*File
+	contents       []*Content
+	authentication *Authentication
+	smime          *SMIMEStatus
+	smimeIdentity  *SMIMEIdentity
+	smimeRoots     *x509.CertPool
+	pgp            *PGPStatus
+	pgpKeyring     openpgp.EntityList
+	calendar       *Calendar
+	root           *Part
+	threadID       string
+	bounce         *Bounce
+	filter         *FilterConfig
+	messages       []*MessageInfo
+	depth          int
+	options        []ParseOption
 }
 
 type Stat struct {
@@ -29,8 +44,10 @@ type Stat struct {
 }
 
 type File struct {
-	Name string `json:"name"`
-	Data []byte `json:"data"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Data        []byte `json:"data"`
 }
 
 type Content struct {
@@ -42,6 +59,22 @@ func NewMessageInfo(reader *textproto.Reader) *MessageInfo {
 	return newMessageInfo(reader)
 }
 
+//Message info of raw message e.g. stored after it was read from the server
+func ParseMessageInfo(raw []byte) (*MessageInfo, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageInfo{
+		message:  message,
+		raw:      raw,
+		files:    make([]*File, 0),
+		contents: make([]*Content, 0),
+		messages: make([]*MessageInfo, 0),
+	}, nil
+}
+
 func newMessageInfo(reader *textproto.Reader) *MessageInfo {
 	line, err := reader.ReadDotBytes()
 	if err != nil {
@@ -58,8 +91,10 @@ func newMessageInfo(reader *textproto.Reader) *MessageInfo {
 	m := &MessageInfo{
 		reader:   reader,
 		message:  message,
+		raw:      line,
 		files:    make([]*File, 0),
 		contents: make([]*Content, 0),
+		messages: make([]*MessageInfo, 0),
 	}
 
 	return m
@@ -93,6 +128,16 @@ func (m *MessageInfo) Date() string {
 	return hdt.Format(time.RFC3339Nano)
 }
 
+//Date from the header, zero when the message has no valid date
+func (m *MessageInfo) DateTime() time.Time {
+	hdt, err := m.message.Header.Date()
+	if err != nil {
+		return time.Time{}
+	}
+
+	return hdt
+}
+
 func (m *MessageInfo) Subject() string {
 	s := m.message.Header.Get("Subject")
 
@@ -109,168 +154,303 @@ func (m *MessageInfo) MessageId() string {
 	return strings.Trim(messageid, "<>")
 }
 
-func (m *MessageInfo) ParseBody() error {
-	ct := m.message.Header.Get("Content-Type")
-
-	reader, err := m.bodyReader(m.message.Body, ct)
-	if err != nil {
-		return err
+//First value of the header field with decoded encoded words
+func (m *MessageInfo) Header(name string) string {
+	v := m.HeaderValues(name)
+	if len(v) == 0 {
+		return ""
 	}
 
-	for {
-		part, err := reader.NextPart()
-		if err != nil {
-			if err != io.EOF {
-				return err
-			}
-			break
-		}
+	return v[0]
+}
 
-		if err := m.writeContent(part); err != nil {
-			return err
-		}
+//All values of the header field with decoded encoded words
+func (m *MessageInfo) HeaderValues(name string) []string {
+	values := make([]string, 0)
 
-		if err := m.writeFile(part); err != nil {
-			return err
+	for _, v := range m.message.Header[textproto.CanonicalMIMEHeaderKey(name)] {
+		if d, err := decode(v); err == nil {
+			v = d
 		}
+
+		values = append(values, v)
 	}
 
-	return nil
+	return values
 }
 
-func (m *MessageInfo) Contents() []*Content {
-	return m.contents
+//Every header field of the message with decoded values
+func (m *MessageInfo) Headers() map[string][]string {
+	headers := make(map[string][]string, len(m.message.Header))
+
+	for name := range m.message.Header {
+		headers[name] = m.HeaderValues(name)
+	}
+
+	return headers
 }
 
-func (m *MessageInfo) Files() []*File {
-	return m.files
+func (m *MessageInfo) To() []*mail.Address {
+	return m.addressList("To")
 }
 
-func (m *MessageInfo) writeContent(part *multipart.Part) error {
-	if len(part.FileName()) > 0 {
-		return nil
+func (m *MessageInfo) Cc() []*mail.Address {
+	return m.addressList("Cc")
+}
+
+func (m *MessageInfo) ReplyTo() []*mail.Address {
+	return m.addressList("Reply-To")
+}
+
+//Message identifiers from In-Reply-To header
+func (m *MessageInfo) InReplyTo() []string {
+	return messageIDs(m.message.Header.Get("In-Reply-To"))
+}
+
+//Message identifiers from References header, the oldest first
+func (m *MessageInfo) References() []string {
+	return messageIDs(strings.Join(m.message.Header["References"], " "))
+}
+
+//Mailing list identifier from List-Id header (RFC 2919)
+func (m *MessageInfo) ListID() string {
+	id := m.Header("List-Id")
+
+	if start := strings.LastIndex(id, "<"); start >= 0 {
+		if end := strings.Index(id[start:], ">"); end > 0 {
+			return id[start+1 : start+end]
+		}
 	}
 
-	ct := part.Header.Get("Content-Type")
+	return strings.TrimSpace(id)
+}
 
-	reader, err := m.bodyReader(part, ct)
-	if err != nil {
-		return m.putContent(part)
+func (m *MessageInfo) addressList(name string) []*mail.Address {
+	addresses := make([]*mail.Address, 0)
+	parser := &mail.AddressParser{WordDecoder: wordDecoder()}
+
+	for _, v := range m.message.Header[name] {
+		list, err := parser.ParseList(v)
+		if err == nil {
+			addresses = append(addresses, list...)
+			continue
+		}
+
+		//malformed list is parsed address by address so the valid ones are kept
+		for _, a := range strings.Split(v, ",") {
+			a = strings.TrimSpace(a)
+			if len(a) == 0 {
+				continue
+			}
+
+			address, err := parser.Parse(a)
+			if err != nil {
+				address = &mail.Address{Address: a}
+			}
+
+			addresses = append(addresses, address)
+		}
 	}
 
+	return addresses
+}
+
+//Extracts identifiers in angle brackets e.g. References: <a@b> <c@d>
+func messageIDs(v string) []string {
+	ids := make([]string, 0)
+
 	for {
-		part, err := reader.NextPart()
-		if err != nil {
-			if err != io.EOF {
-				return err
-			}
+		start := strings.Index(v, "<")
+		if start < 0 {
 			break
 		}
 
-		if err := m.putContent(part); err != nil {
-			return nil
+		end := strings.Index(v[start:], ">")
+		if end < 0 {
+			break
 		}
 
+		if id := strings.TrimSpace(v[start+1 : start+end]); len(id) > 0 {
+			ids = append(ids, id)
+		}
+
+		v = v[start+end+1:]
 	}
 
-	return nil
+	//identifiers sent without brackets
+	if len(ids) == 0 {
+		for _, f := range strings.Fields(v) {
+			ids = append(ids, f)
+		}
+	}
+
+	return ids
 }
 
-func (m *MessageInfo) putContent(part *multipart.Part) error {
-	ctp := part.Header.Get("Content-Type")
+//Raw message as it was read from the server
+func (m *MessageInfo) Raw() []byte {
+	return m.raw
+}
 
-	mediatype, params, err := mime.ParseMediaType(ctp)
-	if err != nil {
-		return nil
+//Verifies DKIM, SPF and DMARC of the message
+func (m *MessageInfo) Authenticate(resolver Resolver) *Authentication {
+	m.authentication = Authenticate(m.raw, m.message.Header, resolver)
+	return m.authentication
+}
+
+//Result of the last Authenticate call, nil when message was not verified
+func (m *MessageInfo) Authentication() *Authentication {
+	return m.authentication
+}
+
+func (m *MessageInfo) ParseBody(options ...ParseOption) error {
+	m.options = options
+
+	o := &parseOptions{}
+	for _, option := range options {
+		option(o)
 	}
 
-	charset := params["charset"]
+	if err := m.unwrapEntity(); err != nil {
+		return err
+	}
 
-	c := &Content{}
+	header := textproto.MIMEHeader(m.message.Header)
 
-	dec, err := m.decodePart(part)
+	root, err := parsePart(header, m.message.Body, 0)
 	if err != nil {
 		return err
 	}
 
-	if strings.Contains(mediatype, "text/html") {
-		c.HTMLType = true
-	} else {
+	m.root = root
+	m.files = make([]*File, 0)
+	m.contents = make([]*Content, 0)
+	m.messages = make([]*MessageInfo, 0)
 
-		r := bytes.NewReader(dec)
+	if err := root.Walk(m.putPart); err != nil {
+		return err
+	}
 
-		dec, err = decodeCharset(strings.ToLower(charset), r)
-		if err != nil {
-			return err
-		}
+	m.detectBounce()
+	m.applyHTMLOptions(o)
 
-	}
+	return nil
+}
 
-	c.Data = dec
+//Root of the message MIME tree, nil before ParseBody
+func (m *MessageInfo) PartTree() *Part {
+	return m.root
+}
 
-	m.contents = append(m.contents, c)
+func (m *MessageInfo) Contents() []*Content {
+	return m.contents
+}
 
-	return nil
+func (m *MessageInfo) Files() []*File {
+	return m.files
 }
 
-func (m *MessageInfo) writeFile(part *multipart.Part) error {
-	if !(len(part.FileName()) > 0) {
+//Calendar invitation or iTIP reply carried by the message, nil when there is none
+func (m *MessageInfo) Calendar() *Calendar {
+	return m.calendar
+}
+
+func (m *MessageInfo) putPart(part *Part) error {
+	if part.IsMultipart() {
 		return nil
 	}
 
-	filedata, err := m.decodePart(part)
-	if err != nil {
-		return err
+	if isTNEF(part.ContentType, part.FileName) {
+		return m.putTNEF(part)
 	}
 
-	filename, err := decode(part.FileName())
+	if isEmbeddedMessage(part.ContentType) {
+		return m.putMessage(part)
+	}
+
+	if part.IsAttachment() {
+		return m.putFile(part)
+	}
+
+	if part.ContentType == CalendarMimeType {
+		m.putCalendar(part.Data)
+		return nil
+	}
+
+	return m.putContent(part)
+}
+
+func (m *MessageInfo) putContent(part *Part) error {
+	c := &Content{
+		HTMLType: part.ContentType == "text/html",
+	}
+
+	charset := part.Charset
+	if c.HTMLType && len(charset) == 0 {
+		charset = sniffHTMLCharset(part.Data)
+	}
+
+	dec, err := toUTF8(charset, part.Data)
 	if err != nil {
-		filename = part.FileName()
+		//unknown charset should not lose the text
+		log.Printf("Could not convert %s content of message %s due to: %s", charset, m.MessageId(), err)
+		dec = part.Data
+	} else if c.HTMLType {
+		dec = rewriteHTMLCharset(dec)
 	}
 
+	c.Data = dec
+
+	m.contents = append(m.contents, c)
+
+	return nil
+}
+
+func (m *MessageInfo) putFile(part *Part) error {
 	file := &File{
-		Name: filename,
-		Data: filedata,
+		Name:        part.name(len(m.files) + 1),
+		ContentType: part.ContentType,
+		ContentID:   part.ContentID,
+		Data:        part.Data,
 	}
 
 	m.files = append(m.files, file)
 
-	return nil
+	if isCalendar(part.ContentType, file.Name) {
+		m.putCalendar(part.Data)
+	}
 
+	return nil
 }
 
-func (m *MessageInfo) isMultipart(mediatype string) bool {
-	if !strings.HasPrefix(mediatype, "multipart") {
-		return false
+func (m *MessageInfo) putCalendar(data []byte) {
+	//the first calendar wins, attached .ics usually repeats the alternative part
+	if m.calendar != nil {
+		return
 	}
-	return true
-}
 
-func (m *MessageInfo) bodyReader(r io.Reader, v string) (*multipart.Reader, error) {
-	mediatype, params, err := mime.ParseMediaType(v)
+	c, err := ParseCalendar(data)
 	if err != nil {
-		return nil, err
+		log.Printf("Could not parse calendar of message %s due to: %s", m.MessageId(), err)
+		return
 	}
 
-	if !strings.HasPrefix(mediatype, "multipart") {
-		return nil, errors.New("No multipart in body")
-	}
+	m.calendar = c
+}
 
-	reader := multipart.NewReader(r, params["boundary"])
+func isCalendar(mediatype, filename string) bool {
+	mediatype = strings.ToLower(mediatype)
 
-	return reader, nil
+	return mediatype == CalendarMimeType || mediatype == "application/ics" ||
+		strings.HasSuffix(strings.ToLower(filename), ".ics")
 }
 
 func (m *MessageInfo) decodePart(part *multipart.Part) ([]byte, error) {
-	var r io.Reader
-
-	r = part
-
-	cte := part.Header.Get("Content-Transfer-Encoding")
+	return decodeBody(part.Header, part)
+}
 
-	if strings.Contains(cte, "base64") {
-		r = base64.NewDecoder(base64.StdEncoding, part)
-	}
+func decodeBody(header textproto.MIMEHeader, r io.Reader) ([]byte, error) {
+	r = transferDecoder(header.Get("Content-Transfer-Encoding"), r)
 
 	b := bytes.Buffer{}
 	if _, err := b.ReadFrom(r); err != nil {
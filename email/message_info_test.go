@@ -0,0 +1,72 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderAccessors(t *testing.T) {
+	raw := "From: sender.gopher@golang.org\r\n" +
+		"To: =?UTF-8?Q?Micha=C5=82?= <michal@golang.org>, \"Doe, John\" <john@golang.org>\r\n" +
+		"Cc: support@golang.org\r\n" +
+		"Cc: broken <, sales@golang.org\r\n" +
+		"Reply-To: <reply@golang.org>\r\n" +
+		"In-Reply-To: <first@golang.org>\r\n" +
+		"References: <root@golang.org>\r\n <first@golang.org>\r\n" +
+		"List-Id: =?UTF-8?Q?Lista_dyskusyjna?= <golang-nuts.googlegroups.com>\r\n" +
+		"X-Ticket: =?UTF-8?B?WmfFgm9zemVuaWU=?=\r\n" +
+		"Subject: Headers\r\n" +
+		"\r\n" +
+		"Text\r\n"
+
+	mi := newTestMessageInfo(t, []byte(raw))
+
+	if to := mi.To(); assert.Len(t, to, 2) {
+		assert.Equal(t, "Michał", to[0].Name)
+		assert.Equal(t, "Doe, John", to[1].Name)
+		assert.Equal(t, "john@golang.org", to[1].Address)
+	}
+
+	if cc := mi.Cc(); assert.Len(t, cc, 3) {
+		assert.Equal(t, "support@golang.org", cc[0].Address)
+		assert.Equal(t, "sales@golang.org", cc[2].Address)
+	}
+
+	if rt := mi.ReplyTo(); assert.Len(t, rt, 1) {
+		assert.Equal(t, "reply@golang.org", rt[0].Address)
+	}
+
+	assert.Equal(t, []string{"first@golang.org"}, mi.InReplyTo())
+	assert.Equal(t, []string{"root@golang.org", "first@golang.org"}, mi.References())
+	assert.Equal(t, "golang-nuts.googlegroups.com", mi.ListID())
+	assert.Equal(t, "Zgłoszenie", mi.Header("x-ticket"))
+	assert.Equal(t, []string{"Zgłoszenie"}, mi.Headers()["X-Ticket"])
+	assert.Empty(t, mi.Header("X-Missing"))
+}
+
+func TestParseMessageInfo(t *testing.T) {
+	raw := "From: sender.gopher@golang.org\r\n" +
+		"Subject: Stored\r\n" +
+		"Date: Tue, 01 Jun 2021 08:00:00 +0200\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Body of the stored message\r\n"
+
+	mi, err := ParseMessageInfo([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, mi.ParseBody())
+	assert.Equal(t, "Stored", mi.Subject())
+	assert.Equal(t, int64(1622527200), mi.DateTime().Unix())
+	assert.Equal(t, []byte(raw), mi.Raw())
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.Contains(t, string(mi.Contents()[0].Data), "Body of the stored message")
+	}
+
+	_, err = ParseMessageInfo([]byte("not a message"))
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/mail"
 	"strings"
@@ -72,6 +73,32 @@ func TestSubject(t *testing.T) {
 	assert.Equal(t, s, subject, fmt.Sprintf("Different subject name got %s expected %s", s, subject))
 }
 
+func TestSubjectHeaderIsEncoded(t *testing.T) {
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatalf("Could not create test message due to: %s", err)
+	}
+
+	m.SetSubject("Zażółć\r\nBcc: attacker@golang.org")
+
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, msg.Header.Get("Bcc"))
+
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Zażółć\r\nBcc: attacker@golang.org", decoded)
+	}
+}
+
 func TestRecipients(t *testing.T) {
 	m := NewMessage()
 	m.AddRecipient(firstRecipientEmail)
@@ -82,6 +109,32 @@ func TestRecipients(t *testing.T) {
 
 }
 
+func TestCcAndBcc(t *testing.T) {
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatalf("Could not create test message due to: %s", err)
+	}
+
+	m.AddCc("Copy Gopher <copy@golang.org>")
+	m.AddBcc("hidden@golang.org")
+
+	assert.Equal(t, []string{firstRecipientEmail, secondRecipientEmail, "copy@golang.org", "hidden@golang.org"}, m.EnvelopeRecipients())
+
+	b, err := m.write()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(b)
+	if err != nil {
+		t.Fatalf("Bad message format: %s", err)
+	}
+
+	assert.Equal(t, "Copy Gopher <copy@golang.org>", msg.Header.Get("Cc"))
+	assert.Empty(t, msg.Header.Get("Bcc"))
+	assert.NotContains(t, b.String(), "hidden@golang.org")
+}
+
 func TestBoundary(t *testing.T) {
 	m := NewMessage()
 	assert.NotEmpty(t, m.boundary(), "Boundary value should not be empty")
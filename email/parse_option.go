@@ -0,0 +1,90 @@
+package email
+
+import (
+	"errors"
+	"log"
+)
+
+//Representations of received HTML content
+const (
+	HTMLRaw       = "raw"
+	HTMLSanitized = "sanitized"
+	HTMLText      = "text"
+)
+
+var ErrHTMLFormat = errors.New("Unknown HTML format, expected raw, sanitized or text")
+
+type parseOptions struct {
+	sanitize      bool
+	text          bool
+	attachmentURL AttachmentURLFunc
+}
+
+type ParseOption func(o *parseOptions)
+
+//Sanitizes HTML content, cid: images are linked with attachmentURL when it is not nil
+func WithSanitizedHTML(attachmentURL AttachmentURLFunc) ParseOption {
+	return func(o *parseOptions) {
+		o.sanitize = true
+		o.attachmentURL = attachmentURL
+	}
+}
+
+//Links cid: images of sanitized HTML with attachmentURL, unless other function was already given
+func WithAttachmentURL(attachmentURL AttachmentURLFunc) ParseOption {
+	return func(o *parseOptions) {
+		if o.attachmentURL == nil {
+			o.attachmentURL = attachmentURL
+		}
+	}
+}
+
+//Converts HTML content to plain text
+func WithHTMLText() ParseOption {
+	return func(o *parseOptions) {
+		o.text = true
+	}
+}
+
+//Options producing the HTML representation requested by API clients
+func HTMLFormatOptions(format string, attachmentURL AttachmentURLFunc) ([]ParseOption, error) {
+	switch format {
+	case "", HTMLRaw:
+		return nil, nil
+	case HTMLSanitized:
+		return []ParseOption{WithSanitizedHTML(attachmentURL)}, nil
+	case HTMLText:
+		return []ParseOption{WithHTMLText()}, nil
+	}
+
+	return nil, ErrHTMLFormat
+}
+
+func (m *MessageInfo) applyHTMLOptions(o *parseOptions) {
+	for _, c := range m.contents {
+		if !c.HTMLType {
+			continue
+		}
+
+		switch {
+		case o.text:
+			text, err := HTMLToText(c.Data)
+			if err != nil {
+				log.Printf("Could not convert HTML of message %s to text due to: %s", m.MessageId(), err)
+				continue
+			}
+
+			c.Data = text
+			c.HTMLType = false
+		case o.sanitize:
+			clean, err := SanitizeHTML(c.Data, o.attachmentURL)
+			if err != nil {
+				//unsafe content is not passed to clients
+				log.Printf("Could not sanitize HTML of message %s due to: %s", m.MessageId(), err)
+				clean = []byte{}
+			}
+
+			c.Data = clean
+		}
+	}
+}
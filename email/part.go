@@ -0,0 +1,163 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+//Deeper MIME trees are treated as a leaf part
+const maxPartDepth = 32
+
+//Node of the message MIME tree
+type Part struct {
+	ContentType string               `json:"content_type"`
+	Charset     string               `json:"charset,omitempty"`
+	Disposition string               `json:"disposition,omitempty"`
+	FileName    string               `json:"file_name,omitempty"`
+	ContentID   string               `json:"content_id,omitempty"`
+	Size        int                  `json:"size"`
+	Children    []*Part              `json:"children,omitempty"`
+	Header      textproto.MIMEHeader `json:"-"`
+	Data        []byte               `json:"-"`
+}
+
+//Checks if the part is a container of other parts
+func (p *Part) IsMultipart() bool {
+	return strings.HasPrefix(p.ContentType, "multipart/")
+}
+
+//Checks if the part should be presented as a file rather than the message text
+func (p *Part) IsAttachment() bool {
+	if p.Disposition == "attachment" || len(p.FileName) > 0 {
+		return true
+	}
+
+	switch p.ContentType {
+	case "text/plain", "text/html", CalendarMimeType:
+		return false
+	}
+
+	return !p.IsMultipart()
+}
+
+//Walks the tree depth first calling fn for every part
+func (p *Part) Walk(fn func(part *Part) error) error {
+	if err := fn(p); err != nil {
+		return err
+	}
+
+	for _, c := range p.Children {
+		if err := c.Walk(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parsePart(header textproto.MIMEHeader, body io.Reader, depth int) (*Part, error) {
+	p := &Part{
+		Header:   header,
+		Children: make([]*Part, 0),
+	}
+
+	params := p.parseContentType(header.Get("Content-Type"))
+	p.parseDisposition(header.Get("Content-Disposition"), params["name"])
+	p.ContentID = strings.Trim(header.Get("Content-ID"), "<> ")
+
+	boundary := params["boundary"]
+
+	if !p.IsMultipart() || len(boundary) == 0 || depth >= maxPartDepth {
+		data, err := decodeBody(header, body)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Data = data
+		p.Size = len(data)
+
+		return p, nil
+	}
+
+	reader := multipart.NewReader(body, boundary)
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+
+		child, err := parsePart(part.Header, part, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Size += child.Size
+		p.Children = append(p.Children, child)
+	}
+
+	return p, nil
+}
+
+func (p *Part) parseContentType(ct string) map[string]string {
+	//RFC 2045 5.2 default for missing Content-Type
+	p.ContentType = "text/plain"
+
+	if len(strings.TrimSpace(ct)) == 0 {
+		return map[string]string{}
+	}
+
+	mediatype, params, err := mime.ParseMediaType(ct)
+	if err != nil && err != mime.ErrInvalidMediaParameter {
+		p.ContentType = "application/octet-stream"
+		return map[string]string{}
+	}
+
+	p.ContentType = strings.ToLower(mediatype)
+	p.Charset = strings.ToLower(params["charset"])
+
+	return params
+}
+
+func (p *Part) parseDisposition(cd, name string) {
+	disposition, params, err := mime.ParseMediaType(cd)
+	if err == nil || err == mime.ErrInvalidMediaParameter {
+		p.Disposition = strings.ToLower(disposition)
+	}
+
+	filename := params["filename"]
+	if len(filename) == 0 {
+		filename = name
+	}
+
+	if d, err := decode(filename); err == nil {
+		filename = d
+	}
+
+	p.FileName = filename
+}
+
+//Name of attached part, generated when the part was sent without one
+func (p *Part) name(index int) string {
+	if len(p.FileName) > 0 {
+		return p.FileName
+	}
+
+	ext := ""
+	if e, err := mime.ExtensionsByType(p.ContentType); err == nil && len(e) > 0 {
+		ext = e[0]
+	}
+
+	if len(p.ContentID) > 0 {
+		return p.ContentID + ext
+	}
+
+	return fmt.Sprintf("part-%d%s", index, ext)
+}
@@ -0,0 +1,147 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const nestedMessage = "From: Gopher <sender.gopher@golang.org>\r\n" +
+	"To: first.recipient@golang.org\r\n" +
+	"Subject: Nested\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+	"\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: multipart/related; boundary=related\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: multipart/alternative; boundary=alternative\r\n" +
+	"\r\n" +
+	"--alternative\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Plain text\r\n" +
+	"--alternative\r\n" +
+	"Content-Type: text/html; charset=UTF-8\r\n" +
+	"\r\n" +
+	"<p>Html text<img src=\"cid:logo@golang.org\"></p>\r\n" +
+	"--alternative--\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-ID: <logo@golang.org>\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--related--\r\n" +
+	"\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"Notes\r\n" +
+	"--mixed--\r\n"
+
+func TestParseNestedTree(t *testing.T) {
+	mi := newTestMessageInfo(t, []byte(nestedMessage))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	root := mi.PartTree()
+	if assert.NotNil(t, root) && assert.Len(t, root.Children, 2) {
+		assert.Equal(t, "multipart/mixed", root.ContentType)
+
+		related := root.Children[0]
+		assert.Equal(t, "multipart/related", related.ContentType)
+
+		if assert.Len(t, related.Children, 2) {
+			assert.Len(t, related.Children[0].Children, 2)
+			assert.Equal(t, "logo@golang.org", related.Children[1].ContentID)
+			assert.Equal(t, 8, related.Children[1].Size)
+		}
+
+		assert.Equal(t, "attachment", root.Children[1].Disposition)
+	}
+
+	if assert.Len(t, mi.Contents(), 2) {
+		assert.Equal(t, "Plain text", string(mi.Contents()[0].Data))
+		assert.True(t, mi.Contents()[1].HTMLType)
+	}
+
+	if assert.Len(t, mi.Files(), 2) {
+		assert.Equal(t, "logo@golang.org.png", mi.Files()[0].Name)
+		assert.Equal(t, "logo@golang.org", mi.Files()[0].ContentID)
+		assert.Equal(t, "notes.txt", mi.Files()[1].Name)
+		assert.Equal(t, "Notes", string(mi.Files()[1].Data))
+	}
+}
+
+func TestParseSinglePart(t *testing.T) {
+	plain := "From: sender.gopher@golang.org\r\n" +
+		"Subject: Plain\r\n" +
+		"\r\n" +
+		"Only text\r\n"
+
+	mi := newTestMessageInfo(t, []byte(plain))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.False(t, mi.Contents()[0].HTMLType)
+		assert.Equal(t, "Only text\n", string(mi.Contents()[0].Data))
+	}
+
+	html := "From: sender.gopher@golang.org\r\n" +
+		"Subject: Html\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PHA+SHRtbDwvcD4=\r\n"
+
+	mi = newTestMessageInfo(t, []byte(html))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.True(t, mi.Contents()[0].HTMLType)
+		assert.Equal(t, "<p>Html</p>", string(mi.Contents()[0].Data))
+	}
+
+	assert.Empty(t, mi.Files())
+}
+
+func TestParseComposedMessage(t *testing.T) {
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.AttachFile(&File{Name: fileName, Data: []byte(fileText)})
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi := newTestMessageInfo(t, mb)
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.Equal(t, contentText, string(mi.Contents()[0].Data))
+	}
+
+	if assert.Len(t, mi.Files(), 1) {
+		assert.Equal(t, fileName, mi.Files()[0].Name)
+		assert.Equal(t, fileText, string(mi.Files()[0].Data))
+	}
+}
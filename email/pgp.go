@@ -0,0 +1,366 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	PGPSignatureType = "application/pgp-signature"
+	PGPEncryptedType = "application/pgp-encrypted"
+)
+
+var (
+	ErrPGPNotConfigured = errors.New("PGP is not configured for the account")
+	ErrPGPNoSigningKey  = errors.New("PGP keyring does not contain private signing key")
+
+	pgpConfig = &packet.Config{
+		DefaultHash:   crypto.SHA256,
+		DefaultCipher: packet.CipherAES256,
+	}
+)
+
+type PGPStatus struct {
+	Signed         bool   `json:"signed"`
+	Encrypted      bool   `json:"encrypted"`
+	SignatureValid bool   `json:"signature_valid"`
+	SignerKeyID    string `json:"signer_key_id,omitempty"`
+	SignerIdentity string `json:"signer_identity,omitempty"`
+	SenderMatch    bool   `json:"sender_match"`
+	Error          string `json:"error,omitempty"`
+}
+
+//Reads armored or binary keyring file
+func LoadPGPKeyring(path string) (openpgp.EntityList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data)); err == nil {
+		return el, nil
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+//Loads account keyring and decrypts its private keys with the passphrase
+func LoadPGPAccountKeyring(config *PGPConfig) (openpgp.EntityList, error) {
+	el, err := LoadPGPKeyring(config.KeyringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.PublicKeyringPath) > 0 {
+		if _, err := os.Stat(config.PublicKeyringPath); err == nil {
+			public, err := LoadPGPKeyring(config.PublicKeyringPath)
+			if err != nil {
+				return nil, err
+			}
+			el = append(el, public...)
+		}
+	}
+
+	passphrase := []byte(config.Passphrase)
+
+	for _, e := range el {
+		if e.PrivateKey != nil && e.PrivateKey.Encrypted {
+			if err := e.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, fmt.Errorf("Could not decrypt PGP private key due to: %s", err)
+			}
+		}
+
+		for _, s := range e.Subkeys {
+			if s.PrivateKey != nil && s.PrivateKey.Encrypted {
+				if err := s.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, fmt.Errorf("Could not decrypt PGP private subkey due to: %s", err)
+				}
+			}
+		}
+	}
+
+	return el, nil
+}
+
+//Finds entity with identity using the address
+func FindPGPEntity(el openpgp.EntityList, address string) (*openpgp.Entity, error) {
+	for _, e := range el {
+		for _, id := range e.Identities {
+			if id.UserId != nil && strings.EqualFold(id.UserId.Email, address) {
+				return e, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("PGP key for %s was not found", address)
+}
+
+//Signs the message entity into multipart/signed with detached application/pgp-signature (RFC 3156)
+func SignPGP(message []byte, signer *openpgp.Entity) ([]byte, error) {
+	if signer.PrivateKey == nil {
+		return nil, ErrPGPNoSigningKey
+	}
+
+	outer, entity := splitEntity(message)
+
+	signature := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(signature, signer, bytes.NewReader(entity), pgpConfig); err != nil {
+		return nil, fmt.Errorf("Could not sign message due to: %s", err)
+	}
+
+	boundary := newBoundary()
+
+	body := &bytes.Buffer{}
+	fmt.Fprintf(body, "This is an OpenPGP/MIME signed message (RFC 3156).\r\n\r\n--%s\r\n", boundary)
+	body.Write(entity)
+	fmt.Fprintf(body, "\r\n--%s\r\n", boundary)
+	fmt.Fprintf(body, "Content-Type: %s; name=\"signature.asc\"\r\n", PGPSignatureType)
+	body.WriteString("Content-Disposition: attachment; filename=\"signature.asc\"\r\n\r\n")
+	body.Write(normalizeCRLF(signature.Bytes()))
+	fmt.Fprintf(body, "\r\n--%s--\r\n", boundary)
+
+	header := []string{
+		fmt.Sprintf("Content-Type: multipart/signed; micalg=pgp-sha256; protocol=\"%s\"; boundary=%s", PGPSignatureType, boundary),
+	}
+
+	return joinEntity(outer, header, body.Bytes()), nil
+}
+
+//Encrypts the message entity into multipart/encrypted (RFC 3156)
+func EncryptPGP(message []byte, recipients openpgp.EntityList) ([]byte, error) {
+	outer, entity := splitEntity(message)
+
+	armored := &bytes.Buffer{}
+
+	aw, err := armor.Encode(armored, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pw, err := openpgp.Encrypt(aw, recipients, nil, nil, pgpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not encrypt message due to: %s", err)
+	}
+
+	if _, err := pw.Write(entity); err != nil {
+		return nil, err
+	}
+
+	if err := pw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	boundary := newBoundary()
+
+	body := &bytes.Buffer{}
+	fmt.Fprintf(body, "This is an OpenPGP/MIME encrypted message (RFC 3156).\r\n\r\n--%s\r\n", boundary)
+	fmt.Fprintf(body, "Content-Type: %s\r\nContent-Description: PGP/MIME version identification\r\n\r\nVersion: 1\r\n", PGPEncryptedType)
+	fmt.Fprintf(body, "\r\n--%s\r\n", boundary)
+	body.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n")
+	body.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n")
+	body.Write(normalizeCRLF(armored.Bytes()))
+	fmt.Fprintf(body, "\r\n--%s--\r\n", boundary)
+
+	header := []string{
+		fmt.Sprintf("Content-Type: multipart/encrypted; protocol=\"%s\"; boundary=%s", PGPEncryptedType, boundary),
+	}
+
+	return joinEntity(outer, header, body.Bytes()), nil
+}
+
+//Sets keyring with account private key and known public keys used for received PGP/MIME messages
+func (m *MessageInfo) SetPGP(keyring openpgp.EntityList) {
+	m.pgpKeyring = keyring
+}
+
+//PGP/MIME status of the message, nil when message is not PGP/MIME
+func (m *MessageInfo) PGP() *PGPStatus {
+	return m.pgp
+}
+
+func (m *MessageInfo) unwrapSignedPGP(boundary string) error {
+	status := m.pgpStatus()
+	status.Signed = true
+
+	body, err := ioutil.ReadAll(m.message.Body)
+	if err != nil {
+		return err
+	}
+
+	entity, signature, err := splitSignedBody(body, boundary)
+	if err != nil {
+		return err
+	}
+
+	_, _, sig, err := readEntityPart(signature)
+	if err != nil {
+		return fmt.Errorf("Could not read PGP signature due to: %s", err)
+	}
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(m.pgpKeyring, bytes.NewReader(entity), bytes.NewReader(sig))
+	if err != nil {
+		status.Error = fmt.Sprintf("Signature did not verify: %s", err)
+	} else {
+		status.SignatureValid = true
+		m.pgpSigner(signer)
+	}
+
+	return m.replaceEntity(entity)
+}
+
+func (m *MessageInfo) unwrapEncryptedPGP(boundary string) error {
+	status := m.pgpStatus()
+	status.Encrypted = true
+
+	if len(m.pgpKeyring) == 0 {
+		return ErrPGPNotConfigured
+	}
+
+	reader := multipart.NewReader(m.message.Body, boundary)
+
+	var ciphertext []byte
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			break
+		}
+
+		if strings.HasPrefix(strings.ToLower(part.Header.Get("Content-Type")), "application/octet-stream") {
+			if ciphertext, err = ioutil.ReadAll(part); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(ciphertext) == 0 {
+		return errors.New("Encrypted PGP part not found")
+	}
+
+	block, err := armor.Decode(bytes.NewReader(ciphertext))
+	if err != nil {
+		return fmt.Errorf("Could not decode PGP message due to: %s", err)
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, m.pgpKeyring, nil, pgpConfig)
+	if err != nil {
+		return fmt.Errorf("Could not decrypt PGP message due to: %s", err)
+	}
+
+	entity, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return err
+	}
+
+	if md.IsSigned {
+		status.Signed = true
+
+		if md.SignatureError == nil && md.SignedBy != nil {
+			status.SignatureValid = true
+			m.pgpSigner(md.SignedBy.Entity)
+		} else if md.SignatureError != nil {
+			status.Error = fmt.Sprintf("Signature did not verify: %s", md.SignatureError)
+		}
+	}
+
+	return m.replaceEntity(entity)
+}
+
+func (m *MessageInfo) pgpSigner(signer *openpgp.Entity) {
+	status := m.pgpStatus()
+	status.SignerKeyID = fmt.Sprintf("%X", signer.PrimaryKey.KeyId)
+
+	sender := m.Sender().Address
+
+	for name, id := range signer.Identities {
+		if len(status.SignerIdentity) == 0 {
+			status.SignerIdentity = name
+		}
+
+		if id.UserId != nil && strings.EqualFold(id.UserId.Email, sender) {
+			status.SignerIdentity = name
+			status.SenderMatch = true
+		}
+	}
+}
+
+func (m *MessageInfo) pgpStatus() *PGPStatus {
+	if m.pgp == nil {
+		m.pgp = &PGPStatus{}
+	}
+
+	return m.pgp
+}
+
+//Signs and encrypts outgoing message with PGP/MIME according to message and account settings
+func (e *Email) pgp(config *Config, msg *Message, message []byte) ([]byte, error) {
+	pc := config.PGP
+
+	sign := msg.pgpSign || (pc != nil && pc.Sign)
+	encrypt := msg.pgpEncrypt || (pc != nil && pc.Encrypt)
+
+	if !sign && !encrypt {
+		return message, nil
+	}
+
+	if pc == nil {
+		return nil, ErrPGPNotConfigured
+	}
+
+	keyring, err := LoadPGPAccountKeyring(pc)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load PGP keyring due to: %s", err)
+	}
+
+	account, err := FindPGPEntity(keyring, config.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if sign {
+		if message, err = SignPGP(message, account); err != nil {
+			return nil, err
+		}
+	}
+
+	if !encrypt {
+		return message, nil
+	}
+
+	recipients := openpgp.EntityList{account}
+
+	for _, r := range msg.EnvelopeRecipients() {
+		a, err := mail.ParseAddress(r)
+		if err != nil {
+			return nil, err
+		}
+
+		entity, err := FindPGPEntity(keyring, a.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, entity)
+	}
+
+	return EncryptPGP(message, recipients)
+}
@@ -0,0 +1,145 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func createTestEntity(t *testing.T, name, address string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//GnuPG generated keys always publish algorithm preferences
+	for _, id := range e.Identities {
+		id.SelfSignature.PreferredHash = []uint8{8}
+		id.SelfSignature.PreferredSymmetric = []uint8{uint8(packet.CipherAES256)}
+	}
+
+	return e
+}
+
+func TestPGPSignEncrypt(t *testing.T) {
+	sender := createTestEntity(t, senderName, senderAddress)
+	recipient := createTestEntity(t, "Recipient", firstRecipientEmail)
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := SignPGP(mb, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(signed), "protocol=\"application/pgp-signature\"")
+
+	encrypted, err := EncryptPGP(signed, openpgp.EntityList{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(encrypted), "multipart/encrypted")
+	assert.Contains(t, string(encrypted), "BEGIN PGP MESSAGE")
+	assert.NotContains(t, string(encrypted), m.encode([]byte(contentText)))
+
+	mi := newTestMessageInfo(t, encrypted)
+	mi.SetPGP(openpgp.EntityList{recipient, sender})
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	status := mi.PGP()
+	if assert.NotNil(t, status) {
+		assert.True(t, status.Encrypted)
+		assert.True(t, status.Signed)
+		assert.True(t, status.SignatureValid, status.Error)
+		assert.True(t, status.SenderMatch)
+		assert.Contains(t, status.SignerIdentity, senderAddress)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.Equal(t, contentText, string(mi.Contents()[0].Data))
+	}
+}
+
+func TestPGPUnknownSigner(t *testing.T) {
+	sender := createTestEntity(t, senderName, senderAddress)
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := SignPGP(mb, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi := newTestMessageInfo(t, signed)
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.NotNil(t, mi.PGP()) {
+		assert.True(t, mi.PGP().Signed)
+		assert.False(t, mi.PGP().SignatureValid)
+	}
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.Equal(t, contentText, string(mi.Contents()[0].Data))
+	}
+}
+
+func TestPGPEncryptedWithoutKeyring(t *testing.T) {
+	recipient := createTestEntity(t, "Recipient", firstRecipientEmail)
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := EncryptPGP(mb, openpgp.EntityList{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi := newTestMessageInfo(t, encrypted)
+
+	assert.Equal(t, ErrPGPNotConfigured, mi.ParseBody())
+	assert.True(t, mi.PGP().Encrypted)
+}
+
+func TestFindPGPEntity(t *testing.T) {
+	recipient := createTestEntity(t, "Recipient", firstRecipientEmail)
+
+	e, err := FindPGPEntity(openpgp.EntityList{recipient}, strings.ToUpper(firstRecipientEmail))
+	assert.NoError(t, err)
+	assert.Equal(t, recipient, e)
+
+	_, err = FindPGPEntity(openpgp.EntityList{recipient}, secondRecipientEmail)
+	assert.Error(t, err)
+}
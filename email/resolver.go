@@ -0,0 +1,54 @@
+package email
+
+import (
+	"context"
+	"net"
+)
+
+//DNS lookups used by message authentication, replaceable in tests
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+	LookupIP(host string) ([]net.IP, error)
+	LookupMX(name string) ([]*net.MX, error)
+}
+
+type DNSResolver struct {
+	resolver *net.Resolver
+}
+
+func NewDNSResolver() *DNSResolver {
+	return &DNSResolver{
+		resolver: net.DefaultResolver,
+	}
+}
+
+func (d *DNSResolver) LookupTXT(name string) ([]string, error) {
+	return d.resolver.LookupTXT(context.Background(), name)
+}
+
+func (d *DNSResolver) LookupIP(host string) ([]net.IP, error) {
+	addrs, err := d.resolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+
+	return ips, nil
+}
+
+func (d *DNSResolver) LookupMX(name string) ([]*net.MX, error) {
+	return d.resolver.LookupMX(context.Background(), name)
+}
+
+//Checks if lookup error means that the record does not exist
+func isNotFound(err error) bool {
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr.IsNotFound
+	}
+
+	return false
+}
@@ -0,0 +1,425 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+const (
+	SMIMESignatureType = "application/pkcs7-signature"
+	SMIMEMimeType      = "application/pkcs7-mime"
+)
+
+var ErrSMIMENotConfigured = errors.New("S/MIME is not configured for the account")
+
+func init() {
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+}
+
+//Account certificate with its private key
+type SMIMEIdentity struct {
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
+}
+
+type Signer struct {
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+type SMIMEStatus struct {
+	Signed         bool    `json:"signed"`
+	Encrypted      bool    `json:"encrypted"`
+	SignatureValid bool    `json:"signature_valid"`
+	ChainVerified  bool    `json:"chain_verified"`
+	SenderMatch    bool    `json:"sender_match"`
+	Signer         *Signer `json:"signer,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+//Recipient certificates indexed by email address
+type CertificateStore struct {
+	certs map[string]*x509.Certificate
+	mutex sync.RWMutex
+}
+
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{
+		certs: make(map[string]*x509.Certificate),
+	}
+}
+
+//Loads every PEM file from the directory into a new store
+func LoadCertificateStore(path string) (*CertificateStore, error) {
+	s := NewCertificateStore()
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		certs, err := loadCertificates(filepath.Join(path, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range certs {
+			s.Add(c)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *CertificateStore) Add(cert *x509.Certificate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, a := range certificateAddresses(cert) {
+		s.certs[strings.ToLower(a)] = cert
+	}
+}
+
+func (s *CertificateStore) Find(address string) (*x509.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if c, ok := s.certs[strings.ToLower(address)]; ok {
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("Certificate for %s was not found", address)
+}
+
+func LoadSMIMEIdentity(certPath, keyPath string) (*SMIMEIdentity, error) {
+	certs, err := loadCertificates(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyData, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey(keyData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMIMEIdentity{
+		Certificate: certs[0],
+		PrivateKey:  key,
+	}, nil
+}
+
+//Signs the message entity and wraps it into multipart/signed with detached application/pkcs7-signature
+func SignSMIME(message []byte, identity *SMIMEIdentity) ([]byte, error) {
+	outer, entity := splitEntity(message)
+
+	sd, err := pkcs7.NewSignedData(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	if err := sd.AddSigner(identity.Certificate, identity.PrivateKey, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("Could not sign message due to: %s", err)
+	}
+
+	sd.Detach()
+
+	der, err := sd.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := newBoundary()
+
+	body := &bytes.Buffer{}
+	fmt.Fprintf(body, "This is a cryptographically signed message in MIME format.\r\n\r\n--%s\r\n", boundary)
+	body.Write(entity)
+	fmt.Fprintf(body, "\r\n--%s\r\n", boundary)
+	fmt.Fprintf(body, "Content-Type: %s; name=smime.p7s\r\n", SMIMESignatureType)
+	body.WriteString("Content-Transfer-Encoding: base64\r\n")
+	body.WriteString("Content-Disposition: attachment; filename=smime.p7s\r\n\r\n")
+	body.WriteString(wrapBase64(der))
+	fmt.Fprintf(body, "--%s--\r\n", boundary)
+
+	header := []string{
+		fmt.Sprintf("Content-Type: multipart/signed; protocol=\"%s\"; micalg=sha-256; boundary=%s", SMIMESignatureType, boundary),
+	}
+
+	return joinEntity(outer, header, body.Bytes()), nil
+}
+
+//Encrypts the message entity into application/pkcs7-mime enveloped-data
+func EncryptSMIME(message []byte, recipients []*x509.Certificate) ([]byte, error) {
+	outer, entity := splitEntity(message)
+
+	der, err := pkcs7.Encrypt(entity, recipients)
+	if err != nil {
+		return nil, fmt.Errorf("Could not encrypt message due to: %s", err)
+	}
+
+	header := []string{
+		fmt.Sprintf("Content-Type: %s; smime-type=enveloped-data; name=smime.p7m", SMIMEMimeType),
+		"Content-Transfer-Encoding: base64",
+		"Content-Disposition: attachment; filename=smime.p7m",
+	}
+
+	return joinEntity(outer, header, []byte(wrapBase64(der))), nil
+}
+
+//Sets account identity used to decrypt and trust roots used to verify received S/MIME messages
+func (m *MessageInfo) SetSMIME(identity *SMIMEIdentity, roots *x509.CertPool) {
+	m.smimeIdentity = identity
+	m.smimeRoots = roots
+}
+
+//S/MIME status of the message, nil when message is not S/MIME
+func (m *MessageInfo) SMIME() *SMIMEStatus {
+	return m.smime
+}
+
+func (m *MessageInfo) unwrapPKCS7Mime(params map[string]string) error {
+	status := m.smimeStatus()
+
+	body, err := ioutil.ReadAll(transferDecoder(m.message.Header.Get("Content-Transfer-Encoding"), m.message.Body))
+	if err != nil {
+		return err
+	}
+
+	p7, err := pkcs7.Parse(body)
+	if err != nil {
+		return fmt.Errorf("Could not parse S/MIME content due to: %s", err)
+	}
+
+	if strings.EqualFold(params["smime-type"], "signed-data") {
+		m.verifySMIME(p7)
+		return m.replaceEntity(p7.Content)
+	}
+
+	status.Encrypted = true
+
+	if m.smimeIdentity == nil {
+		return ErrSMIMENotConfigured
+	}
+
+	entity, err := p7.Decrypt(m.smimeIdentity.Certificate, m.smimeIdentity.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("Could not decrypt S/MIME message due to: %s", err)
+	}
+
+	return m.replaceEntity(entity)
+}
+
+func (m *MessageInfo) unwrapSignedSMIME(boundary string) error {
+	body, err := ioutil.ReadAll(m.message.Body)
+	if err != nil {
+		return err
+	}
+
+	entity, signature, err := splitSignedBody(body, boundary)
+	if err != nil {
+		return err
+	}
+
+	_, _, der, err := readEntityPart(signature)
+	if err != nil {
+		return fmt.Errorf("Could not read S/MIME signature due to: %s", err)
+	}
+
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return fmt.Errorf("Could not parse S/MIME signature due to: %s", err)
+	}
+
+	p7.Content = entity
+
+	m.verifySMIME(p7)
+
+	return m.replaceEntity(entity)
+}
+
+func (m *MessageInfo) verifySMIME(p7 *pkcs7.PKCS7) {
+	status := m.smimeStatus()
+	status.Signed = true
+
+	if err := p7.Verify(); err != nil {
+		status.Error = fmt.Sprintf("Signature did not verify: %s", err)
+	} else {
+		status.SignatureValid = true
+	}
+
+	if status.SignatureValid && m.smimeRoots != nil {
+		if err := p7.VerifyWithChain(m.smimeRoots); err != nil {
+			status.Error = fmt.Sprintf("Signer is not trusted: %s", err)
+		} else {
+			status.ChainVerified = true
+		}
+	}
+
+	cert := p7.GetOnlySigner()
+	if cert == nil {
+		return
+	}
+
+	status.Signer = &Signer{
+		Name:         cert.Subject.CommonName,
+		Issuer:       cert.Issuer.CommonName,
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotAfter:     cert.NotAfter,
+	}
+
+	addresses := certificateAddresses(cert)
+	if len(addresses) > 0 {
+		status.Signer.Email = addresses[0]
+	}
+
+	status.SenderMatch = containsFold(addresses, m.Sender().Address)
+}
+
+func (m *MessageInfo) smimeStatus() *SMIMEStatus {
+	if m.smime == nil {
+		m.smime = &SMIMEStatus{}
+	}
+
+	return m.smime
+}
+
+//Signs and encrypts outgoing message according to message and account settings
+func (e *Email) smime(config *Config, msg *Message, message []byte) ([]byte, error) {
+	sc := config.SMIME
+
+	sign := msg.smimeSign || (sc != nil && sc.Sign)
+	encrypt := msg.smimeEncrypt || (sc != nil && sc.Encrypt)
+
+	if !sign && !encrypt {
+		return message, nil
+	}
+
+	if sc == nil {
+		return nil, ErrSMIMENotConfigured
+	}
+
+	identity, err := LoadSMIMEIdentity(sc.CertificatePath, sc.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load S/MIME identity due to: %s", err)
+	}
+
+	if sign {
+		if message, err = SignSMIME(message, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if !encrypt {
+		return message, nil
+	}
+
+	store, err := LoadCertificateStore(sc.RecipientCertificatesPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load recipient certificates due to: %s", err)
+	}
+
+	recipients := []*x509.Certificate{identity.Certificate}
+
+	for _, r := range msg.EnvelopeRecipients() {
+		a, err := mail.ParseAddress(r)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := store.Find(a.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, cert)
+	}
+
+	return EncryptSMIME(message, recipients)
+}
+
+func (e *Email) smimeReader(config *Config) (*SMIMEIdentity, *x509.CertPool, error) {
+	sc := config.SMIME
+
+	identity, err := LoadSMIMEIdentity(sc.CertificatePath, sc.PrivateKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(sc.TrustedCAPath) == 0 {
+		return identity, nil, nil
+	}
+
+	data, err := ioutil.ReadFile(sc.TrustedCAPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, nil, fmt.Errorf("No trusted CA certificate found in %s", sc.TrustedCAPath)
+	}
+
+	return identity, roots, nil
+}
+
+func certificateAddresses(cert *x509.Certificate) []string {
+	addresses := append([]string{}, cert.EmailAddresses...)
+
+	if strings.Contains(cert.Subject.CommonName, "@") {
+		addresses = append(addresses, cert.Subject.CommonName)
+	}
+
+	return addresses
+}
+
+func isPKCS7Mime(mediatype string) bool {
+	return mediatype == SMIMEMimeType || mediatype == "application/x-pkcs7-mime"
+}
+
+func isPKCS7Signature(protocol string) bool {
+	p := strings.ToLower(protocol)
+	return p == SMIMESignatureType || p == "application/x-pkcs7-signature"
+}
+
+//Encodes data as base64 wrapped at 76 characters per line
+func wrapBase64(data []byte) string {
+	enc := base64.StdEncoding.EncodeToString(data)
+	b := &strings.Builder{}
+
+	for len(enc) > 76 {
+		b.WriteString(enc[:76])
+		b.WriteString("\r\n")
+		enc = enc[76:]
+	}
+
+	b.WriteString(enc)
+	b.WriteString("\r\n")
+
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package email
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestCertificate(t *testing.T, name, address string, parent *SMIMEIdentity) *SMIMEIdentity {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+
+	signerCert, signerKey := template, interface{}(key)
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		template.EmailAddresses = []string{address}
+		signerCert, signerKey = parent.Certificate, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &SMIMEIdentity{Certificate: cert, PrivateKey: key}
+}
+
+func TestSMIMESignEncrypt(t *testing.T) {
+	ca := createTestCertificate(t, "Test CA", "", nil)
+	sender := createTestCertificate(t, senderName, senderAddress, ca)
+	recipient := createTestCertificate(t, "Recipient", firstRecipientEmail, ca)
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := SignSMIME(mb, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(signed), "multipart/signed")
+
+	encrypted, err := EncryptSMIME(signed, []*x509.Certificate{recipient.Certificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(encrypted), "smime-type=enveloped-data")
+	assert.NotContains(t, string(encrypted), m.encode([]byte(contentText)))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+
+	mi := newTestMessageInfo(t, encrypted)
+	mi.SetSMIME(recipient, roots)
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	status := mi.SMIME()
+	if assert.NotNil(t, status) {
+		assert.True(t, status.Encrypted)
+		assert.True(t, status.Signed)
+		assert.True(t, status.SignatureValid, status.Error)
+		assert.True(t, status.ChainVerified, status.Error)
+		assert.True(t, status.SenderMatch)
+
+		if assert.NotNil(t, status.Signer) {
+			assert.Equal(t, senderAddress, status.Signer.Email)
+			assert.Equal(t, "Test CA", status.Signer.Issuer)
+		}
+	}
+
+	assert.Equal(t, subject, mi.Subject())
+
+	if assert.Len(t, mi.Contents(), 1) {
+		assert.Equal(t, contentText, string(mi.Contents()[0].Data))
+	}
+}
+
+func TestSMIMETamperedSignature(t *testing.T) {
+	ca := createTestCertificate(t, "Test CA", "", nil)
+	sender := createTestCertificate(t, senderName, senderAddress, ca)
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := SignSMIME(mb, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := m.encode([]byte(contentText))
+	tampered := strings.Replace(string(signed), encoded, m.encode([]byte("Changed text")), 1)
+
+	mi := newTestMessageInfo(t, []byte(tampered))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.NotNil(t, mi.SMIME()) {
+		assert.True(t, mi.SMIME().Signed)
+		assert.False(t, mi.SMIME().SignatureValid)
+	}
+}
+
+func TestSMIMEEncryptedWithoutIdentity(t *testing.T) {
+	ca := createTestCertificate(t, "Test CA", "", nil)
+	recipient := createTestCertificate(t, "Recipient", firstRecipientEmail, ca)
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := EncryptSMIME(mb, []*x509.Certificate{recipient.Certificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi := newTestMessageInfo(t, encrypted)
+
+	assert.Equal(t, ErrSMIMENotConfigured, mi.ParseBody())
+	assert.True(t, mi.SMIME().Encrypted)
+}
+
+func TestCertificateStore(t *testing.T) {
+	ca := createTestCertificate(t, "Test CA", "", nil)
+	recipient := createTestCertificate(t, "Recipient", firstRecipientEmail, ca)
+
+	s := NewCertificateStore()
+	s.Add(recipient.Certificate)
+
+	c, err := s.Find(strings.ToUpper(firstRecipientEmail))
+	assert.NoError(t, err)
+	assert.Equal(t, recipient.Certificate, c)
+
+	_, err = s.Find(secondRecipientEmail)
+	assert.Error(t, err)
+}
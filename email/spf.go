@@ -0,0 +1,339 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+//Maximum number of DNS querying mechanisms per SPF evaluation (RFC 7208 4.6.4)
+const spfLookupLimit = 10
+
+var (
+	errSPFLookupLimit = errors.New("SPF DNS lookup limit exceeded")
+	errSPFMultiple    = errors.New("Multiple SPF records")
+)
+
+type SPFResult struct {
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type spfChecker struct {
+	resolver Resolver
+	ip       net.IP
+	sender   string
+	lookups  int
+}
+
+//Evaluates SPF policy of the domain for client ip and envelope sender
+func CheckSPF(ip net.IP, domain, sender string, resolver Resolver) *SPFResult {
+	result := &SPFResult{
+		Domain: domain,
+		Status: AuthNone,
+	}
+
+	if ip == nil || len(domain) == 0 {
+		return result
+	}
+
+	result.IP = ip.String()
+
+	c := &spfChecker{
+		resolver: resolver,
+		ip:       ip,
+		sender:   sender,
+	}
+
+	status, err := c.check(domain)
+	result.Status = status
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (c *spfChecker) check(domain string) (string, error) {
+	record, err := c.record(domain)
+	if err != nil {
+		return c.lookupStatus(err), err
+	}
+
+	if len(record) == 0 {
+		return AuthNone, nil
+	}
+
+	terms := strings.Fields(record)[1:]
+
+	var redirect string
+
+	for _, term := range terms {
+		if strings.HasPrefix(term, "redirect=") {
+			redirect = strings.TrimPrefix(term, "redirect=")
+			continue
+		}
+
+		if strings.Contains(term, "=") && !strings.Contains(term, ":") {
+			//unknown modifier e.g. exp=
+			continue
+		}
+
+		qualifier := AuthPass
+
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			qualifier = AuthFail
+			term = term[1:]
+		case '~':
+			qualifier = AuthSoftFail
+			term = term[1:]
+		case '?':
+			qualifier = AuthNeutral
+			term = term[1:]
+		}
+
+		match, err := c.match(term, domain)
+		if err != nil {
+			return c.lookupStatus(err), err
+		}
+
+		if match {
+			return qualifier, nil
+		}
+	}
+
+	if len(redirect) > 0 {
+		if err := c.count(); err != nil {
+			return AuthPermError, err
+		}
+
+		status, err := c.check(c.expand(redirect, domain))
+		if status == AuthNone {
+			return AuthPermError, errors.New("SPF redirect domain has no record")
+		}
+
+		return status, err
+	}
+
+	return AuthNeutral, nil
+}
+
+func (c *spfChecker) match(term, domain string) (bool, error) {
+	name, value := term, ""
+
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, value = term[:i], term[i:]
+	}
+
+	target := domain
+	cidr := ""
+
+	if strings.HasPrefix(value, ":") {
+		target = value[1:]
+		if i := strings.Index(target, "/"); i >= 0 {
+			target, cidr = target[:i], target[i:]
+		}
+		target = c.expand(target, domain)
+	} else {
+		cidr = value
+	}
+
+	switch strings.ToLower(name) {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		return c.matchIP(strings.TrimPrefix(value, ":")), nil
+	case "a":
+		if err := c.count(); err != nil {
+			return false, err
+		}
+		return c.matchA(target, cidr)
+	case "mx":
+		if err := c.count(); err != nil {
+			return false, err
+		}
+
+		mx, err := c.resolver.LookupMX(target)
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		for _, m := range mx {
+			if ok, err := c.matchA(strings.TrimSuffix(m.Host, "."), cidr); ok || err != nil {
+				return ok, err
+			}
+		}
+
+		return false, nil
+	case "include":
+		if err := c.count(); err != nil {
+			return false, err
+		}
+
+		status, err := c.check(target)
+		switch status {
+		case AuthPass:
+			return true, nil
+		case AuthFail, AuthSoftFail, AuthNeutral:
+			return false, nil
+		case AuthNone:
+			return false, fmt.Errorf("SPF include %s has no record", target)
+		}
+
+		return false, err
+	case "exists":
+		if err := c.count(); err != nil {
+			return false, err
+		}
+
+		ips, err := c.resolver.LookupIP(target)
+		if err != nil && !isNotFound(err) {
+			return false, err
+		}
+
+		return len(ips) > 0, nil
+	case "ptr":
+		//ptr is deprecated and never matches here
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Unknown SPF mechanism %s", name)
+}
+
+func (c *spfChecker) matchA(host, cidr string) (bool, error) {
+	ips, err := c.resolver.LookupIP(host)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	ip4Bits, ip6Bits := 32, 128
+
+	if len(cidr) > 0 {
+		parts := strings.Split(strings.TrimPrefix(cidr, "/"), "//")
+
+		if n, err := strconv.Atoi(parts[0]); err == nil && len(parts[0]) > 0 {
+			ip4Bits = n
+		}
+
+		if len(parts) > 1 {
+			if n, err := strconv.Atoi(parts[1]); err == nil {
+				ip6Bits = n
+			}
+		}
+	}
+
+	for _, ip := range ips {
+		bits, size := ip6Bits, 128
+		if ip.To4() != nil {
+			bits, size = ip4Bits, 32
+		}
+
+		network := &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, size)}
+		if network.Contains(c.ip) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *spfChecker) matchIP(value string) bool {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		return ip != nil && ip.Equal(c.ip)
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return false
+	}
+
+	return network.Contains(c.ip)
+}
+
+func (c *spfChecker) record(domain string) (string, error) {
+	txt, err := c.resolver.LookupTXT(domain)
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var record string
+
+	for _, t := range txt {
+		if strings.EqualFold(t, "v=spf1") || strings.HasPrefix(strings.ToLower(t), "v=spf1 ") {
+			if len(record) > 0 {
+				return "", errSPFMultiple
+			}
+			record = t
+		}
+	}
+
+	return record, nil
+}
+
+func (c *spfChecker) count() error {
+	c.lookups++
+
+	if c.lookups > spfLookupLimit {
+		return errSPFLookupLimit
+	}
+
+	return nil
+}
+
+//DNS failures are temporary, everything else is a broken policy
+func (c *spfChecker) lookupStatus(err error) string {
+	if _, ok := err.(*net.DNSError); ok {
+		return AuthTempError
+	}
+
+	return AuthPermError
+}
+
+//Expands the most common SPF macros, transformers are not supported
+func (c *spfChecker) expand(s, domain string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	local, senderDomain := "postmaster", domain
+	if i := strings.LastIndex(c.sender, "@"); i >= 0 {
+		local, senderDomain = c.sender[:i], c.sender[i+1:]
+	}
+
+	ip := c.ip.String()
+	if ip4 := c.ip.To4(); ip4 != nil {
+		ip = ip4.String()
+	}
+
+	r := strings.NewReplacer(
+		"%{s}", c.sender,
+		"%{l}", local,
+		"%{o}", senderDomain,
+		"%{d}", domain,
+		"%{i}", ip,
+		"%{h}", senderDomain,
+		"%%", "%",
+		"%_", " ",
+		"%-", "%20",
+	)
+
+	return r.Replace(s)
+}
@@ -0,0 +1,95 @@
+package email
+
+import (
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+const (
+	SuppressionUnsubscribe = "unsubscribe"
+	SuppressionComplaint   = "complaint"
+	SuppressionHardBounce  = "hard_bounce"
+	SuppressionManual      = "manual"
+)
+
+var ErrAllRecipientsSuppressed = errors.New("All recipients of the message are suppressed")
+
+//Addresses which must not receive messages from the account
+type Suppressions interface {
+	Suppress(key, address, reason string) error
+
+	IsSuppressed(key, address string) bool
+}
+
+//Suppressions kept in memory
+type SuppressionList struct {
+	mutex     sync.RWMutex
+	addresses map[string]map[string]string
+}
+
+func NewSuppressionList() *SuppressionList {
+	return &SuppressionList{
+		addresses: make(map[string]map[string]string),
+	}
+}
+
+func (s *SuppressionList) Suppress(key, address, reason string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a, ok := s.addresses[key]
+	if !ok {
+		a = make(map[string]string)
+		s.addresses[key] = a
+	}
+
+	a[strings.ToLower(address)] = reason
+
+	return nil
+}
+
+func (s *SuppressionList) IsSuppressed(key, address string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.addresses[key][strings.ToLower(address)]
+
+	return ok
+}
+
+//Sets suppressions checked before the message is handed to SMTP
+func (e *Email) SetSuppressions(suppressions Suppressions) {
+	e.suppressions = suppressions
+}
+
+//Envelope recipients without suppressed addresses
+func (e *Email) deliverable(config *Config, recipients []string) ([]string, error) {
+	if e.suppressions == nil {
+		return recipients, nil
+	}
+
+	allowed := make([]string, 0, len(recipients))
+
+	for _, r := range recipients {
+		address := strings.TrimSpace(r)
+		if a, err := mail.ParseAddress(address); err == nil {
+			address = a.Address
+		}
+
+		if e.suppressions.IsSuppressed(config.Key, address) {
+			log.Printf("Recipient %s is suppressed, client key %s", address, config.Key)
+			continue
+		}
+
+		allowed = append(allowed, r)
+	}
+
+	if len(allowed) == 0 {
+		return nil, ErrAllRecipientsSuppressed
+	}
+
+	return allowed, nil
+}
@@ -0,0 +1,327 @@
+package email
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrThreadNotFound = errors.New("Thread was not found")
+
+	subjectPrefix = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|wg|sv|odp|pd|tr)(\[\d+\])?\s*:|\[[^\]]*\])\s*`)
+)
+
+type Thread struct {
+	ID       string           `json:"id"`
+	Subject  string           `json:"subject"`
+	Updated  time.Time        `json:"updated"`
+	Messages []*ThreadMessage `json:"messages"`
+}
+
+type ThreadMessage struct {
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id,omitempty"`
+	Subject  string    `json:"subject"`
+	Sender   string    `json:"sender"`
+	Date     time.Time `json:"date"`
+}
+
+//Node of the JWZ threading tree, message is nil for messages only known from references
+type threadContainer struct {
+	id       string
+	threadID string
+	message  *ThreadMessage
+	parent   *threadContainer
+	children []*threadContainer
+}
+
+//Groups messages into conversations using JWZ algorithm (https://www.jwz.org/doc/threading.html)
+type Threader struct {
+	mutex      sync.Mutex
+	containers map[string]*threadContainer
+	subjects   map[string]*threadContainer
+	aliases    map[string]string
+}
+
+func NewThreader() *Threader {
+	return &Threader{
+		containers: make(map[string]*threadContainer),
+		subjects:   make(map[string]*threadContainer),
+		aliases:    make(map[string]string),
+	}
+}
+
+//Adds message to its thread and returns the thread ID
+func (t *Threader) Add(m *MessageInfo) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	id := m.MessageId()
+	if len(id) == 0 {
+		sum := sha1.Sum(m.Raw())
+		id = hex.EncodeToString(sum[:])
+	}
+
+	c := t.container(id)
+
+	//duplicated delivery of the same message
+	if c.message != nil {
+		m.threadID = t.threadID(c)
+		return m.threadID
+	}
+
+	date, err := m.message.Header.Date()
+	if err != nil {
+		date = time.Now()
+	}
+
+	c.message = &ThreadMessage{
+		ID:      id,
+		Subject: m.Subject(),
+		Sender:  m.Sender().Address,
+		Date:    date,
+	}
+
+	references := m.References()
+	for _, r := range m.InReplyTo() {
+		if len(references) == 0 || references[len(references)-1] != r {
+			references = append(references, r)
+		}
+	}
+
+	var parent *threadContainer
+
+	for _, r := range references {
+		rc := t.container(r)
+
+		if parent != nil && rc.parent == nil && rc != parent && !rc.isAncestorOf(parent) {
+			t.link(rc, parent)
+		}
+
+		parent = rc
+	}
+
+	//own references of the message are more reliable than guessed earlier
+	if parent != nil && parent != c && !c.isAncestorOf(parent) {
+		c.unlink()
+		t.link(c, parent)
+	}
+
+	subject, reply := normalizeSubject(c.message.Subject)
+
+	if c.parent == nil && len(subject) > 0 {
+		if root, ok := t.subjects[subject]; ok && reply && root.root() != c {
+			t.link(c, root.root())
+		} else if !ok {
+			t.subjects[subject] = c.root()
+		}
+	}
+
+	m.threadID = t.threadID(c)
+
+	return m.threadID
+}
+
+//All threads ordered by the latest message
+func (t *Threader) Threads() []*Thread {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	threads := make([]*Thread, 0)
+
+	for _, c := range t.containers {
+		if c.parent != nil {
+			continue
+		}
+
+		if thread := t.thread(c); len(thread.Messages) > 0 {
+			threads = append(threads, thread)
+		}
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].Updated.After(threads[j].Updated)
+	})
+
+	return threads
+}
+
+//Thread with the ID, IDs of threads merged into another one are resolved too
+func (t *Threader) Thread(id string) (*Thread, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i := 0; i < len(t.aliases); i++ {
+		alias, ok := t.aliases[id]
+		if !ok {
+			break
+		}
+
+		id = alias
+	}
+
+	for _, c := range t.containers {
+		if c.parent == nil && c.threadID == id {
+			return t.thread(c), nil
+		}
+	}
+
+	return nil, ErrThreadNotFound
+}
+
+func (t *Threader) thread(root *threadContainer) *Thread {
+	thread := &Thread{
+		ID:       t.threadID(root),
+		Messages: make([]*ThreadMessage, 0),
+	}
+
+	root.walk(func(c *threadContainer) {
+		if c.message == nil {
+			return
+		}
+
+		m := *c.message
+		if p := c.parentMessage(); p != nil {
+			m.ParentID = p.id
+		}
+
+		thread.Messages = append(thread.Messages, &m)
+	})
+
+	sort.SliceStable(thread.Messages, func(i, j int) bool {
+		return thread.Messages[i].Date.Before(thread.Messages[j].Date)
+	})
+
+	if len(thread.Messages) > 0 {
+		thread.Subject = thread.Messages[0].Subject
+		thread.Updated = thread.Messages[len(thread.Messages)-1].Date
+	}
+
+	return thread
+}
+
+func (t *Threader) container(id string) *threadContainer {
+	c, ok := t.containers[id]
+	if !ok {
+		c = &threadContainer{id: id}
+		t.containers[id] = c
+	}
+
+	return c
+}
+
+//Thread ID of the container tree, assigned once so it does not change when messages are added
+func (t *Threader) threadID(c *threadContainer) string {
+	root := c.root()
+
+	if len(root.threadID) == 0 {
+		sum := sha1.Sum([]byte(root.id))
+		root.threadID = hex.EncodeToString(sum[:10])
+	}
+
+	return root.threadID
+}
+
+func (t *Threader) link(child, parent *threadContainer) {
+	oldRoot, newRoot := child.root(), parent.root()
+
+	child.parent = parent
+	parent.children = append(parent.children, child)
+
+	if oldRoot == newRoot || len(oldRoot.threadID) == 0 {
+		return
+	}
+
+	//merged thread keeps the ID known to clients or redirects to the new one
+	if len(newRoot.threadID) == 0 {
+		newRoot.threadID = oldRoot.threadID
+	} else if oldRoot.threadID != newRoot.threadID {
+		t.aliases[oldRoot.threadID] = newRoot.threadID
+	}
+
+	oldRoot.threadID = ""
+}
+
+func (c *threadContainer) unlink() {
+	if c.parent == nil {
+		return
+	}
+
+	siblings := c.parent.children
+	for i, s := range siblings {
+		if s == c {
+			c.parent.children = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	c.parent = nil
+}
+
+func (c *threadContainer) root() *threadContainer {
+	for c.parent != nil {
+		c = c.parent
+	}
+
+	return c
+}
+
+func (c *threadContainer) isAncestorOf(other *threadContainer) bool {
+	for p := other; p != nil; p = p.parent {
+		if p == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Closest ancestor holding a message
+func (c *threadContainer) parentMessage() *threadContainer {
+	for p := c.parent; p != nil; p = p.parent {
+		if p.message != nil {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (c *threadContainer) walk(fn func(c *threadContainer)) {
+	fn(c)
+
+	for _, child := range c.children {
+		child.walk(fn)
+	}
+}
+
+//Removes reply and forward prefixes, returns true when any was found
+func normalizeSubject(subject string) (string, bool) {
+	reply := false
+
+	for {
+		loc := subjectPrefix.FindStringIndex(subject)
+		if loc == nil {
+			break
+		}
+
+		if !strings.HasPrefix(strings.TrimSpace(subject), "[") {
+			reply = true
+		}
+
+		subject = subject[loc[1]:]
+	}
+
+	return strings.ToLower(strings.Join(strings.Fields(subject), " ")), reply
+}
+
+//Thread ID assigned by Threader, empty when message was not threaded
+func (m *MessageInfo) ThreadID() string {
+	return m.threadID
+}
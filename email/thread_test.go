@@ -0,0 +1,92 @@
+package email
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func threadTestMessage(t *testing.T, id, subject, date string, references ...string) *MessageInfo {
+	raw := fmt.Sprintf("From: sender.gopher@golang.org\r\nSubject: %s\r\nDate: %s\r\nMessage-ID: <%s>\r\n", subject, date, id)
+
+	if len(references) > 0 {
+		raw += fmt.Sprintf("In-Reply-To: <%s>\r\n", references[len(references)-1])
+		raw += "References:"
+		for _, r := range references {
+			raw += fmt.Sprintf(" <%s>", r)
+		}
+		raw += "\r\n"
+	}
+
+	return newTestMessageInfo(t, []byte(raw+"\r\nText\r\n"))
+}
+
+func TestThreader(t *testing.T) {
+	th := NewThreader()
+
+	reply := threadTestMessage(t, "2@golang.org", "Re: Release", "Tue, 16 Mar 2021 10:00:00 +0000", "1@golang.org")
+	second := threadTestMessage(t, "3@golang.org", "Re: Re: Release", "Wed, 17 Mar 2021 10:00:00 +0000", "1@golang.org", "2@golang.org")
+	root := threadTestMessage(t, "1@golang.org", "Release", "Mon, 15 Mar 2021 10:00:00 +0000")
+	other := threadTestMessage(t, "4@golang.org", "Other", "Mon, 15 Mar 2021 11:00:00 +0000")
+	bySubject := threadTestMessage(t, "5@golang.org", "RE: [golang] release", "Thu, 18 Mar 2021 10:00:00 +0000")
+
+	id := th.Add(reply)
+	assert.NotEmpty(t, id)
+
+	assert.Equal(t, id, th.Add(second))
+	assert.Equal(t, id, th.Add(root))
+	assert.NotEqual(t, id, th.Add(other))
+	assert.Equal(t, id, th.Add(bySubject))
+	assert.Equal(t, id, root.ThreadID())
+
+	threads := th.Threads()
+	if assert.Len(t, threads, 2) {
+		assert.Equal(t, id, threads[0].ID)
+	}
+
+	thread, err := th.Thread(id)
+	if assert.NoError(t, err) && assert.Len(t, thread.Messages, 4) {
+		assert.Equal(t, "Release", thread.Subject)
+		assert.Equal(t, "1@golang.org", thread.Messages[0].ID)
+		assert.Equal(t, "1@golang.org", thread.Messages[1].ParentID)
+		assert.Equal(t, "2@golang.org", thread.Messages[2].ParentID)
+	}
+
+	_, err = th.Thread("missing")
+	assert.Equal(t, ErrThreadNotFound, err)
+}
+
+func TestThreaderMerge(t *testing.T) {
+	th := NewThreader()
+
+	first := threadTestMessage(t, "b@golang.org", "Plan", "Mon, 15 Mar 2021 10:00:00 +0000")
+	second := threadTestMessage(t, "c@golang.org", "Budget", "Mon, 15 Mar 2021 11:00:00 +0000")
+
+	firstID, secondID := th.Add(first), th.Add(second)
+	assert.NotEqual(t, firstID, secondID)
+
+	//reply references both conversations
+	merge := threadTestMessage(t, "d@golang.org", "Re: Plan", "Mon, 15 Mar 2021 12:00:00 +0000", "b@golang.org", "c@golang.org")
+	id := th.Add(merge)
+
+	assert.Len(t, th.Threads(), 1)
+
+	for _, old := range []string{firstID, secondID} {
+		thread, err := th.Thread(old)
+		if assert.NoError(t, err) {
+			assert.Equal(t, id, thread.ID)
+			assert.Len(t, thread.Messages, 3)
+		}
+	}
+}
+
+func TestNormalizeSubject(t *testing.T) {
+	s, reply := normalizeSubject("Re: AW: [list]  Fwd:   Hello  World")
+	assert.Equal(t, "hello world", s)
+	assert.True(t, reply)
+
+	s, reply = normalizeSubject("[list] Hello")
+	assert.Equal(t, "hello", s)
+	assert.False(t, reply)
+}
@@ -0,0 +1,567 @@
+package email
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf16"
+)
+
+const TNEFMimeType = "application/ms-tnef"
+
+const tnefSignature = 0x223e9f78
+
+//TNEF attributes (MS-OXTNEF 2.1.3)
+const (
+	attBody         = 0x0002800c
+	attAttachData   = 0x0006800f
+	attAttachTitle  = 0x00018010
+	attAttachRend   = 0x00069002
+	attMsgProps     = 0x00069003
+	attAttachment   = 0x00069005
+	attOemCodepage  = 0x00069007
+	tnefLevelAttach = 0x02
+)
+
+//MAPI property tags (MS-OXPROPS)
+const (
+	prBody             = 0x1000
+	prRTFCompressed    = 0x1009
+	prBodyHTML         = 0x1013
+	prAttachDataObj    = 0x3701
+	prAttachFilename   = 0x3704
+	prAttachLongName   = 0x3707
+	prAttachMimeTag    = 0x370e
+	prAttachContentID  = 0x3712
+	mapiMultiValueFlag = 0x1000
+)
+
+//MAPI property types
+const (
+	ptShort    = 0x0002
+	ptLong     = 0x0003
+	ptFloat    = 0x0004
+	ptDouble   = 0x0005
+	ptCurrency = 0x0006
+	ptAppTime  = 0x0007
+	ptError    = 0x000a
+	ptBoolean  = 0x000b
+	ptObject   = 0x000d
+	ptI8       = 0x0014
+	ptString8  = 0x001e
+	ptUnicode  = 0x001f
+	ptSysTime  = 0x0040
+	ptCLSID    = 0x0048
+	ptBinary   = 0x0102
+)
+
+//Dictionary preloaded before LZFu decompression (MS-OXRTFCP 2.1.2.1)
+const rtfPrebuf = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+var (
+	ErrTNEFSignature = errors.New("Data is not TNEF encoded")
+	ErrTNEFTruncated = errors.New("TNEF data is truncated")
+)
+
+//Content of winmail.dat sent by Outlook
+type TNEF struct {
+	Body        []byte
+	BodyHTML    []byte
+	BodyRTF     []byte
+	Attachments []*TNEFAttachment
+	codepage    int
+}
+
+type TNEFAttachment struct {
+	Name        string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+type mapiProperty struct {
+	tag    uint16
+	kind   uint16
+	values [][]byte
+}
+
+//Decodes TNEF stream (MS-OXTNEF)
+func DecodeTNEF(data []byte) (*TNEF, error) {
+	r := &tnefReader{data: data}
+
+	if sig, err := r.uint32(); err != nil || sig != tnefSignature {
+		return nil, ErrTNEFSignature
+	}
+
+	//legacy key
+	if _, err := r.bytes(2); err != nil {
+		return nil, ErrTNEFTruncated
+	}
+
+	t := &TNEF{
+		Attachments: make([]*TNEFAttachment, 0),
+	}
+
+	var attachment *TNEFAttachment
+
+	for r.len() > 0 {
+		level, err := r.bytes(1)
+		if err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		id, err := r.uint32()
+		if err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		length, err := r.uint32()
+		if err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		value, err := r.bytes(int(length))
+		if err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		//checksum
+		if _, err := r.bytes(2); err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		if id == attAttachRend {
+			attachment = &TNEFAttachment{}
+			t.Attachments = append(t.Attachments, attachment)
+			continue
+		}
+
+		if level[0] == tnefLevelAttach && attachment != nil {
+			if err := t.attachmentAttribute(attachment, id, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := t.messageAttribute(id, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func (t *TNEF) messageAttribute(id uint32, value []byte) error {
+	switch id {
+	case attOemCodepage:
+		if len(value) >= 4 {
+			t.codepage = int(binary.LittleEndian.Uint32(value))
+		}
+	case attBody:
+		if len(t.Body) == 0 {
+			t.Body = t.string8(value)
+		}
+	case attMsgProps:
+		props, err := parseMAPIProperties(value)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range props {
+			switch p.tag {
+			case prBody:
+				t.Body = t.propertyString(p)
+			case prBodyHTML:
+				t.BodyHTML = p.value()
+			case prRTFCompressed:
+				rtf, err := decompressRTF(p.value())
+				if err != nil {
+					log.Printf("Could not decompress TNEF RTF body due to: %s", err)
+					continue
+				}
+				t.BodyRTF = rtf
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *TNEF) attachmentAttribute(a *TNEFAttachment, id uint32, value []byte) error {
+	switch id {
+	case attAttachTitle:
+		if len(a.Name) == 0 {
+			a.Name = string(t.string8(value))
+		}
+	case attAttachData:
+		a.Data = value
+	case attAttachment:
+		props, err := parseMAPIProperties(value)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range props {
+			switch p.tag {
+			case prAttachLongName:
+				a.Name = string(t.propertyString(p))
+			case prAttachFilename:
+				if len(a.Name) == 0 {
+					a.Name = string(t.propertyString(p))
+				}
+			case prAttachMimeTag:
+				a.ContentType = strings.ToLower(string(t.propertyString(p)))
+			case prAttachContentID:
+				a.ContentID = strings.Trim(string(t.propertyString(p)), "<> ")
+			case prAttachDataObj:
+				if len(a.Data) == 0 && p.kind == ptBinary {
+					a.Data = p.value()
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+//Text of string property converted to UTF-8
+func (t *TNEF) propertyString(p *mapiProperty) []byte {
+	if p.kind == ptUnicode {
+		return utf16String(p.value())
+	}
+
+	return t.string8(p.value())
+}
+
+//8-bit string encoded with the message code page
+func (t *TNEF) string8(value []byte) []byte {
+	value = bytes.TrimRight(value, "\x00")
+
+	if t.codepage == 0 || t.codepage == 65001 || t.codepage == 20127 {
+		return value
+	}
+
+	dec, err := toUTF8(fmt.Sprintf("windows-%d", t.codepage), value)
+	if err != nil {
+		return value
+	}
+
+	return dec
+}
+
+func (p *mapiProperty) value() []byte {
+	if len(p.values) == 0 {
+		return nil
+	}
+
+	return p.values[0]
+}
+
+func utf16String(b []byte) []byte {
+	u := make([]uint16, 0, len(b)/2)
+
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(b[i:]))
+	}
+
+	return []byte(strings.TrimRight(string(utf16.Decode(u)), "\x00"))
+}
+
+//Parses MAPI property list of attMsgProps and attAttachment attributes (MS-OXTNEF 2.1.3.5)
+func parseMAPIProperties(data []byte) ([]*mapiProperty, error) {
+	r := &tnefReader{data: data}
+
+	count, err := r.uint32()
+	if err != nil {
+		return nil, ErrTNEFTruncated
+	}
+
+	props := make([]*mapiProperty, 0)
+
+	for i := uint32(0); i < count; i++ {
+		kind, err := r.uint16()
+		if err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		tag, err := r.uint16()
+		if err != nil {
+			return nil, ErrTNEFTruncated
+		}
+
+		//named properties are followed by GUID and name
+		if tag >= 0x8000 {
+			if err := r.skipPropertyName(); err != nil {
+				return nil, err
+			}
+		}
+
+		p := &mapiProperty{
+			tag:  tag,
+			kind: kind &^ mapiMultiValueFlag,
+		}
+
+		if p.values, err = r.propertyValues(p.kind, kind&mapiMultiValueFlag != 0); err != nil {
+			return nil, err
+		}
+
+		props = append(props, p)
+	}
+
+	return props, nil
+}
+
+type tnefReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *tnefReader) len() int {
+	return len(r.data) - r.pos
+}
+
+func (r *tnefReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > r.len() {
+		return nil, ErrTNEFTruncated
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+
+	return b, nil
+}
+
+func (r *tnefReader) uint16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (r *tnefReader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *tnefReader) skipPropertyName() error {
+	if _, err := r.bytes(16); err != nil {
+		return err
+	}
+
+	kind, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	if kind == 0 {
+		_, err := r.uint32()
+		return err
+	}
+
+	length, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.bytes(padded(int(length)))
+
+	return err
+}
+
+func (r *tnefReader) propertyValues(kind uint16, multi bool) ([][]byte, error) {
+	size := 0
+
+	switch kind {
+	case ptShort, ptLong, ptFloat, ptError, ptBoolean:
+		size = 4
+	case ptDouble, ptCurrency, ptAppTime, ptI8, ptSysTime:
+		size = 8
+	case ptCLSID:
+		size = 16
+	case ptString8, ptUnicode, ptBinary, ptObject:
+		//variable length values are always preceded by the count
+		multi = true
+	default:
+		return nil, fmt.Errorf("Unsupported MAPI property type 0x%04x", kind)
+	}
+
+	count := uint32(1)
+	if multi {
+		var err error
+		if count, err = r.uint32(); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([][]byte, 0)
+
+	for i := uint32(0); i < count; i++ {
+		if size > 0 {
+			v, err := r.bytes(size)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, v)
+			continue
+		}
+
+		length, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := r.bytes(int(length))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := r.bytes(padded(int(length)) - int(length)); err != nil {
+			return nil, err
+		}
+
+		//embedded object starts with interface identifier
+		if kind == ptObject && len(v) >= 16 {
+			v = v[16:]
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+func padded(n int) int {
+	return (n + 3) &^ 3
+}
+
+//Decompresses PR_RTF_COMPRESSED property (MS-OXRTFCP)
+func decompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, ErrTNEFTruncated
+	}
+
+	compSize := int(binary.LittleEndian.Uint32(data[0:]))
+	rawSize := int(binary.LittleEndian.Uint32(data[4:]))
+	compType := string(data[8:12])
+
+	end := compSize + 4
+	if end > len(data) {
+		end = len(data)
+	}
+
+	src := data[16:end]
+
+	switch compType {
+	case "MELA":
+		if rawSize < len(src) {
+			src = src[:rawSize]
+		}
+		return src, nil
+	case "LZFu":
+	default:
+		return nil, fmt.Errorf("Unknown RTF compression %q", compType)
+	}
+
+	dict := make([]byte, 4096)
+	copy(dict, rtfPrebuf)
+	write := len(rtfPrebuf)
+
+	out := make([]byte, 0, rawSize)
+
+	for i := 0; i < len(src); {
+		control := src[i]
+		i++
+
+		for bit := uint(0); bit < 8 && i < len(src); bit++ {
+			if control&(1<<bit) == 0 {
+				out = append(out, src[i])
+				dict[write] = src[i]
+				write = (write + 1) % len(dict)
+				i++
+				continue
+			}
+
+			if i+1 >= len(src) {
+				return nil, ErrTNEFTruncated
+			}
+
+			ref := int(src[i])<<8 | int(src[i+1])
+			i += 2
+
+			offset, length := ref>>4, ref&0xf+2
+			if offset == write {
+				return out, nil
+			}
+
+			for j := 0; j < length; j++ {
+				b := dict[(offset+j)%len(dict)]
+				out = append(out, b)
+				dict[write] = b
+				write = (write + 1) % len(dict)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func isTNEF(mediatype, filename string) bool {
+	return mediatype == TNEFMimeType || mediatype == "application/vnd.ms-tnef" ||
+		strings.EqualFold(filename, "winmail.dat")
+}
+
+//Replaces winmail.dat with the files and body it carries
+func (m *MessageInfo) putTNEF(part *Part) error {
+	t, err := DecodeTNEF(part.Data)
+	if err != nil {
+		log.Printf("Could not decode TNEF attached to %s due to: %s", m.MessageId(), err)
+		return m.putFile(part)
+	}
+
+	for _, a := range t.Attachments {
+		p := &Part{
+			ContentType: a.ContentType,
+			FileName:    a.Name,
+			ContentID:   a.ContentID,
+			Data:        a.Data,
+			Size:        len(a.Data),
+		}
+
+		if len(p.ContentType) == 0 {
+			p.ContentType = "application/octet-stream"
+		}
+
+		if err := m.putFile(p); err != nil {
+			return err
+		}
+	}
+
+	if len(t.Body) > 0 {
+		if err := m.putContent(&Part{ContentType: "text/plain", Data: t.Body}); err != nil {
+			return err
+		}
+	}
+
+	if len(t.BodyHTML) > 0 {
+		if err := m.putContent(&Part{ContentType: "text/html", Data: t.BodyHTML}); err != nil {
+			return err
+		}
+	}
+
+	//RTF could not be presented as message text so it is attached
+	if len(t.BodyRTF) > 0 {
+		return m.putFile(&Part{ContentType: "application/rtf", FileName: "body.rtf", Data: t.BodyRTF})
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tnefAttribute(level byte, id uint32, value []byte) []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte(level)
+	binary.Write(b, binary.LittleEndian, id)
+	binary.Write(b, binary.LittleEndian, uint32(len(value)))
+	b.Write(value)
+
+	sum := uint16(0)
+	for _, v := range value {
+		sum += uint16(v)
+	}
+	binary.Write(b, binary.LittleEndian, sum)
+
+	return b.Bytes()
+}
+
+func mapiProperties(props map[uint32][]byte) []byte {
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.LittleEndian, uint32(len(props)))
+
+	for tag, value := range props {
+		binary.Write(b, binary.LittleEndian, tag)
+		binary.Write(b, binary.LittleEndian, uint32(1))
+		binary.Write(b, binary.LittleEndian, uint32(len(value)))
+		b.Write(value)
+		b.Write(make([]byte, padded(len(value))-len(value)))
+	}
+
+	return b.Bytes()
+}
+
+func unicodeValue(s string) []byte {
+	b := &bytes.Buffer{}
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		binary.Write(b, binary.LittleEndian, u)
+	}
+
+	return b.Bytes()
+}
+
+func createTestTNEF() []byte {
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.LittleEndian, uint32(tnefSignature))
+	binary.Write(b, binary.LittleEndian, uint16(0x0001))
+
+	b.Write(tnefAttribute(1, attMsgProps, mapiProperties(map[uint32][]byte{
+		prBody<<16 | ptUnicode:    unicodeValue("Zażółć in plain text"),
+		prBodyHTML<<16 | ptBinary: []byte("<p>Html body</p>"),
+	})))
+
+	b.Write(tnefAttribute(tnefLevelAttach, attAttachRend, make([]byte, 14)))
+	b.Write(tnefAttribute(tnefLevelAttach, attAttachTitle, []byte("REPORT~1.TXT\x00")))
+	b.Write(tnefAttribute(tnefLevelAttach, attAttachData, []byte("Quarterly report")))
+	b.Write(tnefAttribute(tnefLevelAttach, attAttachment, mapiProperties(map[uint32][]byte{
+		prAttachLongName<<16 | ptUnicode: unicodeValue("quarterly report.txt"),
+		prAttachMimeTag<<16 | ptString8:  []byte("text/plain\x00"),
+	})))
+
+	return b.Bytes()
+}
+
+func TestDecodeTNEF(t *testing.T) {
+	tnef, err := DecodeTNEF(createTestTNEF())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Zażółć in plain text", string(tnef.Body))
+	assert.Equal(t, "<p>Html body</p>", string(tnef.BodyHTML))
+
+	if assert.Len(t, tnef.Attachments, 1) {
+		assert.Equal(t, "quarterly report.txt", tnef.Attachments[0].Name)
+		assert.Equal(t, "text/plain", tnef.Attachments[0].ContentType)
+		assert.Equal(t, "Quarterly report", string(tnef.Attachments[0].Data))
+	}
+
+	_, err = DecodeTNEF([]byte("not tnef"))
+	assert.Equal(t, ErrTNEFSignature, err)
+
+	_, err = DecodeTNEF(createTestTNEF()[:40])
+	assert.Equal(t, ErrTNEFTruncated, err)
+}
+
+func TestDecompressRTF(t *testing.T) {
+	//example from MS-OXRTFCP 3.1.1
+	compressed := []byte{
+		0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+		0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+		0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+		0xa0,
+	}
+
+	rtf, err := decompressRTF(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n", string(rtf))
+}
+
+func TestParseWinmailDat(t *testing.T) {
+	raw := "From: Outlook <sender.gopher@golang.org>\r\n" +
+		"Subject: Report\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"Plain text\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/ms-tnef; name=\"winmail.dat\"\r\n" +
+		"Content-Disposition: attachment; filename=\"winmail.dat\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(createTestTNEF()) + "\r\n" +
+		"--outer--\r\n"
+
+	mi := newTestMessageInfo(t, []byte(raw))
+
+	if err := mi.ParseBody(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, mi.Files(), 1) {
+		assert.Equal(t, "quarterly report.txt", mi.Files()[0].Name)
+	}
+
+	if assert.Len(t, mi.Contents(), 3) {
+		assert.Equal(t, "Zażółć in plain text", string(mi.Contents()[1].Data))
+		assert.True(t, mi.Contents()[2].HTMLType)
+	}
+}
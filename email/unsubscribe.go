@@ -0,0 +1,102 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidUnsubscribeToken = errors.New("Unsubscribe token is not valid")
+
+//Token identifying account and recipient in one-click unsubscribe URL
+func UnsubscribeToken(secret, key, address string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(key + "\n" + strings.ToLower(address)))
+
+	return payload + "." + unsubscribeSignature(secret, payload)
+}
+
+//Returns account key and address of the token without verifying its signature
+func ParseUnsubscribeToken(token string) (string, string, error) {
+	dot := strings.LastIndex(token, ".")
+	if dot < 0 {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	parts := strings.SplitN(string(payload), "\n", 2)
+	if len(parts) != 2 {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	return parts[0], parts[1], nil
+}
+
+//Checks the token was signed with the secret
+func VerifyUnsubscribeToken(secret, token string) bool {
+	dot := strings.LastIndex(token, ".")
+	if dot < 0 || len(secret) == 0 {
+		return false
+	}
+
+	expected := unsubscribeSignature(secret, token[:dot])
+
+	return hmac.Equal([]byte(expected), []byte(token[dot+1:]))
+}
+
+func unsubscribeSignature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//Sets List-Unsubscribe and List-Unsubscribe-Post headers (RFC 2369, RFC 8058) for the recipient
+func (m *Message) SetListUnsubscribe(config *UnsubscribeConfig, key, recipient string) error {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return fmt.Errorf("Bad unsubscribe URL due to: %s", err)
+	}
+
+	query := u.Query()
+	query.Set("token", UnsubscribeToken(config.Secret, key, recipient))
+	u.RawQuery = query.Encode()
+
+	value := fmt.Sprintf("<%s>", u.String())
+
+	if len(config.Mailto) > 0 {
+		value += fmt.Sprintf(", <mailto:%s?subject=unsubscribe>", config.Mailto)
+	}
+
+	m.header.Set(ListUnsubscribeHeader, value)
+	m.header.Set(ListUnsubscribePostHeader, "List-Unsubscribe=One-Click")
+
+	return nil
+}
+
+//Account key and address of the verified one-click unsubscribe token
+func (e *Email) Unsubscribe(token string) (string, string, error) {
+	key, address, err := ParseUnsubscribeToken(token)
+	if err != nil {
+		return "", "", err
+	}
+
+	c, err := e.configByKey(key)
+	if err != nil || c.Key != key || c.Unsubscribe == nil {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	if !VerifyUnsubscribeToken(c.Unsubscribe.Secret, token) {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	return key, address, nil
+}
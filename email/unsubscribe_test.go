@@ -0,0 +1,124 @@
+package email
+
+import (
+	"errors"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	token := UnsubscribeToken("secret", "account", "First.Recipient@golang.org")
+
+	key, address, err := ParseUnsubscribeToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "account", key)
+	assert.Equal(t, firstRecipientEmail, address)
+
+	assert.True(t, VerifyUnsubscribeToken("secret", token))
+	assert.False(t, VerifyUnsubscribeToken("other", token))
+	assert.False(t, VerifyUnsubscribeToken("", token))
+
+	forged := UnsubscribeToken("other", "account", secondRecipientEmail)
+	assert.False(t, VerifyUnsubscribeToken("secret", forged))
+
+	_, _, err = ParseUnsubscribeToken("broken")
+	assert.Equal(t, ErrInvalidUnsubscribeToken, err)
+}
+
+func TestListUnsubscribeHeader(t *testing.T) {
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &UnsubscribeConfig{
+		URL:    "https://mail.golang.org/unsubscribe",
+		Secret: "secret",
+		Mailto: "unsubscribe@golang.org",
+	}
+
+	if err := m.SetListUnsubscribe(c, "account", firstRecipientEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	mb, err := m.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi := newTestMessageInfo(t, mb)
+
+	assert.Equal(t, "List-Unsubscribe=One-Click", mi.Header("List-Unsubscribe-Post"))
+
+	lu := mi.Header("List-Unsubscribe")
+	assert.True(t, strings.HasSuffix(lu, ", <mailto:unsubscribe@golang.org?subject=unsubscribe>"))
+
+	u, err := url.Parse(strings.Trim(strings.Split(lu, ",")[0], "<>"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mail.golang.org", u.Host)
+		assert.True(t, VerifyUnsubscribeToken("secret", u.Query().Get("token")))
+	}
+}
+
+func TestSendWithUnsubscribeReportsDeliveredRecipients(t *testing.T) {
+	defer func(f func(string, smtp.Auth, string, []string, []byte) error) { sendMail = f }(sendMail)
+
+	sent := make([]string, 0)
+
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if to[0] == secondRecipientEmail {
+			return errors.New("Mailbox unavailable")
+		}
+
+		sent = append(sent, to...)
+
+		return nil
+	}
+
+	m, err := createTestMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{
+		Key:         "account",
+		Unsubscribe: &UnsubscribeConfig{URL: "https://mail.golang.org/unsubscribe", Secret: "secret"},
+	}
+
+	err = NewEmail().send(c, m)
+
+	deliveryErr, ok := err.(*DeliveryError)
+	if assert.True(t, ok) {
+		assert.Equal(t, []string{firstRecipientEmail}, deliveryErr.Delivered)
+		assert.Contains(t, deliveryErr.Failed, secondRecipientEmail)
+		assert.Contains(t, err.Error(), "delivered to "+firstRecipientEmail)
+	}
+
+	assert.Equal(t, []string{firstRecipientEmail}, sent)
+
+	//broken configuration is found before any copy is sent
+	sent = sent[:0]
+	c.Unsubscribe = &UnsubscribeConfig{URL: "https://mail.golang.org/%zz"}
+
+	assert.Error(t, NewEmail().send(c, m))
+	assert.Empty(t, sent)
+}
+
+func TestConfigByKeyMatchesExactKey(t *testing.T) {
+	e := &Email{config: []*Config{{Key: "acme"}, {Key: "acme-prod"}}}
+
+	c, err := e.configByKey("acme-prod")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "acme-prod", c.Key)
+	}
+
+	_, err = e.configByKey("acme-pro")
+	assert.Error(t, err)
+
+	_, err = e.configByKey("")
+	assert.Error(t, err)
+}
@@ -5,10 +5,13 @@ go 1.16
 require (
 	github.com/RussellLuo/validating/v2 v2.1.0
 	github.com/bmizerany/pat v0.0.0-20170815010413-6226ea591a40
+	github.com/emersion/go-msgauth v0.6.5
 	github.com/google/uuid v1.2.0
 	github.com/paulrosania/go-charset v0.0.0-20190326053356-55c9d7a5834c
-	github.com/stretchr/testify v1.7.0 // indirect
-	golang.org/x/net v0.0.0-20210415231046-e915ea6b2b7d // indirect
+	github.com/stretchr/testify v1.7.0
+	go.mozilla.org/pkcs7 v0.10.0
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	golang.org/x/net v0.0.0-20210415231046-e915ea6b2b7d
 	golang.org/x/sys v0.0.0-20210419170143-37df388d1f33 // indirect
 	google.golang.org/genproto v0.0.0-20210416161957-9910b6c460de // indirect
 	google.golang.org/grpc v1.37.0
@@ -1,13 +1,20 @@
 package grpc
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io"
-	"log"
+	"fmt"
+	"net/mail"
+	"sort"
+	"time"
 
+	"github.com/rlaskowski/go-email/email"
 	"github.com/rlaskowski/go-email/grpc/protobuf/emailservice"
+	"github.com/rlaskowski/go-email/model"
 	"github.com/rlaskowski/go-email/queue"
+	"github.com/rlaskowski/go-email/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type EmailService struct {
@@ -22,7 +29,13 @@ func NewEmailService(queueBox *queue.QueueBox) *EmailService {
 }
 
 func (e *EmailService) ReceiveMessage(request *emailservice.IncomingMsgRequest, stream emailservice.EmailService_ReceiveMessageServer) error {
-	qb, err := e.queueBox.ReceiveMessage(request.GetKey())
+	//cid: images are linked with attachment URLs of every message by the queue box
+	options, err := email.HTMLFormatOptions(request.GetFormat(), nil)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	qb, err := e.queueBox.ReceiveMessage(request.GetKey(), options...)
 	if err != nil {
 		return err
 	}
@@ -35,30 +48,7 @@ func (e *EmailService) ReceiveMessage(request *emailservice.IncomingMsgRequest,
 			Total:    total,
 		}
 
-		incomingMesssage := &emailservice.IncomingMessage{
-			Id: mi.MessageId(),
-			Address: &emailservice.Address{
-				Name:    mi.Sender().Name,
-				Address: mi.Sender().Address,
-			},
-			Subject: mi.Subject(),
-			Date:    mi.Date(),
-		}
-
-		for _, f := range mi.Files() {
-			file := &emailservice.File{Name: f.Name}
-			r := bytes.NewReader(f.Data)
-			w := bytes.NewBuffer(file.Data)
-
-			n, err := io.Copy(w, r)
-			if err != nil {
-				log.Printf("Couldn't copy data from email file to emailservice file due to: %s", err)
-			}
-
-			log.Printf("Written file data: %d", n)
-
-			incomingMesssage.Files = append(incomingMesssage.Files, file)
-		}
+		incomingMesssage := e.incomingMessage(mi)
 
 		response.MessageNumber = int64(i + 1)
 
@@ -110,6 +100,348 @@ func (e *EmailService) ReceiveMessage(request *emailservice.IncomingMsgRequest,
 
 }
 
+func (e *EmailService) incomingMessage(mi *email.MessageInfo) *emailservice.IncomingMessage {
+	incomingMesssage := &emailservice.IncomingMessage{
+		Id: mi.MessageId(),
+		Address: &emailservice.Address{
+			Name:    mi.Sender().Name,
+			Address: mi.Sender().Address,
+		},
+		Subject:        mi.Subject(),
+		Date:           mi.Date(),
+		Authentication: e.authentication(mi.Authentication()),
+		To:             e.addresses(mi.To()),
+		Cc:             e.addresses(mi.Cc()),
+		ReplyTo:        e.addresses(mi.ReplyTo()),
+		InReplyTo:      mi.InReplyTo(),
+		References:     mi.References(),
+		ListId:         mi.ListID(),
+		ThreadId:       mi.ThreadID(),
+		Bounce:         e.bounce(mi.Bounce()),
+		Classification: e.classification(mi.Classification()),
+	}
+
+	headers := mi.Headers()
+	names := make([]string, 0, len(headers))
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		incomingMesssage.Headers = append(incomingMesssage.Headers, &emailservice.Header{
+			Name:   name,
+			Values: headers[name],
+		})
+	}
+
+	for _, c := range mi.Contents() {
+		incomingMesssage.Contents = append(incomingMesssage.Contents, &emailservice.Content{
+			HtmlType: c.HTMLType,
+			Data:     c.Data,
+		})
+	}
+
+	for _, f := range mi.Files() {
+		incomingMesssage.Files = append(incomingMesssage.Files, &emailservice.File{
+			Name: f.Name,
+			Data: f.Data,
+		})
+	}
+
+	for _, nested := range mi.Messages() {
+		incomingMesssage.Messages = append(incomingMesssage.Messages, e.incomingMessage(nested))
+	}
+
+	return incomingMesssage
+}
+
+//Queues message, the Message-ID of the first request is returned for repeated idempotency key
+func (e *EmailService) SendMessage(ctx context.Context, request *emailservice.SendMessageRequest) (*emailservice.SendMessageResponse, error) {
+	message := &model.Message{
+		Key:     request.GetKey(),
+		Sender:  request.GetSender(),
+		To:      request.GetTo(),
+		Cc:      request.GetCc(),
+		Bcc:     request.GetBcc(),
+		Subject: request.GetSubject(),
+		Text:    request.GetText(),
+		HTML:    request.GetHtml(),
+	}
+
+	if len(request.GetSendAt()) > 0 {
+		sendAt, err := time.Parse(time.RFC3339, request.GetSendAt())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Could not parse send_at due to: %s", err))
+		}
+
+		message.SendAt = &sendAt
+	}
+
+	for _, a := range request.GetAttachments() {
+		message.Attachments = append(message.Attachments, &model.Attachment{
+			Name:        a.GetName(),
+			ContentType: a.GetContentType(),
+			ContentID:   a.GetContentId(),
+			Data:        a.GetData(),
+		})
+	}
+
+	if err := message.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	id, replayed, err := e.queueBox.Send(message, request.GetIdempotencyKey())
+	switch err {
+	case nil:
+	case store.ErrIdempotencyKeyReused:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case store.ErrIdempotencyInProgress:
+		return nil, status.Error(codes.Aborted, err.Error())
+	default:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	response := &emailservice.SendMessageResponse{
+		MessageId: id,
+		Status:    "queued",
+		Replayed:  replayed,
+	}
+
+	if message.SendAt != nil {
+		response.Status = "scheduled"
+		response.SendAt = message.SendAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return response, nil
+}
+
+func (e *EmailService) ListScheduled(ctx context.Context, request *emailservice.ScheduledListRequest) (*emailservice.ScheduledListResponse, error) {
+	response := &emailservice.ScheduledListResponse{}
+
+	for _, m := range e.queueBox.Scheduled(request.GetKey()) {
+		response.Messages = append(response.Messages, e.scheduled(m))
+	}
+
+	return response, nil
+}
+
+func (e *EmailService) RescheduleMessage(ctx context.Context, request *emailservice.RescheduleRequest) (*emailservice.ScheduledMessage, error) {
+	sendAt, err := time.Parse(time.RFC3339, request.GetSendAt())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Could not parse send_at due to: %s", err))
+	}
+
+	m, err := e.queueBox.Reschedule(request.GetKey(), request.GetId(), sendAt)
+	switch err {
+	case nil:
+	case store.ErrScheduledReleased:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return e.scheduled(m), nil
+}
+
+func (e *EmailService) CancelScheduled(ctx context.Context, request *emailservice.ScheduledRequest) (*emailservice.CancelScheduledResponse, error) {
+	switch err := e.queueBox.CancelScheduled(request.GetKey(), request.GetId()); err {
+	case nil:
+	case store.ErrScheduledReleased:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &emailservice.CancelScheduledResponse{}, nil
+}
+
+func (e *EmailService) scheduled(m *model.ScheduledMessage) *emailservice.ScheduledMessage {
+	return &emailservice.ScheduledMessage{
+		Id:        m.ID,
+		Key:       m.Key,
+		SendAt:    m.SendAt.Format(time.RFC3339Nano),
+		CreatedAt: m.CreatedAt.Format(time.RFC3339Nano),
+		Subject:   m.Message.Subject,
+		To:        m.Message.To,
+	}
+}
+
+func (e *EmailService) ThreadList(ctx context.Context, request *emailservice.ThreadListRequest) (*emailservice.ThreadListResponse, error) {
+	response := &emailservice.ThreadListResponse{}
+
+	for _, t := range e.queueBox.Threads(request.GetKey()) {
+		response.Threads = append(response.Threads, e.thread(t))
+	}
+
+	return response, nil
+}
+
+func (e *EmailService) GetThread(ctx context.Context, request *emailservice.ThreadRequest) (*emailservice.Thread, error) {
+	t, err := e.queueBox.Thread(request.GetKey(), request.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return e.thread(t), nil
+}
+
+func (e *EmailService) thread(t *email.Thread) *emailservice.Thread {
+	thread := &emailservice.Thread{
+		Id:      t.ID,
+		Subject: t.Subject,
+		Updated: t.Updated.Format(time.RFC3339Nano),
+	}
+
+	for _, m := range t.Messages {
+		thread.Messages = append(thread.Messages, &emailservice.ThreadMessage{
+			Id:       m.ID,
+			ParentId: m.ParentID,
+			Subject:  m.Subject,
+			Sender:   m.Sender,
+			Date:     m.Date.Format(time.RFC3339Nano),
+		})
+	}
+
+	return thread
+}
+
+func (e *EmailService) ListSuppressions(ctx context.Context, request *emailservice.SuppressionListRequest) (*emailservice.SuppressionListResponse, error) {
+	response := &emailservice.SuppressionListResponse{}
+
+	for _, s := range e.queueBox.Suppressions().List(request.GetKey()) {
+		response.Suppressions = append(response.Suppressions, e.suppression(s))
+	}
+
+	return response, nil
+}
+
+func (e *EmailService) GetSuppression(ctx context.Context, request *emailservice.SuppressionRequest) (*emailservice.Suppression, error) {
+	s, err := e.queueBox.Suppressions().Find(request.GetKey(), request.GetAddress())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return e.suppression(s), nil
+}
+
+func (e *EmailService) AddSuppression(ctx context.Context, request *emailservice.Suppression) (*emailservice.Suppression, error) {
+	reason := request.GetReason()
+	if len(reason) == 0 {
+		reason = email.SuppressionManual
+	}
+
+	s, err := e.queueBox.Suppressions().Add(&model.Suppression{
+		Key:     request.GetKey(),
+		Address: request.GetAddress(),
+		Reason:  reason,
+	})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return e.suppression(s), nil
+}
+
+func (e *EmailService) RemoveSuppression(ctx context.Context, request *emailservice.SuppressionRequest) (*emailservice.RemoveSuppressionResponse, error) {
+	if err := e.queueBox.Suppressions().Remove(request.GetKey(), request.GetAddress()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &emailservice.RemoveSuppressionResponse{}, nil
+}
+
+func (e *EmailService) suppression(s *model.Suppression) *emailservice.Suppression {
+	return &emailservice.Suppression{
+		Key:       s.Key,
+		Address:   s.Address,
+		Reason:    s.Reason,
+		CreatedAt: s.CreatedAt.Format(time.RFC3339Nano),
+	}
+}
+
+func (e *EmailService) bounce(b *email.Bounce) *emailservice.Bounce {
+	if b == nil {
+		return nil
+	}
+
+	bounce := &emailservice.Bounce{
+		Standard:          b.Standard,
+		ReportingMta:      b.ReportingMTA,
+		OriginalMessageId: b.OriginalMessageID,
+	}
+
+	for _, r := range b.Recipients {
+		bounce.Recipients = append(bounce.Recipients, &emailservice.BouncedRecipient{
+			Address:    r.Address,
+			Action:     r.Action,
+			Status:     r.Status,
+			Diagnostic: r.Diagnostic,
+			Type:       r.Type,
+		})
+	}
+
+	return bounce
+}
+
+func (e *EmailService) classification(c *email.Classification) *emailservice.Classification {
+	return &emailservice.Classification{
+		Class:         c.Class,
+		AutoReply:     c.AutoReply,
+		AutoSubmitted: c.AutoSubmitted,
+		Bulk:          c.Bulk,
+		Reasons:       c.Reasons,
+	}
+}
+
+func (e *EmailService) addresses(list []*mail.Address) []*emailservice.Address {
+	addresses := make([]*emailservice.Address, 0, len(list))
+
+	for _, a := range list {
+		addresses = append(addresses, &emailservice.Address{
+			Name:    a.Name,
+			Address: a.Address,
+		})
+	}
+
+	return addresses
+}
+
+func (e *EmailService) authentication(a *email.Authentication) *emailservice.Authentication {
+	if a == nil {
+		return nil
+	}
+
+	auth := &emailservice.Authentication{
+		Verdict: a.Verdict,
+		Spf: &emailservice.SPFResult{
+			Domain: a.SPF.Domain,
+			Ip:     a.SPF.IP,
+			Status: a.SPF.Status,
+			Error:  a.SPF.Error,
+		},
+		Dmarc: &emailservice.DMARCResult{
+			Domain: a.DMARC.Domain,
+			Policy: a.DMARC.Policy,
+			Status: a.DMARC.Status,
+			Error:  a.DMARC.Error,
+		},
+	}
+
+	for _, d := range a.DKIM {
+		auth.Dkim = append(auth.Dkim, &emailservice.DKIMResult{
+			Domain:   d.Domain,
+			Selector: d.Selector,
+			Status:   d.Status,
+			Error:    d.Error,
+		})
+	}
+
+	return auth
+}
+
 /*
 func (e *EmailService) MessageStat(request *emailservice.StatRequest, stream emailservice.EmailService_MessageStatServer) error {
 	stat, err := e.emailServ.Stat(request.Key)
@@ -18,9 +18,17 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type EmailServiceClient interface {
-	MessageStat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (EmailService_MessageStatClient, error)
 	ReceiveMessage(ctx context.Context, in *IncomingMsgRequest, opts ...grpc.CallOption) (EmailService_ReceiveMessageClient, error)
-	RouteMessage(ctx context.Context, opts ...grpc.CallOption) (EmailService_RouteMessageClient, error)
+	ThreadList(ctx context.Context, in *ThreadListRequest, opts ...grpc.CallOption) (*ThreadListResponse, error)
+	GetThread(ctx context.Context, in *ThreadRequest, opts ...grpc.CallOption) (*Thread, error)
+	ListSuppressions(ctx context.Context, in *SuppressionListRequest, opts ...grpc.CallOption) (*SuppressionListResponse, error)
+	GetSuppression(ctx context.Context, in *SuppressionRequest, opts ...grpc.CallOption) (*Suppression, error)
+	AddSuppression(ctx context.Context, in *Suppression, opts ...grpc.CallOption) (*Suppression, error)
+	RemoveSuppression(ctx context.Context, in *SuppressionRequest, opts ...grpc.CallOption) (*RemoveSuppressionResponse, error)
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
+	ListScheduled(ctx context.Context, in *ScheduledListRequest, opts ...grpc.CallOption) (*ScheduledListResponse, error)
+	RescheduleMessage(ctx context.Context, in *RescheduleRequest, opts ...grpc.CallOption) (*ScheduledMessage, error)
+	CancelScheduled(ctx context.Context, in *ScheduledRequest, opts ...grpc.CallOption) (*CancelScheduledResponse, error)
 }
 
 type emailServiceClient struct {
@@ -31,12 +39,12 @@ func NewEmailServiceClient(cc grpc.ClientConnInterface) EmailServiceClient {
 	return &emailServiceClient{cc}
 }
 
-func (c *emailServiceClient) MessageStat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (EmailService_MessageStatClient, error) {
-	stream, err := c.cc.NewStream(ctx, &EmailService_ServiceDesc.Streams[0], "/emailservice.EmailService/MessageStat", opts...)
+func (c *emailServiceClient) ReceiveMessage(ctx context.Context, in *IncomingMsgRequest, opts ...grpc.CallOption) (EmailService_ReceiveMessageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EmailService_ServiceDesc.Streams[0], "/emailservice.EmailService/ReceiveMessage", opts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &emailServiceMessageStatClient{stream}
+	x := &emailServiceReceiveMessageClient{stream}
 	if err := x.ClientStream.SendMsg(in); err != nil {
 		return nil, err
 	}
@@ -46,93 +54,128 @@ func (c *emailServiceClient) MessageStat(ctx context.Context, in *StatRequest, o
 	return x, nil
 }
 
-type EmailService_MessageStatClient interface {
-	Recv() (*Stat, error)
+type EmailService_ReceiveMessageClient interface {
+	Recv() (*IncomingMsgResponse, error)
 	grpc.ClientStream
 }
 
-type emailServiceMessageStatClient struct {
+type emailServiceReceiveMessageClient struct {
 	grpc.ClientStream
 }
 
-func (x *emailServiceMessageStatClient) Recv() (*Stat, error) {
-	m := new(Stat)
+func (x *emailServiceReceiveMessageClient) Recv() (*IncomingMsgResponse, error) {
+	m := new(IncomingMsgResponse)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
-func (c *emailServiceClient) ReceiveMessage(ctx context.Context, in *IncomingMsgRequest, opts ...grpc.CallOption) (EmailService_ReceiveMessageClient, error) {
-	stream, err := c.cc.NewStream(ctx, &EmailService_ServiceDesc.Streams[1], "/emailservice.EmailService/ReceiveMessage", opts...)
+func (c *emailServiceClient) ThreadList(ctx context.Context, in *ThreadListRequest, opts ...grpc.CallOption) (*ThreadListResponse, error) {
+	out := new(ThreadListResponse)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/ThreadList", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &emailServiceReceiveMessageClient{stream}
-	if err := x.ClientStream.SendMsg(in); err != nil {
-		return nil, err
-	}
-	if err := x.ClientStream.CloseSend(); err != nil {
+	return out, nil
+}
+
+func (c *emailServiceClient) GetThread(ctx context.Context, in *ThreadRequest, opts ...grpc.CallOption) (*Thread, error) {
+	out := new(Thread)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/GetThread", in, out, opts...)
+	if err != nil {
 		return nil, err
 	}
-	return x, nil
+	return out, nil
 }
 
-type EmailService_ReceiveMessageClient interface {
-	Recv() (*IncomingMsgResponse, error)
-	grpc.ClientStream
+func (c *emailServiceClient) ListSuppressions(ctx context.Context, in *SuppressionListRequest, opts ...grpc.CallOption) (*SuppressionListResponse, error) {
+	out := new(SuppressionListResponse)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/ListSuppressions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-type emailServiceReceiveMessageClient struct {
-	grpc.ClientStream
+func (c *emailServiceClient) GetSuppression(ctx context.Context, in *SuppressionRequest, opts ...grpc.CallOption) (*Suppression, error) {
+	out := new(Suppression)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/GetSuppression", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (x *emailServiceReceiveMessageClient) Recv() (*IncomingMsgResponse, error) {
-	m := new(IncomingMsgResponse)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
+func (c *emailServiceClient) AddSuppression(ctx context.Context, in *Suppression, opts ...grpc.CallOption) (*Suppression, error) {
+	out := new(Suppression)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/AddSuppression", in, out, opts...)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return out, nil
 }
 
-func (c *emailServiceClient) RouteMessage(ctx context.Context, opts ...grpc.CallOption) (EmailService_RouteMessageClient, error) {
-	stream, err := c.cc.NewStream(ctx, &EmailService_ServiceDesc.Streams[2], "/emailservice.EmailService/RouteMessage", opts...)
+func (c *emailServiceClient) RemoveSuppression(ctx context.Context, in *SuppressionRequest, opts ...grpc.CallOption) (*RemoveSuppressionResponse, error) {
+	out := new(RemoveSuppressionResponse)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/RemoveSuppression", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &emailServiceRouteMessageClient{stream}
-	return x, nil
+	return out, nil
 }
 
-type EmailService_RouteMessageClient interface {
-	Send(*Stat) error
-	Recv() (*IncomingMsgResponse, error)
-	grpc.ClientStream
+func (c *emailServiceClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error) {
+	out := new(SendMessageResponse)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/SendMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-type emailServiceRouteMessageClient struct {
-	grpc.ClientStream
+func (c *emailServiceClient) ListScheduled(ctx context.Context, in *ScheduledListRequest, opts ...grpc.CallOption) (*ScheduledListResponse, error) {
+	out := new(ScheduledListResponse)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/ListScheduled", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (x *emailServiceRouteMessageClient) Send(m *Stat) error {
-	return x.ClientStream.SendMsg(m)
+func (c *emailServiceClient) RescheduleMessage(ctx context.Context, in *RescheduleRequest, opts ...grpc.CallOption) (*ScheduledMessage, error) {
+	out := new(ScheduledMessage)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/RescheduleMessage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (x *emailServiceRouteMessageClient) Recv() (*IncomingMsgResponse, error) {
-	m := new(IncomingMsgResponse)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
+func (c *emailServiceClient) CancelScheduled(ctx context.Context, in *ScheduledRequest, opts ...grpc.CallOption) (*CancelScheduledResponse, error) {
+	out := new(CancelScheduledResponse)
+	err := c.cc.Invoke(ctx, "/emailservice.EmailService/CancelScheduled", in, out, opts...)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return out, nil
 }
 
 // EmailServiceServer is the server API for EmailService service.
 // All implementations must embed UnimplementedEmailServiceServer
 // for forward compatibility
 type EmailServiceServer interface {
-	MessageStat(*StatRequest, EmailService_MessageStatServer) error
 	ReceiveMessage(*IncomingMsgRequest, EmailService_ReceiveMessageServer) error
-	RouteMessage(EmailService_RouteMessageServer) error
+	ThreadList(context.Context, *ThreadListRequest) (*ThreadListResponse, error)
+	GetThread(context.Context, *ThreadRequest) (*Thread, error)
+	ListSuppressions(context.Context, *SuppressionListRequest) (*SuppressionListResponse, error)
+	GetSuppression(context.Context, *SuppressionRequest) (*Suppression, error)
+	AddSuppression(context.Context, *Suppression) (*Suppression, error)
+	RemoveSuppression(context.Context, *SuppressionRequest) (*RemoveSuppressionResponse, error)
+	SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error)
+	ListScheduled(context.Context, *ScheduledListRequest) (*ScheduledListResponse, error)
+	RescheduleMessage(context.Context, *RescheduleRequest) (*ScheduledMessage, error)
+	CancelScheduled(context.Context, *ScheduledRequest) (*CancelScheduledResponse, error)
 	mustEmbedUnimplementedEmailServiceServer()
 }
 
@@ -140,14 +183,38 @@ type EmailServiceServer interface {
 type UnimplementedEmailServiceServer struct {
 }
 
-func (UnimplementedEmailServiceServer) MessageStat(*StatRequest, EmailService_MessageStatServer) error {
-	return status.Errorf(codes.Unimplemented, "method MessageStat not implemented")
-}
 func (UnimplementedEmailServiceServer) ReceiveMessage(*IncomingMsgRequest, EmailService_ReceiveMessageServer) error {
 	return status.Errorf(codes.Unimplemented, "method ReceiveMessage not implemented")
 }
-func (UnimplementedEmailServiceServer) RouteMessage(EmailService_RouteMessageServer) error {
-	return status.Errorf(codes.Unimplemented, "method RouteMessage not implemented")
+func (UnimplementedEmailServiceServer) ThreadList(context.Context, *ThreadListRequest) (*ThreadListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ThreadList not implemented")
+}
+func (UnimplementedEmailServiceServer) GetThread(context.Context, *ThreadRequest) (*Thread, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetThread not implemented")
+}
+func (UnimplementedEmailServiceServer) ListSuppressions(context.Context, *SuppressionListRequest) (*SuppressionListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSuppressions not implemented")
+}
+func (UnimplementedEmailServiceServer) GetSuppression(context.Context, *SuppressionRequest) (*Suppression, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSuppression not implemented")
+}
+func (UnimplementedEmailServiceServer) AddSuppression(context.Context, *Suppression) (*Suppression, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSuppression not implemented")
+}
+func (UnimplementedEmailServiceServer) RemoveSuppression(context.Context, *SuppressionRequest) (*RemoveSuppressionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveSuppression not implemented")
+}
+func (UnimplementedEmailServiceServer) SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedEmailServiceServer) ListScheduled(context.Context, *ScheduledListRequest) (*ScheduledListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListScheduled not implemented")
+}
+func (UnimplementedEmailServiceServer) RescheduleMessage(context.Context, *RescheduleRequest) (*ScheduledMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RescheduleMessage not implemented")
+}
+func (UnimplementedEmailServiceServer) CancelScheduled(context.Context, *ScheduledRequest) (*CancelScheduledResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelScheduled not implemented")
 }
 func (UnimplementedEmailServiceServer) mustEmbedUnimplementedEmailServiceServer() {}
 
@@ -162,72 +229,205 @@ func RegisterEmailServiceServer(s grpc.ServiceRegistrar, srv EmailServiceServer)
 	s.RegisterService(&EmailService_ServiceDesc, srv)
 }
 
-func _EmailService_MessageStat_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(StatRequest)
+func _EmailService_ReceiveMessage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(IncomingMsgRequest)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
-	return srv.(EmailServiceServer).MessageStat(m, &emailServiceMessageStatServer{stream})
+	return srv.(EmailServiceServer).ReceiveMessage(m, &emailServiceReceiveMessageServer{stream})
 }
 
-type EmailService_MessageStatServer interface {
-	Send(*Stat) error
+type EmailService_ReceiveMessageServer interface {
+	Send(*IncomingMsgResponse) error
 	grpc.ServerStream
 }
 
-type emailServiceMessageStatServer struct {
+type emailServiceReceiveMessageServer struct {
 	grpc.ServerStream
 }
 
-func (x *emailServiceMessageStatServer) Send(m *Stat) error {
+func (x *emailServiceReceiveMessageServer) Send(m *IncomingMsgResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
-func _EmailService_ReceiveMessage_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(IncomingMsgRequest)
-	if err := stream.RecvMsg(m); err != nil {
-		return err
+func _EmailService_ThreadList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ThreadListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
 	}
-	return srv.(EmailServiceServer).ReceiveMessage(m, &emailServiceReceiveMessageServer{stream})
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ThreadList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/ThreadList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ThreadList(ctx, req.(*ThreadListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type EmailService_ReceiveMessageServer interface {
-	Send(*IncomingMsgResponse) error
-	grpc.ServerStream
+func _EmailService_GetThread_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ThreadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).GetThread(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/GetThread",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).GetThread(ctx, req.(*ThreadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type emailServiceReceiveMessageServer struct {
-	grpc.ServerStream
+func _EmailService_ListSuppressions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SuppressionListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ListSuppressions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/ListSuppressions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ListSuppressions(ctx, req.(*SuppressionListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *emailServiceReceiveMessageServer) Send(m *IncomingMsgResponse) error {
-	return x.ServerStream.SendMsg(m)
+func _EmailService_GetSuppression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SuppressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).GetSuppression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/GetSuppression",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).GetSuppression(ctx, req.(*SuppressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func _EmailService_RouteMessage_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(EmailServiceServer).RouteMessage(&emailServiceRouteMessageServer{stream})
+func _EmailService_AddSuppression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Suppression)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).AddSuppression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/AddSuppression",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).AddSuppression(ctx, req.(*Suppression))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type EmailService_RouteMessageServer interface {
-	Send(*IncomingMsgResponse) error
-	Recv() (*Stat, error)
-	grpc.ServerStream
+func _EmailService_RemoveSuppression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SuppressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).RemoveSuppression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/RemoveSuppression",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).RemoveSuppression(ctx, req.(*SuppressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type emailServiceRouteMessageServer struct {
-	grpc.ServerStream
+func _EmailService_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/SendMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *emailServiceRouteMessageServer) Send(m *IncomingMsgResponse) error {
-	return x.ServerStream.SendMsg(m)
+func _EmailService_ListScheduled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduledListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).ListScheduled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/ListScheduled",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).ListScheduled(ctx, req.(*ScheduledListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *emailServiceRouteMessageServer) Recv() (*Stat, error) {
-	m := new(Stat)
-	if err := x.ServerStream.RecvMsg(m); err != nil {
+func _EmailService_RescheduleMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RescheduleRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return m, nil
+	if interceptor == nil {
+		return srv.(EmailServiceServer).RescheduleMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/RescheduleMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).RescheduleMessage(ctx, req.(*RescheduleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmailService_CancelScheduled_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduledRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmailServiceServer).CancelScheduled(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/emailservice.EmailService/CancelScheduled",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmailServiceServer).CancelScheduled(ctx, req.(*ScheduledRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 // EmailService_ServiceDesc is the grpc.ServiceDesc for EmailService service.
@@ -236,23 +436,53 @@ func (x *emailServiceRouteMessageServer) Recv() (*Stat, error) {
 var EmailService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "emailservice.EmailService",
 	HandlerType: (*EmailServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
-	Streams: []grpc.StreamDesc{
+	Methods: []grpc.MethodDesc{
 		{
-			StreamName:    "MessageStat",
-			Handler:       _EmailService_MessageStat_Handler,
-			ServerStreams: true,
+			MethodName: "ThreadList",
+			Handler:    _EmailService_ThreadList_Handler,
 		},
 		{
-			StreamName:    "ReceiveMessage",
-			Handler:       _EmailService_ReceiveMessage_Handler,
-			ServerStreams: true,
+			MethodName: "GetThread",
+			Handler:    _EmailService_GetThread_Handler,
 		},
 		{
-			StreamName:    "RouteMessage",
-			Handler:       _EmailService_RouteMessage_Handler,
+			MethodName: "ListSuppressions",
+			Handler:    _EmailService_ListSuppressions_Handler,
+		},
+		{
+			MethodName: "GetSuppression",
+			Handler:    _EmailService_GetSuppression_Handler,
+		},
+		{
+			MethodName: "AddSuppression",
+			Handler:    _EmailService_AddSuppression_Handler,
+		},
+		{
+			MethodName: "RemoveSuppression",
+			Handler:    _EmailService_RemoveSuppression_Handler,
+		},
+		{
+			MethodName: "SendMessage",
+			Handler:    _EmailService_SendMessage_Handler,
+		},
+		{
+			MethodName: "ListScheduled",
+			Handler:    _EmailService_ListScheduled_Handler,
+		},
+		{
+			MethodName: "RescheduleMessage",
+			Handler:    _EmailService_RescheduleMessage_Handler,
+		},
+		{
+			MethodName: "CancelScheduled",
+			Handler:    _EmailService_CancelScheduled_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReceiveMessage",
+			Handler:       _EmailService_ReceiveMessage_Handler,
 			ServerStreams: true,
-			ClientStreams: true,
 		},
 	},
 	Metadata: "grpc/protobuf/emailservice/email_service.proto",
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+const (
+	EventMessageReceived = "message.received"
+	EventMessageSent     = "message.sent"
+	EventMessageFailed   = "message.failed"
+)
+
+var EventTypes = []string{EventMessageReceived, EventMessageSent, EventMessageFailed}
+
+//Event published by the queue box to subscribers of the account
+type Event struct {
+	Type      string           `json:"type"`
+	Key       string           `json:"key"`
+	CreatedAt time.Time        `json:"created_at"`
+	Message   *ReceivedMessage `json:"message,omitempty"`
+	Sent      *SentMessage     `json:"sent,omitempty"`
+}
+
+//Message passed to the mail server or rejected by it, error is empty for sent message
+type SentMessage struct {
+	MessageID  string   `json:"message_id"`
+	Subject    string   `json:"subject"`
+	Recipients []string `json:"recipients"`
+	Error      string   `json:"error,omitempty"`
+}
+
+func isEventType(event string) bool {
+	for _, e := range EventTypes {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
@@ -6,12 +6,13 @@ import (
 )
 
 type File struct {
-	Name    string    `json:"name"`
-	Key     string    `json:"key"`
-	Size    int64     `json:"size"`
-	Data    []byte    `json:"-"`
-	Reader  io.Reader `json:"-"`
-	ModTime time.Time `json:"modification_time"`
+	Name        string    `json:"name"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Data        []byte    `json:"-"`
+	Reader      io.Reader `json:"-"`
+	ModTime     time.Time `json:"modification_time"`
 }
 
 func NewFile(name string) *File {
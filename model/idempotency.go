@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+//Result of the send request stored for its idempotency key,
+//the message ID is empty while the request is in progress
+type IdempotencyRecord struct {
+	Key            string    `json:"key"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	RequestHash    string    `json:"request_hash"`
+	MessageID      string    `json:"message_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (i *IdempotencyRecord) Completed() bool {
+	return len(i.MessageID) > 0
+}
@@ -1,9 +1,93 @@
 package model
 
+import (
+	"fmt"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/RussellLuo/validating/v2"
+)
+
+//Message sent by the client, data of attachments is base64 encoded in JSON.
+//Message with send time is held until the time, which is RFC 3339 with the zone offset,
+//e.g. 2021-06-01T08:00:00+02:00 for 08:00 in the recipient timezone
 type Message struct {
-	Key       string `json:"access_key"`
-	Sender    string `json:"sender"`
-	Recipient string `json:"recipient"`
-	Subject   string `json:"subject"`
-	Content   string `json:"content"`
+	Key         string        `json:"key"`
+	Sender      string        `json:"sender"`
+	To          []string      `json:"to"`
+	Cc          []string      `json:"cc"`
+	Bcc         []string      `json:"bcc"`
+	Subject     string        `json:"subject"`
+	Text        string        `json:"text"`
+	HTML        string        `json:"html"`
+	Attachments []*Attachment `json:"attachments"`
+	SendAt      *time.Time    `json:"send_at,omitempty"`
+}
+
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id"`
+	Data        []byte `json:"data"`
+}
+
+//Validates message sent with REST or gRPC
+func (m *Message) Validate() error {
+	validateErr := validating.Validate(validating.Schema{
+		validating.F("key", &m.Key):         validating.Nonzero(),
+		validating.F("to", &m.To):           validating.All(validating.Nonzero().Msg("has no recipient"), addressesValidator(m.To)),
+		validating.F("cc", &m.Cc):           addressesValidator(m.Cc),
+		validating.F("bcc", &m.Bcc):         addressesValidator(m.Bcc),
+		validating.F("subject", &m.Subject): validating.All(validating.Nonzero(), validating.Assert(!strings.ContainsAny(m.Subject, "\r\n")).Msg("could not contain line breaks")),
+		validating.F("text", &m.Text):       validating.Assert(len(m.Text) > 0 || len(m.HTML) > 0).Msg("or html content is required"),
+		validating.F("attachments", &m.Attachments): validating.Slice(func() (schemas []validating.Schema) {
+			for _, a := range m.Attachments {
+				if a == nil {
+					continue
+				}
+
+				nameErr := ValidateFileName(a.Name)
+
+				schemas = append(schemas, validating.Schema{
+					validating.F("name", &a.Name): validating.Assert(nameErr == nil).Msg(fmt.Sprint(nameErr)),
+					validating.F("data", &a.Data): validating.Nonzero(),
+				})
+			}
+			return
+		}),
+	})
+
+	if len(validateErr) > 0 {
+		return validateErr
+	}
+
+	return nil
+}
+
+func addressesValidator(addresses []string) validating.Validator {
+	return validating.Slice(func() (schemas []validating.Schema) {
+		for i := range addresses {
+			_, err := mail.ParseAddress(addresses[i])
+
+			schemas = append(schemas, validating.Schema{
+				validating.F("", &addresses[i]): validating.Assert(err == nil).Msg("is not a valid address"),
+			})
+		}
+		return
+	})
+}
+
+func ValidateFileName(fileName string) error {
+	if !(len(fileName) > 0) {
+		return fmt.Errorf("File name not found")
+	}
+
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if len(name) > 50 {
+		return fmt.Errorf("File name include more than 50 characters")
+	}
+
+	return nil
 }
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMessage() *Message {
+	return &Message{
+		Key:     "account",
+		To:      []string{"Gopher <gopher@golang.org>"},
+		Subject: "Golang message test",
+		Text:    "Example text in content",
+	}
+}
+
+func TestValidateMessage(t *testing.T) {
+	assert.NoError(t, testMessage().Validate())
+
+	m := testMessage()
+	m.To = nil
+	assert.Error(t, m.Validate())
+
+	m = testMessage()
+	m.Cc = []string{"not an address"}
+	assert.Contains(t, m.Validate().Error(), "is not a valid address")
+
+	m = testMessage()
+	m.Text = ""
+	assert.Error(t, m.Validate())
+
+	m.HTML = "<p>Example</p>"
+	assert.NoError(t, m.Validate())
+
+	m.Attachments = []*Attachment{{Name: "report.pdf"}}
+	assert.Contains(t, m.Validate().Error(), "data")
+
+	m.Attachments[0].Data = []byte("%PDF")
+	assert.NoError(t, m.Validate())
+
+	m = testMessage()
+	m.Subject = "Report\r\nBcc: attacker@golang.org"
+	assert.Contains(t, m.Validate().Error(), "could not contain line breaks")
+}
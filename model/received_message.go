@@ -0,0 +1,98 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+//Summary of received message kept in the message index
+type ReceivedMessage struct {
+	ID             string            `json:"id"`
+	Key            string            `json:"key"`
+	MessageID      string            `json:"message_id"`
+	SenderName     string            `json:"sender_name"`
+	Sender         string            `json:"sender"`
+	To             []string          `json:"to"`
+	Cc             []string          `json:"cc"`
+	Subject        string            `json:"subject"`
+	Date           time.Time         `json:"date"`
+	ReceivedAt     time.Time         `json:"received_at"`
+	HasAttachments bool              `json:"has_attachments"`
+	Attachments    []*AttachmentInfo `json:"attachments"`
+	ThreadID       string            `json:"thread_id"`
+	Size           int               `json:"size"`
+	Sequence       int64             `json:"sequence"`
+}
+
+//Filters of received messages, empty fields match every message.
+//Sender, recipient and subject match case insensitive substring
+type MessageFilter struct {
+	Sender        string
+	Recipient     string
+	Subject       string
+	Since         time.Time
+	Until         time.Time
+	HasAttachment *bool
+	Cursor        string
+	Limit         int
+}
+
+//Page of received messages, the newest first, next cursor is empty on the last page
+type MessagePage struct {
+	Messages   []*ReceivedMessage `json:"messages"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+func (f *MessageFilter) Match(m *ReceivedMessage) bool {
+	if len(f.Sender) > 0 && !containsFold(m.Sender, f.Sender) && !containsFold(m.SenderName, f.Sender) {
+		return false
+	}
+
+	if len(f.Recipient) > 0 && !f.matchRecipient(m) {
+		return false
+	}
+
+	if len(f.Subject) > 0 && !containsFold(m.Subject, f.Subject) {
+		return false
+	}
+
+	if !f.Since.IsZero() && m.Date.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !m.Date.Before(f.Until) {
+		return false
+	}
+
+	if f.HasAttachment != nil && m.HasAttachments != *f.HasAttachment {
+		return false
+	}
+
+	return true
+}
+
+func (f *MessageFilter) matchRecipient(m *ReceivedMessage) bool {
+	for _, list := range [][]string{m.To, m.Cc} {
+		for _, r := range list {
+			if containsFold(r, f.Recipient) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+//Attachment of received message kept in the file store, checksum is SHA-256 of the data
+type AttachmentInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id,omitempty"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+//Message held until the send time, ID is the Message-ID of the message.
+//Released message waits in the sending queue and is kept until it is sent,
+//recipients it was delivered to by failed attempts are not sent it again
+type ScheduledMessage struct {
+	ID         string     `json:"id"`
+	Key        string     `json:"key"`
+	SendAt     time.Time  `json:"send_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+	Attempts   int        `json:"attempts,omitempty"`
+	Delivered  []string   `json:"delivered,omitempty"`
+	Message    *Message   `json:"message"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+type Suppression struct {
+	Key       string    `json:"key"`
+	Address   string    `json:"address"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RussellLuo/validating/v2"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+//Networks of private and shared addresses, webhooks could not post to them
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+)
+
+//Subscription of the account to events posted to the URL, empty events subscribe to every event.
+//Payloads are signed with the secret
+type Webhook struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//Attempts to post the event to the webhook, replayed delivery refers to the original one
+type WebhookDelivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	Key           string          `json:"key"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	StatusCode    int             `json:"status_code,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	ReplayOf      string          `json:"replay_of,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Validates webhook added with REST
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	validURL := err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0 && publicHost(u.Hostname())
+
+	validateErr := validating.Validate(validating.Schema{
+		validating.F("key", &w.Key): validating.Nonzero(),
+		validating.F("url", &w.URL): validating.Assert(validURL).Msg("is not a valid public HTTP URL"),
+		validating.F("events", &w.Events): validating.Slice(func() (schemas []validating.Schema) {
+			for i := range w.Events {
+				schemas = append(schemas, validating.Schema{
+					validating.F("", &w.Events[i]): validating.Assert(isEventType(w.Events[i])).Msg("is not a known event"),
+				})
+			}
+			return
+		}),
+	})
+
+	if len(validateErr) > 0 {
+		return validateErr
+	}
+
+	return nil
+}
+
+//Reports whether the address could be reached from the internet,
+//loopback, link-local, private and multicast addresses are not public
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//Host name is checked again with its resolved address when webhook is posted
+func publicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublicIP(ip)
+	}
+
+	return len(host) > 0
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	list := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+
+		list = append(list, n)
+	}
+
+	return list
+}
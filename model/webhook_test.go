@@ -0,0 +1,39 @@
+package model
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.golang.org/email", true},
+		{"http://93.184.216.34:8080/email", true},
+		{"ftp://hooks.golang.org/email", false},
+		{"http://localhost:8080/email", false},
+		{"http://127.0.0.1/email", false},
+		{"http://[::1]/email", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.1/email", false},
+		{"http://192.168.1.1/email", false},
+		{"http://[::ffff:172.16.0.1]/email", false},
+		{"http://0.0.0.0/email", false},
+	}
+
+	for _, test := range tests {
+		w := &Webhook{Key: "account", URL: test.url}
+		assert.Equal(t, test.valid, w.Validate() == nil, test.url)
+	}
+
+	w := &Webhook{Key: "account", URL: "https://hooks.golang.org/email", Events: []string{"unknown"}}
+	assert.Contains(t, w.Validate().Error(), "is not a known event")
+
+	assert.True(t, IsPublicIP(net.ParseIP("2001:4860:4860::8888")))
+	assert.False(t, IsPublicIP(net.ParseIP("fd00::1")))
+	assert.False(t, IsPublicIP(nil))
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/rlaskowski/go-email/model"
+)
+
+//Number of events kept for subscriber which does not read them
+const SubscriptionBuffer = 64
+
+var ErrSubscriptionKey = errors.New("Account key is required to subscribe to events")
+
+//Publishes events of the queue box to subscribers,
+//subscriber which falls behind is closed so it could not block the queue
+type EventHub struct {
+	subscriptions map[*Subscription]bool
+	mutex         sync.RWMutex
+}
+
+type Subscription struct {
+	key    string
+	events chan *model.Event
+	hub    *EventHub
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		subscriptions: make(map[*Subscription]bool),
+	}
+}
+
+//Subscribes to events of the account
+func (h *EventHub) Subscribe(key string) (*Subscription, error) {
+	if len(key) == 0 {
+		return nil, ErrSubscriptionKey
+	}
+
+	s := &Subscription{
+		key:    key,
+		events: make(chan *model.Event, SubscriptionBuffer),
+		hub:    h,
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.subscriptions[s] = true
+
+	return s, nil
+}
+
+func (h *EventHub) Publish(event *model.Event) {
+	slow := make([]*Subscription, 0)
+
+	h.mutex.RLock()
+
+	for s := range h.subscriptions {
+		if s.key != event.Key {
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		default:
+			slow = append(slow, s)
+		}
+	}
+
+	h.mutex.RUnlock()
+
+	for _, s := range slow {
+		s.Close()
+	}
+}
+
+//Events of the subscription, channel is closed when subscription is closed
+func (s *Subscription) Events() <-chan *model.Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.mutex.Lock()
+	defer s.hub.mutex.Unlock()
+
+	//channel is closed under the lock, so it is never closed while event is published
+	if s.hub.subscriptions[s] {
+		delete(s.hub.subscriptions, s)
+		close(s.events)
+	}
+}
@@ -1,15 +1,25 @@
 package queue
 
 import (
+	"bytes"
 	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rlaskowski/go-email/config"
 	"github.com/rlaskowski/go-email/email"
+	"github.com/rlaskowski/go-email/model"
+	"github.com/rlaskowski/go-email/store"
 )
 
 const (
@@ -17,20 +27,100 @@ const (
 	Q_SEND string = "sending"
 )
 
+const (
+	//Delay of the next attempt to send scheduled message which failed
+	ScheduledRetryDelay = time.Minute
+	//Number of attempts to send scheduled message before it is dropped
+	ScheduledMaxAttempts = 5
+)
+
 type QueueBox struct {
 	emailPool      sync.Pool
 	queueFactory   *QueueFactory
 	receivingQueue QueueProcess
 	sendingQueue   QueueProcess
 	serviceConfig  config.ServiceConfig
+	resolver       email.Resolver
+	threaders      map[string]*email.Threader
+	threadersMutex sync.Mutex
+	suppressions   *store.SuppressionStore
+	idempotency    *store.IdempotencyStore
+	sendingMutex   sync.Mutex
+	schedule       *store.ScheduleStore
+	timeQueue      *TimeQueue
+	scheduleMutex  sync.Mutex
+	messages       *store.MessageStore
+	attachments    *store.FileStore
+	events         *EventHub
+	webhooks       *WebhookDispatcher
 }
 
 func NewQueuBox(serviceConfig config.ServiceConfig) *QueueBox {
 	q := &QueueBox{
 		queueFactory:  NewFactory(),
 		serviceConfig: serviceConfig,
+		resolver:      email.NewDNSResolver(),
+		threaders:     make(map[string]*email.Threader),
+		timeQueue:     NewTimeQueue(),
+		events:        NewEventHub(),
+	}
+
+	suppressions, err := store.NewSuppressionStore(serviceConfig.SuppressionStorePath)
+	if err != nil {
+		log.Printf("Could not load suppressions due to: %s, keeping them in memory", err)
+		suppressions, _ = store.NewSuppressionStore("")
+	}
+
+	q.suppressions = suppressions
+
+	idempotency, err := store.NewIdempotencyStore(serviceConfig.IdempotencyStorePath, serviceConfig.IdempotencyWindow)
+	if err != nil {
+		log.Printf("Could not load idempotency keys due to: %s, keeping them in memory", err)
+		idempotency, _ = store.NewIdempotencyStore("", serviceConfig.IdempotencyWindow)
+	}
+
+	q.idempotency = idempotency
+
+	schedule, err := store.NewScheduleStore(serviceConfig.ScheduleStorePath)
+	if err != nil {
+		log.Printf("Could not load scheduled messages due to: %s, keeping them in memory", err)
+		schedule, _ = store.NewScheduleStore("")
+	}
+
+	q.schedule = schedule
+
+	//messages released before the service stopped are due at once, so they are sent again
+	for _, m := range schedule.All() {
+		q.timeQueue.Schedule(m.ID, m.SendAt)
+	}
+
+	messages, err := store.NewMessageStore(serviceConfig.MessageStorePath)
+	if err != nil {
+		log.Printf("Could not load received messages due to: %s, keeping them in memory", err)
+		messages, _ = store.NewMessageStore("")
+	}
+
+	q.messages = messages
+
+	q.rebuildThreads()
+
+	if path := serviceConfig.AttachmentStorePath; len(path) > 0 {
+		if err := os.MkdirAll(path, config.FilePermissions); err != nil {
+			log.Printf("Could not create attachment directory due to: %s, attachments will not be stored", err)
+		} else {
+			q.attachments = store.NewFileStore(path)
+		}
 	}
 
+	webhooks, err := store.NewWebhookStore(serviceConfig.WebhookStorePath)
+	if err != nil {
+		log.Printf("Could not load webhooks due to: %s, keeping them in memory", err)
+		webhooks, _ = store.NewWebhookStore("")
+	}
+
+	client := NewWebhookClient(serviceConfig.WebhookTimeout)
+	q.webhooks = NewWebhookDispatcher(webhooks, client, serviceConfig.WebhookMaxAttempts, serviceConfig.WebhookRetryBackoff, serviceConfig.WebhookWorkers)
+
 	q.emailPool.New = func() interface{} {
 		return email.NewEmail()
 	}
@@ -38,7 +128,36 @@ func NewQueuBox(serviceConfig config.ServiceConfig) *QueueBox {
 	return q
 }
 
+//Sets DNS resolver used to authenticate received messages
+func (q *QueueBox) SetResolver(resolver email.Resolver) {
+	q.resolver = resolver
+}
+
+//Suppressions enforced when sending and filled with hard bounced addresses
+func (q *QueueBox) Suppressions() *store.SuppressionStore {
+	return q.suppressions
+}
+
+//Suppresses address of verified one-click unsubscribe token
+func (q *QueueBox) Unsubscribe(token string) error {
+	e, err := q.acquireEmail()
+	if err != nil {
+		return err
+	}
+
+	key, address, err := e.Unsubscribe(token)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Address %s unsubscribed, client key %s", address, key)
+
+	return q.suppressions.Suppress(key, address, email.SuppressionUnsubscribe)
+}
+
 func (q *QueueBox) Start() error {
+	go q.delivering()
+
 	go q.receiving()
 
 	go q.sending()
@@ -63,11 +182,422 @@ func (q *QueueBox) receiving() {
 
 func (q *QueueBox) sending() {
 	for {
+		if err := q.sendEmail(); err != nil {
+			log.Printf("Couldn't send message due to: %s", err)
+		}
+
+		time.Sleep(q.serviceConfig.QueueRefreshTime)
+	}
+}
+
+//Adds deliveries of the event to webhooks before it is published to subscribers,
+//so webhooks get every event even when subscribers fall behind
+func (q *QueueBox) publish(event *model.Event) {
+	if err := q.webhooks.Dispatch(event); err != nil {
+		log.Printf("Could not dispatch %s event due to: %s, client key %s", event.Type, err, event.Key)
+	}
+
+	q.events.Publish(event)
+}
+
+func (q *QueueBox) delivering() {
+	for {
+		q.webhooks.Deliver(time.Now())
 
 		time.Sleep(q.serviceConfig.QueueRefreshTime)
 	}
 }
 
+func (q *QueueBox) sendEmail() error {
+	q.releaseScheduled(time.Now())
+
+	e, err := q.acquireEmail()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range e.Config() {
+		qid, err := q.queueId(c.Key, Q_SEND)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range q.popSending(qid) {
+			err := e.Send(c.Key, m)
+			if err != nil {
+				log.Printf("Could not send message %s due to: %s, client key %s", m.MessageID(), err, c.Key)
+			}
+
+			q.finishScheduled(m, err, time.Now())
+			q.publishSent(c.Key, m, err)
+		}
+	}
+
+	return nil
+}
+
+func (q *QueueBox) publishSent(key string, m *email.Message, err error) {
+	event := &model.Event{
+		Type:      model.EventMessageSent,
+		Key:       key,
+		CreatedAt: time.Now().UTC(),
+		Sent: &model.SentMessage{
+			MessageID:  m.MessageID(),
+			Subject:    m.Subject(),
+			Recipients: m.EnvelopeRecipients(),
+		},
+	}
+
+	if err != nil {
+		event.Type = model.EventMessageFailed
+		event.Sent.Error = err.Error()
+	}
+
+	q.publish(event)
+}
+
+//Queues message of the client, for repeated idempotency key the Message-ID of the first request
+//is returned instead of sending the message again
+func (q *QueueBox) Send(message *model.Message, idempotencyKey string, files ...*model.File) (string, bool, error) {
+	if len(idempotencyKey) == 0 {
+		id, err := q.queue(message, files)
+		return id, false, err
+	}
+
+	hash, err := requestHash(message, files)
+	if err != nil {
+		return "", false, err
+	}
+
+	record, err := q.idempotency.Begin(message.Key, idempotencyKey, hash)
+	if err != nil {
+		return "", false, err
+	}
+
+	if record != nil {
+		return record.MessageID, true, nil
+	}
+
+	id, err := q.queue(message, files)
+	if err != nil {
+		q.idempotency.Release(message.Key, idempotencyKey)
+		return "", false, err
+	}
+
+	if err := q.idempotency.Complete(message.Key, idempotencyKey, id); err != nil {
+		log.Printf("Could not store idempotency key of message %s due to: %s, client key %s", id, err, message.Key)
+	}
+
+	return id, false, nil
+}
+
+//Message with send time is scheduled, other ones are queued to be sent at once
+func (q *QueueBox) queue(message *model.Message, files []*model.File) (string, error) {
+	if message.SendAt == nil {
+		return q.SendMessage(message.Key, outgoingMessage(message, files))
+	}
+
+	return q.scheduleMessage(message, files)
+}
+
+//Queues message to be sent from the account, returns Message-ID of the queued message
+func (q *QueueBox) SendMessage(key string, message *email.Message) (string, error) {
+	account, err := q.account(key)
+	if err != nil {
+		return "", err
+	}
+
+	//Message-ID is generated with the domain of the account address
+	message.SetSender(message.SenderName(), account.Email)
+
+	qid, err := q.queueId(key, Q_SEND)
+	if err != nil {
+		return "", err
+	}
+
+	q.pushSending(qid, message)
+
+	return message.MessageID(), nil
+}
+
+//Holds message until the send time, files are stored with the message as attachments
+func (q *QueueBox) scheduleMessage(message *model.Message, files []*model.File) (string, error) {
+	account, err := q.account(message.Key)
+	if err != nil {
+		return "", err
+	}
+
+	msg := outgoingMessage(message, files)
+	msg.SetSender(msg.SenderName(), account.Email)
+
+	scheduled := *message
+	scheduled.SendAt = nil
+	scheduled.Attachments = append([]*model.Attachment{}, message.Attachments...)
+
+	for _, f := range files {
+		scheduled.Attachments = append(scheduled.Attachments, &model.Attachment{
+			Name:        f.Name,
+			ContentType: f.ContentType,
+			Data:        f.Data,
+		})
+	}
+
+	sm := &model.ScheduledMessage{
+		ID:      msg.MessageID(),
+		Key:     message.Key,
+		SendAt:  message.SendAt.UTC(),
+		Message: &scheduled,
+	}
+
+	q.scheduleMutex.Lock()
+	defer q.scheduleMutex.Unlock()
+
+	if err := q.schedule.Add(sm); err != nil {
+		return "", err
+	}
+
+	q.timeQueue.Schedule(sm.ID, sm.SendAt)
+
+	return sm.ID, nil
+}
+
+//Messages of the account waiting for the send time, the earliest first
+func (q *QueueBox) Scheduled(key string) []*model.ScheduledMessage {
+	return q.schedule.List(key)
+}
+
+func (q *QueueBox) ScheduledMessage(key, id string) (*model.ScheduledMessage, error) {
+	return q.schedule.Find(key, id)
+}
+
+//Changes send time of the message which was not released to sending yet
+func (q *QueueBox) Reschedule(key, id string, sendAt time.Time) (*model.ScheduledMessage, error) {
+	q.scheduleMutex.Lock()
+	defer q.scheduleMutex.Unlock()
+
+	sm, err := q.schedule.Reschedule(key, id, sendAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	q.timeQueue.Schedule(sm.ID, sm.SendAt)
+
+	return sm, nil
+}
+
+func (q *QueueBox) CancelScheduled(key, id string) error {
+	q.scheduleMutex.Lock()
+	defer q.scheduleMutex.Unlock()
+
+	sm, err := q.schedule.Find(key, id)
+	if err != nil {
+		return err
+	}
+
+	if sm.ReleasedAt != nil {
+		return store.ErrScheduledReleased
+	}
+
+	if err := q.schedule.Remove(key, id); err != nil {
+		return err
+	}
+
+	q.timeQueue.Remove(id)
+
+	log.Printf("Scheduled message %s was cancelled, client key %s", id, key)
+
+	return nil
+}
+
+//Moves messages which are due to the sending queue of their account,
+//they are kept in the schedule until they are sent
+func (q *QueueBox) releaseScheduled(now time.Time) {
+	q.scheduleMutex.Lock()
+	defer q.scheduleMutex.Unlock()
+
+	for _, id := range q.timeQueue.PopDue(now) {
+		sm, err := q.schedule.Get(id)
+		if err != nil {
+			continue
+		}
+
+		qid, err := q.queueId(sm.Key, Q_SEND)
+		if err == nil {
+			err = q.schedule.Release(sm.ID, now.UTC())
+		}
+
+		if err != nil {
+			log.Printf("Could not release scheduled message %s due to: %s, client key %s", id, err, sm.Key)
+			q.timeQueue.Schedule(sm.ID, sm.SendAt)
+			continue
+		}
+
+		msg := outgoingMessage(sm.Message, nil)
+		msg.SetMessageID(sm.ID)
+		msg.SetDelivered(sm.Delivered)
+
+		q.pushSending(qid, msg)
+	}
+}
+
+//Removes released message from the schedule once it is sent, message which failed
+//is scheduled again until the maximum number of attempts
+func (q *QueueBox) finishScheduled(m *email.Message, sendErr error, now time.Time) {
+	q.scheduleMutex.Lock()
+	defer q.scheduleMutex.Unlock()
+
+	sm, err := q.schedule.Get(m.MessageID())
+	if err != nil || sm.ReleasedAt == nil {
+		return
+	}
+
+	if sendErr == nil || sm.Attempts+1 >= ScheduledMaxAttempts {
+		if sendErr != nil {
+			log.Printf("Scheduled message %s was dropped after %d attempts, client key %s", sm.ID, sm.Attempts+1, sm.Key)
+		}
+
+		if err := q.schedule.Remove(sm.Key, sm.ID); err != nil {
+			log.Printf("Could not remove scheduled message %s due to: %s, client key %s", sm.ID, err, sm.Key)
+		}
+
+		return
+	}
+
+	//recipients which got the message are not sent it again
+	var delivered []string
+
+	var deliveryErr *email.DeliveryError
+	if errors.As(sendErr, &deliveryErr) {
+		delivered = deliveryErr.Delivered
+	}
+
+	retried, err := q.schedule.Retry(sm.ID, now.Add(ScheduledRetryDelay).UTC(), delivered)
+	if err != nil {
+		log.Printf("Could not schedule message %s again due to: %s, client key %s", sm.ID, err, sm.Key)
+		return
+	}
+
+	q.timeQueue.Schedule(retried.ID, retried.SendAt)
+}
+
+func (q *QueueBox) account(key string) (*email.Config, error) {
+	e, err := q.acquireEmail()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range e.Config() {
+		if c.Key == key {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Could not find account with key %s", key)
+}
+
+func outgoingMessage(message *model.Message, files []*model.File) *email.Message {
+	msg := email.NewMessage()
+
+	//address is replaced with the account address when sending
+	msg.SetSender(message.Sender, "")
+	msg.SetSubject(message.Subject)
+
+	for _, r := range message.To {
+		msg.AddRecipient(r)
+	}
+
+	for _, r := range message.Cc {
+		msg.AddCc(r)
+	}
+
+	for _, r := range message.Bcc {
+		msg.AddBcc(r)
+	}
+
+	if len(message.Text) > 0 {
+		msg.AddContent(&email.Content{Data: []byte(message.Text)})
+	}
+
+	if len(message.HTML) > 0 {
+		msg.AddContent(&email.Content{HTMLType: true, Data: []byte(message.HTML)})
+	}
+
+	for _, a := range message.Attachments {
+		if a == nil {
+			continue
+		}
+
+		msg.AttachFile(&email.File{
+			Name:        a.Name,
+			ContentType: a.ContentType,
+			ContentID:   a.ContentID,
+			Data:        a.Data,
+		})
+	}
+
+	for _, f := range files {
+		msg.AttachFile(&email.File{
+			Name:        f.Name,
+			ContentType: f.ContentType,
+			Data:        f.Data,
+		})
+	}
+
+	return msg
+}
+
+//Hash of the message with files used to detect reused idempotency key
+func requestHash(message *model.Message, files []*model.File) (string, error) {
+	attachments := make([]*model.Attachment, 0, len(files))
+
+	for _, f := range files {
+		attachments = append(attachments, &model.Attachment{
+			Name:        f.Name,
+			ContentType: f.ContentType,
+			Data:        f.Data,
+		})
+	}
+
+	b, err := json.Marshal(struct {
+		Message *model.Message      `json:"message"`
+		Files   []*model.Attachment `json:"files"`
+	}{message, attachments})
+	if err != nil {
+		return "", err
+	}
+
+	return config.ComputeHash(string(b))
+}
+
+func (q *QueueBox) pushSending(qid string, message *email.Message) {
+	q.sendingMutex.Lock()
+	defer q.sendingMutex.Unlock()
+
+	heap.Push(q.queueFactory.GetOrCreate(qid), &QueueStore{
+		Message:  message,
+		Priority: 1,
+		Key:      message.MessageID(),
+	})
+}
+
+func (q *QueueBox) popSending(qid string) []*email.Message {
+	q.sendingMutex.Lock()
+	defer q.sendingMutex.Unlock()
+
+	pq := q.queueFactory.GetOrCreate(qid)
+	list := make([]*email.Message, 0, pq.Len())
+
+	for pq.Len() > 0 {
+		qs := heap.Pop(pq).(*QueueStore)
+
+		if m, ok := qs.Message.(*email.Message); ok {
+			list = append(list, m)
+		}
+	}
+
+	return list
+}
+
 func (q *QueueBox) receiveEmail() error {
 	e, err := q.acquireEmail()
 	if err != nil {
@@ -91,6 +621,13 @@ func (q *QueueBox) receiveEmail() error {
 				return err
 			}
 
+			//queued message is parsed when it is read, so the index gets own copy
+			if im, err := e.ParseMessage(c.Key, mi.Raw()); err != nil {
+				log.Printf("Could not index message due to: %s", err)
+			} else {
+				q.indexMessage(c.Key, im)
+			}
+
 			q.pushToQueue(qid, mi)
 		}
 	}
@@ -98,7 +635,7 @@ func (q *QueueBox) receiveEmail() error {
 	return nil
 }
 
-func (q *QueueBox) ReceiveMessage(key string) ([]*email.MessageInfo, error) {
+func (q *QueueBox) ReceiveMessage(key string, options ...email.ParseOption) ([]*email.MessageInfo, error) {
 	qid, err := q.queueId(key, Q_RECV)
 	if err != nil {
 		return nil, err
@@ -121,16 +658,335 @@ func (q *QueueBox) ReceiveMessage(key string) ([]*email.MessageInfo, error) {
 			return nil, errors.New("Error in pull queue, bad parse to MessageInfo")
 		}
 
-		if err := mi.ParseBody(); err != nil {
+		//cid: images are linked with attachments of the indexed copy of the message
+		messageOptions := append([]email.ParseOption{}, options...)
+		if id, err := q.messageId(key, mi); err == nil {
+			messageOptions = append(messageOptions, email.WithAttachmentURL(q.AttachmentURL(key, id)))
+		}
+
+		if err := mi.ParseBody(messageOptions...); err != nil {
 			log.Printf("Body parrser error: %s", err.Error())
 		}
 
+		if a := mi.Authenticate(q.resolver); !a.Trusted() {
+			log.Printf("Message %s from %s is not authenticated, verdict: %s", mi.MessageId(), mi.Sender().Address, a.Verdict)
+		}
+
+		if mi.Filtered() {
+			log.Printf("Message %s from %s was filtered out as %s, client key %s", mi.MessageId(), mi.Sender().Address, mi.Classification().Class, key)
+			continue
+		}
+
+		q.threader(key).Add(mi)
+
 		list = append(list, mi)
 	}
 
 	return list, nil
 }
 
+//Adds received message to the message index and suppresses hard bounced recipients,
+//messages filtered out by the account are not indexed
+func (q *QueueBox) indexMessage(key string, mi *email.MessageInfo) {
+	//message removed by the client is left on the server, so it is received again
+	id, err := q.messageId(key, mi)
+	if err != nil || q.messages.Exists(id) || q.messages.Deleted(id) {
+		return
+	}
+
+	if err := mi.ParseBody(); err != nil {
+		log.Printf("Body parrser error: %s", err.Error())
+	}
+
+	//bounces suppress recipients even when no client reads the receiving queue
+	if b := mi.Bounce(); b != nil {
+		q.suppressBounced(key, b)
+	}
+
+	if mi.Filtered() {
+		return
+	}
+
+	rm := &model.ReceivedMessage{
+		ID:             id,
+		Key:            key,
+		MessageID:      mi.MessageId(),
+		SenderName:     mi.Sender().Name,
+		Sender:         mi.Sender().Address,
+		To:             addressList(mi.To()),
+		Cc:             addressList(mi.Cc()),
+		Subject:        mi.Subject(),
+		Date:           mi.DateTime(),
+		HasAttachments: len(mi.Files()) > 0,
+		Attachments:    q.storeAttachments(mi),
+		ThreadID:       q.threader(key).Add(mi),
+	}
+
+	if err := q.messages.Add(rm, mi.Raw()); err != nil {
+		log.Printf("Could not index message %s due to: %s, client key %s", rm.MessageID, err, key)
+		q.removeAttachments(rm.Attachments)
+		return
+	}
+
+	q.publish(&model.Event{
+		Type:      model.EventMessageReceived,
+		Key:       key,
+		CreatedAt: rm.ReceivedAt,
+		Message:   rm,
+	})
+}
+
+//Stores files of the message in the attachment store, files which could not be stored have no ID
+func (q *QueueBox) storeAttachments(mi *email.MessageInfo) []*model.AttachmentInfo {
+	attachments := make([]*model.AttachmentInfo, 0, len(mi.Files()))
+
+	for _, f := range mi.Files() {
+		checksum := sha256.Sum256(f.Data)
+
+		a := &model.AttachmentInfo{
+			Name:        f.Name,
+			ContentType: f.ContentType,
+			ContentID:   f.ContentID,
+			Size:        int64(len(f.Data)),
+			Checksum:    hex.EncodeToString(checksum[:]),
+		}
+
+		if q.attachments != nil {
+			id, err := q.attachments.Store(bytes.NewReader(f.Data))
+			if err != nil {
+				log.Printf("Could not store attachment %s of message %s due to: %s", f.Name, mi.MessageId(), err)
+			}
+
+			a.ID = id
+		}
+
+		attachments = append(attachments, a)
+	}
+
+	return attachments
+}
+
+func (q *QueueBox) removeAttachments(attachments []*model.AttachmentInfo) {
+	if q.attachments == nil {
+		return
+	}
+
+	for _, a := range attachments {
+		if len(a.ID) == 0 {
+			continue
+		}
+
+		if err := q.attachments.RemoveByUUID(a.ID); err != nil {
+			log.Printf("Could not remove attachment %s due to: %s", a.ID, err)
+		}
+	}
+}
+
+//Index ID of the message, Message-ID reused by another message is told apart by the digest
+//of the body. Digest of raw data is used for messages without Message-ID
+func (q *QueueBox) messageId(key string, mi *email.MessageInfo) (string, error) {
+	data := mi.Raw()
+	if len(mi.MessageId()) > 0 {
+		data = messageBody(data)
+	}
+
+	digest := sha256.Sum256(data)
+
+	return config.ComputeHash(key + "\n" + mi.MessageId() + "\n" + hex.EncodeToString(digest[:]))
+}
+
+//Body of the raw message, headers differ when the same message is delivered again
+func messageBody(raw []byte) []byte {
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		if i := bytes.Index(raw, []byte(sep)); i >= 0 {
+			return raw[i+len(sep):]
+		}
+	}
+
+	return raw
+}
+
+//Received messages of the account from the message index
+func (q *QueueBox) Messages(key string, filter *model.MessageFilter) (*model.MessagePage, error) {
+	return q.messages.List(key, filter)
+}
+
+func (q *QueueBox) Webhooks() *WebhookDispatcher {
+	return q.webhooks
+}
+
+//Hub of events published when messages are received and sent
+func (q *QueueBox) Events() *EventHub {
+	return q.events
+}
+
+//Received messages of the account indexed after the sequence, used to resume event stream
+func (q *QueueBox) MessagesSince(key string, sequence int64) []*model.ReceivedMessage {
+	return q.messages.Since(key, sequence)
+}
+
+//Summary of received message from the message index
+func (q *QueueBox) ReceivedMessage(key, id string) (*model.ReceivedMessage, error) {
+	return q.messages.Find(key, id)
+}
+
+//Received message from the message index, unlike ReceiveMessage it is not removed
+func (q *QueueBox) Message(key, id string, options ...email.ParseOption) (*email.MessageInfo, error) {
+	raw, err := q.messages.Raw(key, id)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := q.acquireEmail()
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := e.ParseMessage(key, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mi.ParseBody(options...); err != nil {
+		log.Printf("Body parrser error: %s", err.Error())
+	}
+
+	mi.Authenticate(q.resolver)
+
+	//message is already threaded, so only its thread ID is set
+	q.threader(key).Add(mi)
+
+	return mi, nil
+}
+
+//Builds download URL of attachment of indexed message referenced by cid: link,
+//the link is kept when the attachment was not stored
+func (q *QueueBox) AttachmentURL(key, id string) email.AttachmentURLFunc {
+	return func(contentID string) string {
+		m, err := q.messages.Find(key, id)
+		if err != nil {
+			return "cid:" + contentID
+		}
+
+		for _, a := range m.Attachments {
+			if len(a.ID) > 0 && strings.Trim(a.ContentID, "<>") == contentID {
+				return fmt.Sprintf("/messages/%s/attachments/%s?key=%s", url.PathEscape(id), url.PathEscape(a.ID), url.QueryEscape(key))
+			}
+		}
+
+		return "cid:" + contentID
+	}
+}
+
+//Attachment of received message with stored file, caller has to close the file
+func (q *QueueBox) Attachment(key, id, attachmentId string) (*model.AttachmentInfo, *os.File, error) {
+	if q.attachments == nil || len(attachmentId) == 0 {
+		return nil, nil, store.ErrAttachmentNotFound
+	}
+
+	a, err := q.messages.Attachment(key, id, attachmentId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := q.attachments.Open(a.ID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, store.ErrAttachmentNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	return a, file, nil
+}
+
+func (q *QueueBox) RemoveMessage(key, id string) error {
+	m, err := q.messages.Find(key, id)
+	if err != nil {
+		return err
+	}
+
+	if err := q.messages.Remove(key, id); err != nil {
+		return err
+	}
+
+	q.removeAttachments(m.Attachments)
+
+	return nil
+}
+
+func addressList(list []*mail.Address) []string {
+	addresses := make([]string, 0, len(list))
+
+	//names are kept decoded, so they could be searched
+	for _, a := range list {
+		if len(a.Name) == 0 {
+			addresses = append(addresses, a.Address)
+			continue
+		}
+
+		addresses = append(addresses, fmt.Sprintf("%s <%s>", a.Name, a.Address))
+	}
+
+	return addresses
+}
+
+//Conversations of received messages ordered by the latest message
+func (q *QueueBox) Threads(key string) []*email.Thread {
+	return q.threader(key).Threads()
+}
+
+func (q *QueueBox) Thread(key, id string) (*email.Thread, error) {
+	return q.threader(key).Thread(id)
+}
+
+//Threads indexed messages again, so conversations are kept after restart
+func (q *QueueBox) rebuildThreads() {
+	for _, m := range q.messages.All() {
+		raw, err := q.messages.Raw(m.Key, m.ID)
+		if err != nil {
+			log.Printf("Could not read message %s due to: %s, client key %s", m.ID, err, m.Key)
+			continue
+		}
+
+		mi, err := email.ParseMessageInfo(raw)
+		if err != nil {
+			log.Printf("Could not parse message %s due to: %s, client key %s", m.ID, err, m.Key)
+			continue
+		}
+
+		q.threader(m.Key).Add(mi)
+	}
+}
+
+func (q *QueueBox) threader(key string) *email.Threader {
+	q.threadersMutex.Lock()
+	defer q.threadersMutex.Unlock()
+
+	t, ok := q.threaders[key]
+	if !ok {
+		t = email.NewThreader()
+		q.threaders[key] = t
+	}
+
+	return t
+}
+
+func (q *QueueBox) suppressBounced(key string, bounce *email.Bounce) {
+	for _, r := range bounce.Recipients {
+		log.Printf("Message %s to %s bounced (%s %s): %s", bounce.OriginalMessageID, r.Address, r.Type, r.Status, r.Diagnostic)
+
+		if r.Type != email.BounceHard {
+			continue
+		}
+
+		if err := q.suppressions.Suppress(key, r.Address, email.SuppressionHardBounce); err != nil {
+			log.Printf("Could not suppress %s due to: %s", r.Address, err)
+		}
+	}
+}
+
 func (q *QueueBox) pushToQueue(key string, message *email.MessageInfo) {
 	pq := q.queueFactory.GetOrCreate(key)
 	qs := &QueueStore{
@@ -161,5 +1017,7 @@ func (q *QueueBox) acquireEmail() (*email.Email, error) {
 		return nil, err
 	}
 
+	e.SetSuppressions(q.suppressions)
+
 	return e, nil
 }
@@ -1,11 +1,598 @@
 package queue
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/email"
+	"github.com/rlaskowski/go-email/model"
+	"github.com/rlaskowski/go-email/store"
+	"github.com/stretchr/testify/assert"
+)
 
 func TestPush(t *testing.T) {
-   
+
 }
 
 func TestPop(t *testing.T) {
 
 }
+
+func TestSendingQueue(t *testing.T) {
+	q := NewQueuBox(config.ServiceConfig{})
+
+	qid, err := q.queueId("account", Q_SEND)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := email.NewMessage()
+	first.SetSender("Gopher", "gopher@golang.org")
+
+	second := email.NewMessage()
+	second.SetSender("Gopher", "gopher@golang.org")
+
+	q.pushSending(qid, first)
+	q.pushSending(qid, second)
+	q.pushSending(qid, first)
+
+	list := q.popSending(qid)
+
+	assert.Len(t, list, 2)
+	assert.ElementsMatch(t, []string{first.MessageID(), second.MessageID()}, []string{list[0].MessageID(), list[1].MessageID()})
+	assert.Empty(t, q.popSending(qid))
+}
+
+func TestRequestHash(t *testing.T) {
+	message := &model.Message{
+		Key:     "account",
+		To:      []string{"gopher@golang.org"},
+		Subject: "Report",
+		Text:    "See attached",
+	}
+
+	files := []*model.File{{Name: "report.csv", Data: []byte("a,b")}}
+
+	first, err := requestHash(message, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := requestHash(message, files)
+	assert.Equal(t, first, second)
+
+	files[0].Data = []byte("a,c")
+
+	changed, _ := requestHash(message, files)
+	assert.NotEqual(t, first, changed)
+
+	msg := outgoingMessage(message, files)
+	assert.Equal(t, "gopher@golang.org", msg.Recipients())
+	assert.Equal(t, 1, msg.FileCount())
+}
+
+func TestTimeQueue(t *testing.T) {
+	now := time.Now()
+
+	tq := NewTimeQueue()
+	tq.Schedule("third", now.Add(3*time.Hour))
+	tq.Schedule("first", now.Add(time.Hour))
+	tq.Schedule("second", now.Add(2*time.Hour))
+	tq.Schedule("cancelled", now.Add(-time.Hour))
+
+	assert.True(t, tq.Remove("cancelled"))
+	assert.False(t, tq.Remove("cancelled"))
+
+	//moved before the others
+	tq.Schedule("third", now.Add(30*time.Minute))
+
+	assert.Empty(t, tq.PopDue(now))
+	assert.Equal(t, []string{"third", "first"}, tq.PopDue(now.Add(time.Hour)))
+	assert.Equal(t, []string{"second"}, tq.PopDue(now.Add(24*time.Hour)))
+	assert.Equal(t, 0, tq.Len())
+}
+
+func TestReleaseScheduled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduled.json")
+	q := NewQueuBox(config.ServiceConfig{ScheduleStorePath: path})
+
+	now := time.Now()
+
+	for _, sm := range []*model.ScheduledMessage{
+		{ID: "due@golang.org", Key: "account", SendAt: now.Add(-time.Minute), Message: &model.Message{Key: "account", To: []string{"gopher@golang.org"}, Subject: "Due"}},
+		{ID: "later@golang.org", Key: "account", SendAt: now.Add(time.Hour), Message: &model.Message{Key: "account", To: []string{"gopher@golang.org"}, Subject: "Later"}},
+	} {
+		assert.NoError(t, q.schedule.Add(sm))
+		q.timeQueue.Schedule(sm.ID, sm.SendAt)
+	}
+
+	q.releaseScheduled(now)
+
+	qid, _ := q.queueId("account", Q_SEND)
+
+	list := q.popSending(qid)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "due@golang.org", list[0].MessageID())
+		assert.Equal(t, "Due", list[0].Subject())
+	}
+
+	//released message is kept until it is sent
+	assert.Len(t, q.Scheduled("account"), 2)
+	assert.Equal(t, store.ErrScheduledReleased, q.CancelScheduled("account", "due@golang.org"))
+
+	_, err := q.Reschedule("account", "due@golang.org", now.Add(time.Hour))
+	assert.Equal(t, store.ErrScheduledReleased, err)
+
+	//released message which was not sent before restart is released again
+	q = NewQueuBox(config.ServiceConfig{ScheduleStorePath: path})
+	q.releaseScheduled(now)
+
+	list = q.popSending(qid)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "due@golang.org", list[0].MessageID())
+	}
+
+	q.finishScheduled(list[0], nil, now)
+	assert.Len(t, q.Scheduled("account"), 1)
+
+	_, err = q.Reschedule("account", "later@golang.org", now.Add(-time.Second))
+	assert.NoError(t, err)
+
+	q.releaseScheduled(now)
+
+	list = q.popSending(qid)
+	if !assert.Len(t, list, 1) {
+		return
+	}
+
+	//failed message waits for the next attempt
+	q.finishScheduled(list[0], errors.New("connection refused"), now)
+
+	sm, err := q.ScheduledMessage("account", "later@golang.org")
+	if assert.NoError(t, err) {
+		assert.Nil(t, sm.ReleasedAt)
+		assert.Equal(t, 1, sm.Attempts)
+		assert.True(t, sm.SendAt.Equal(now.Add(ScheduledRetryDelay).UTC()))
+	}
+
+	q.releaseScheduled(now)
+	assert.Empty(t, q.popSending(qid))
+
+	//message is dropped after the last failed attempt
+	for i := 1; i < ScheduledMaxAttempts; i++ {
+		q.releaseScheduled(now.Add(ScheduledRetryDelay))
+
+		list = q.popSending(qid)
+		assert.Len(t, list, 1)
+
+		for _, m := range list {
+			q.finishScheduled(m, errors.New("connection refused"), now)
+		}
+	}
+
+	assert.Empty(t, q.Scheduled("account"))
+	assert.Error(t, q.CancelScheduled("account", "later@golang.org"))
+}
+
+func TestRetryScheduledToFailedRecipients(t *testing.T) {
+	q := NewQueuBox(config.ServiceConfig{})
+
+	now := time.Now()
+
+	sm := &model.ScheduledMessage{
+		ID:      "partial@golang.org",
+		Key:     "account",
+		SendAt:  now.Add(-time.Minute),
+		Message: &model.Message{Key: "account", To: []string{"Gopher <gopher@golang.org>"}, Cc: []string{"gordon@golang.org"}, Subject: "Partial"},
+	}
+
+	assert.NoError(t, q.schedule.Add(sm))
+	q.timeQueue.Schedule(sm.ID, sm.SendAt)
+
+	q.releaseScheduled(now)
+
+	qid, _ := q.queueId("account", Q_SEND)
+
+	list := q.popSending(qid)
+	if !assert.Len(t, list, 1) {
+		return
+	}
+
+	assert.Equal(t, []string{"gopher@golang.org", "gordon@golang.org"}, list[0].EnvelopeRecipients())
+
+	//first attempt delivered the message only to one recipient
+	q.finishScheduled(list[0], &email.DeliveryError{
+		Delivered: []string{"gopher@golang.org"},
+		Failed:    map[string]error{"gordon@golang.org": errors.New("mailbox unavailable")},
+	}, now)
+
+	q.releaseScheduled(now.Add(ScheduledRetryDelay))
+
+	list = q.popSending(qid)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, []string{"gordon@golang.org"}, list[0].EnvelopeRecipients())
+		assert.Equal(t, "Gopher <gopher@golang.org>", list[0].Recipients())
+	}
+
+	retried, err := q.ScheduledMessage("account", "partial@golang.org")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"gopher@golang.org"}, retried.Delivered)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := NewQueuBox(config.ServiceConfig{AttachmentStorePath: dir})
+
+	raw := []byte("From: sender@golang.org\r\n" +
+		"Subject: Report\r\n" +
+		"Message-ID: <report@golang.org>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nReport attached\r\n" +
+		"--b\r\nContent-Type: text/csv\r\nContent-Disposition: attachment; filename=report.csv\r\n\r\na,b\r\n" +
+		"--b--\r\n")
+
+	mi, err := email.ParseMessageInfo(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, mi.ParseBody())
+
+	rm := &model.ReceivedMessage{ID: "report", Key: "account", Attachments: q.storeAttachments(mi)}
+	assert.NoError(t, q.messages.Add(rm, raw))
+
+	if !assert.Len(t, rm.Attachments, 1) {
+		return
+	}
+
+	a := rm.Attachments[0]
+	assert.Equal(t, "report.csv", a.Name)
+	assert.Equal(t, "text/csv", a.ContentType)
+	assert.Equal(t, int64(3), a.Size)
+	assert.Equal(t, "1eb7c54d52831bbfe8942af0b1c56b7409523a59ed6ca99c1174fef7eb32c1b5", a.Checksum)
+
+	info, file, err := q.Attachment("account", "report", a.ID)
+	if assert.NoError(t, err) {
+		data, _ := ioutil.ReadAll(file)
+		file.Close()
+
+		assert.Equal(t, a, info)
+		assert.Equal(t, "a,b", string(data))
+	}
+
+	_, _, err = q.Attachment("other", "report", a.ID)
+	assert.Equal(t, store.ErrMessageNotFound, err)
+
+	_, _, err = q.Attachment("account", "report", "unknown")
+	assert.Equal(t, store.ErrAttachmentNotFound, err)
+
+	assert.NoError(t, q.RemoveMessage("account", "report"))
+
+	_, err = q.attachments.Open(a.ID)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEventHub(t *testing.T) {
+	h := NewEventHub()
+
+	account, err := h.Subscribe("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow, err := h.Subscribe("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//empty key does not subscribe to every account
+	_, err = h.Subscribe("")
+	assert.Equal(t, ErrSubscriptionKey, err)
+
+	h.Publish(&model.Event{Type: model.EventMessageReceived, Key: "account"})
+
+	assert.Equal(t, "account", (<-account.Events()).Key)
+	assert.Len(t, slow.Events(), 0)
+
+	for i := 0; i <= SubscriptionBuffer; i++ {
+		h.Publish(&model.Event{Type: model.EventMessageReceived, Key: "other"})
+	}
+
+	//subscriber which does not read events is closed
+	n := 0
+	for range slow.Events() {
+		n++
+	}
+
+	assert.Equal(t, SubscriptionBuffer, n)
+
+	account.Close()
+	account.Close()
+
+	_, ok := <-account.Events()
+	assert.False(t, ok)
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	calls := 0
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		body, _ := ioutil.ReadAll(r.Body)
+		signature, _ := config.ComputeSignature("secret", r.Header.Get(HeaderWebhookTimestamp)+"."+string(body))
+
+		assert.Equal(t, "sha256="+signature, r.Header.Get(HeaderWebhookSignature))
+		assert.Equal(t, model.EventMessageSent, r.Header.Get(HeaderWebhookEvent))
+
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer stub.Close()
+
+	s, _ := store.NewWebhookStore("")
+
+	sent, _ := s.Add(&model.Webhook{Key: "account", URL: stub.URL, Events: []string{model.EventMessageSent}, Secret: "secret"})
+	s.Add(&model.Webhook{Key: "account", URL: stub.URL, Events: []string{model.EventMessageReceived}, Secret: "secret"})
+
+	d := NewWebhookDispatcher(s, stub.Client(), 3, time.Minute, 2)
+
+	assert.NoError(t, d.Dispatch(&model.Event{
+		Type: model.EventMessageSent,
+		Key:  "account",
+		Sent: &model.SentMessage{MessageID: "sent@golang.org"},
+	}))
+
+	now := time.Now()
+
+	d.Deliver(now)
+
+	list := s.Deliveries("account", sent.ID)
+	if !assert.Len(t, list, 1) {
+		return
+	}
+
+	assert.Equal(t, model.DeliveryPending, list[0].Status)
+	assert.Equal(t, http.StatusInternalServerError, list[0].StatusCode)
+	assert.Equal(t, now.Add(time.Minute).Unix(), list[0].NextAttemptAt.Unix())
+
+	//retry is not sent before the backoff
+	d.Deliver(now.Add(time.Second))
+	assert.Equal(t, 1, calls)
+
+	d.Deliver(now.Add(time.Minute))
+
+	delivery, _ := s.Delivery("account", list[0].ID)
+	assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+
+	replay, err := d.Replay("account", delivery.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, delivery.ID, replay.ReplayOf)
+		assert.Equal(t, model.DeliveryPending, replay.Status)
+	}
+
+	d.Deliver(now.Add(time.Minute))
+
+	assert.Equal(t, 3, calls)
+	assert.Len(t, s.Deliveries("account", sent.ID), 2)
+
+	_, err = d.Replay("other", delivery.ID)
+	assert.Equal(t, store.ErrDeliveryNotFound, err)
+}
+
+func TestWebhookClientRefusesInternalAddress(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer stub.Close()
+
+	_, err := NewWebhookClient(time.Second).Get(stub.URL)
+	assert.True(t, errors.Is(err, ErrWebhookAddress))
+
+	s, _ := store.NewWebhookStore("")
+	w, _ := s.Add(&model.Webhook{Key: "account", URL: stub.URL, Secret: "secret"})
+
+	d := NewWebhookDispatcher(s, NewWebhookClient(time.Second), 1, time.Minute, 2)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, d.Dispatch(&model.Event{Type: model.EventMessageReceived, Key: "account"}))
+	}
+
+	d.Deliver(time.Now())
+
+	list := s.Deliveries("account", w.ID)
+	if assert.Len(t, list, 3) {
+		for _, delivery := range list {
+			assert.Equal(t, model.DeliveryFailed, delivery.Status)
+			assert.Contains(t, delivery.Error, ErrWebhookAddress.Error())
+		}
+	}
+}
+
+func TestThreadsAtIngest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := NewQueuBox(config.ServiceConfig{MessageStorePath: dir})
+
+	for _, raw := range []string{
+		"From: sender@golang.org\r\nSubject: Report\r\nMessage-ID: <report@golang.org>\r\n\r\nReport",
+		"From: gopher@golang.org\r\nSubject: Re: Report\r\nMessage-ID: <reply@golang.org>\r\nIn-Reply-To: <report@golang.org>\r\n\r\nThanks",
+	} {
+		mi, err := email.ParseMessageInfo([]byte(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q.indexMessage("account", mi)
+	}
+
+	page, _ := q.Messages("account", &model.MessageFilter{})
+	if assert.Len(t, page.Messages, 2) {
+		assert.NotEmpty(t, page.Messages[0].ThreadID)
+		assert.Equal(t, page.Messages[0].ThreadID, page.Messages[1].ThreadID)
+	}
+
+	//threads are rebuilt from the message index after restart
+	q = NewQueuBox(config.ServiceConfig{MessageStorePath: dir})
+
+	threads := q.Threads("account")
+	if assert.Len(t, threads, 1) {
+		assert.Equal(t, page.Messages[0].ThreadID, threads[0].ID)
+		assert.Len(t, threads[0].Messages, 2)
+	}
+}
+
+func TestRemovedMessageIsNotReceivedAgain(t *testing.T) {
+	dir := t.TempDir()
+
+	raw := []byte("From: sender@golang.org\r\nSubject: Report\r\nMessage-ID: <report@golang.org>\r\n\r\nReport")
+
+	poll := func(q *QueueBox) {
+		mi, err := email.ParseMessageInfo(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q.indexMessage("account", mi)
+	}
+
+	q := NewQueuBox(config.ServiceConfig{MessageStorePath: dir})
+	poll(q)
+
+	page, _ := q.Messages("account", &model.MessageFilter{})
+	if !assert.Len(t, page.Messages, 1) {
+		return
+	}
+
+	assert.NoError(t, q.RemoveMessage("account", page.Messages[0].ID))
+
+	//message is still on the server at the next poll
+	poll(q)
+
+	page, _ = q.Messages("account", &model.MessageFilter{})
+	assert.Empty(t, page.Messages)
+
+	q = NewQueuBox(config.ServiceConfig{MessageStorePath: dir})
+	poll(q)
+
+	page, _ = q.Messages("account", &model.MessageFilter{})
+	assert.Empty(t, page.Messages)
+}
+
+func TestReusedMessageID(t *testing.T) {
+	q := NewQueuBox(config.ServiceConfig{})
+
+	for _, raw := range []string{
+		"From: sender@golang.org\r\nSubject: Report\r\nMessage-ID: <report@golang.org>\r\n\r\nReport",
+		//the same message delivered again
+		"Received: from mx.golang.org\r\nFrom: sender@golang.org\r\nSubject: Report\r\nMessage-ID: <report@golang.org>\r\n\r\nReport",
+		//another message with Message-ID reused by the sender
+		"From: sender@golang.org\r\nSubject: Invoice\r\nMessage-ID: <report@golang.org>\r\n\r\nInvoice",
+	} {
+		mi, err := email.ParseMessageInfo([]byte(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q.indexMessage("account", mi)
+	}
+
+	page, _ := q.Messages("account", &model.MessageFilter{})
+	if assert.Len(t, page.Messages, 2) {
+		assert.Equal(t, "Invoice", page.Messages[0].Subject)
+		assert.Equal(t, "Report", page.Messages[1].Subject)
+	}
+}
+
+func TestWebhookDeliveriesAtIngest(t *testing.T) {
+	q := NewQueuBox(config.ServiceConfig{})
+
+	w, err := q.Webhooks().Store().Add(&model.Webhook{Key: "account", URL: "https://hooks.golang.org/email", Events: []string{model.EventMessageReceived}, Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nobody reads the stream, so its subscription falls behind
+	sub, err := q.Events().Subscribe("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	count := SubscriptionBuffer + 10
+
+	for i := 0; i < count; i++ {
+		raw := fmt.Sprintf("From: sender@golang.org\r\nSubject: Report %d\r\nMessage-ID: <report-%d@golang.org>\r\n\r\nReport", i, i)
+
+		mi, err := email.ParseMessageInfo([]byte(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q.indexMessage("account", mi)
+	}
+
+	assert.Len(t, q.Webhooks().Store().Deliveries("account", w.ID), count)
+}
+
+func TestSuppressBouncedAtIngest(t *testing.T) {
+	raw, err := ioutil.ReadFile(filepath.Join("..", "email", "testdata", "bounce-postfix-dsn.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi, err := email.ParseMessageInfo(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewQueuBox(config.ServiceConfig{})
+	q.indexMessage("account", mi)
+
+	assert.True(t, q.Suppressions().IsSuppressed("account", "missing@example.com"))
+	assert.Len(t, q.Suppressions().List("account"), 1)
+}
+
+func TestAttachmentURL(t *testing.T) {
+	q := NewQueuBox(config.ServiceConfig{})
+
+	assert.NoError(t, q.messages.Add(&model.ReceivedMessage{
+		ID:  "report",
+		Key: "account one",
+		Attachments: []*model.AttachmentInfo{
+			{ID: "2f1a", Name: "logo.png", ContentID: "logo@golang.org"},
+			{Name: "chart.png", ContentID: "chart@golang.org"},
+		},
+	}, []byte("Subject: Report\r\n\r\n")))
+
+	attachmentURL := q.AttachmentURL("account one", "report")
+
+	assert.Equal(t, "/messages/report/attachments/2f1a?key=account+one", attachmentURL("logo@golang.org"))
+	assert.Equal(t, "cid:chart@golang.org", attachmentURL("chart@golang.org"))
+	assert.Equal(t, "cid:logo@golang.org", q.AttachmentURL("other", "report")("logo@golang.org"))
+}
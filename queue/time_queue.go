@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"container/heap"
+	"time"
+)
+
+//Index of items ordered by due time, the earliest first.
+//Items are found by ID, so they could be removed or moved to other time
+type TimeQueue struct {
+	items []*TimeItem
+	index map[string]*TimeItem
+}
+
+type TimeItem struct {
+	ID    string
+	Due   time.Time
+	index int
+}
+
+func NewTimeQueue() *TimeQueue {
+	return &TimeQueue{
+		items: make([]*TimeItem, 0),
+		index: make(map[string]*TimeItem),
+	}
+}
+
+func (t *TimeQueue) Len() int {
+	return len(t.items)
+}
+
+func (t *TimeQueue) Less(i, j int) bool {
+	if t.items[i].Due.Equal(t.items[j].Due) {
+		return t.items[i].ID < t.items[j].ID
+	}
+
+	return t.items[i].Due.Before(t.items[j].Due)
+}
+
+func (t *TimeQueue) Swap(i, j int) {
+	t.items[i], t.items[j] = t.items[j], t.items[i]
+	t.items[i].index = i
+	t.items[j].index = j
+}
+
+func (t *TimeQueue) Push(item interface{}) {
+	ti := item.(*TimeItem)
+	ti.index = len(t.items)
+	t.items = append(t.items, ti)
+	t.index[ti.ID] = ti
+}
+
+func (t *TimeQueue) Pop() interface{} {
+	n := len(t.items)
+	ti := t.items[n-1]
+	t.items[n-1] = nil
+	t.items = t.items[:n-1]
+
+	ti.index = -1
+	delete(t.index, ti.ID)
+
+	return ti
+}
+
+//Adds item or moves already added one to the due time
+func (t *TimeQueue) Schedule(id string, due time.Time) {
+	if ti, ok := t.index[id]; ok {
+		ti.Due = due
+		heap.Fix(t, ti.index)
+		return
+	}
+
+	heap.Push(t, &TimeItem{ID: id, Due: due})
+}
+
+func (t *TimeQueue) Remove(id string) bool {
+	ti, ok := t.index[id]
+	if !ok {
+		return false
+	}
+
+	heap.Remove(t, ti.index)
+
+	return true
+}
+
+//Removes and returns IDs of items due at the time
+func (t *TimeQueue) PopDue(now time.Time) []string {
+	ids := make([]string, 0)
+
+	for t.Len() > 0 && !t.items[0].Due.After(now) {
+		ti := heap.Pop(t).(*TimeItem)
+		ids = append(ids, ti.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,261 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
+	"github.com/rlaskowski/go-email/store"
+)
+
+const (
+	HeaderWebhookID        = "X-Webhook-ID"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+var ErrWebhookAddress = errors.New("Webhook address is not public")
+
+//Posts events to subscribed webhooks, delivery which was not accepted with 2xx status
+//is retried with exponential backoff until the maximum number of attempts
+type WebhookDispatcher struct {
+	store       *store.WebhookStore
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	workers     int
+}
+
+func NewWebhookDispatcher(webhooks *store.WebhookStore, client *http.Client, maxAttempts int, backoff time.Duration, workers int) *WebhookDispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &WebhookDispatcher{
+		store:       webhooks,
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		workers:     workers,
+	}
+}
+
+//Client which connects only to public addresses, so webhooks could not reach
+//the internal network even when their host name resolves to it or they redirect to it
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = config.DefaultServiceConfig.WebhookTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if !model.IsPublicIP(net.ParseIP(host)) {
+				return ErrWebhookAddress
+			}
+
+			return nil
+		},
+	}
+
+	//proxy is not used, the dialed address is the address of the webhook
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+func (d *WebhookDispatcher) Store() *store.WebhookStore {
+	return d.store
+}
+
+//Adds pending delivery of the event for every webhook of the account subscribed to it
+func (d *WebhookDispatcher) Dispatch(event *model.Event) error {
+	webhooks := d.store.Subscribed(event.Key, event.Type)
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range webhooks {
+		_, err := d.store.AddDelivery(&model.WebhookDelivery{
+			WebhookID: w.ID,
+			Key:       w.Key,
+			Event:     event.Type,
+			Payload:   payload,
+			Status:    model.DeliveryPending,
+		})
+		if err != nil {
+			return fmt.Errorf("Could not add delivery to webhook %s due to: %s", w.ID, err)
+		}
+	}
+
+	return nil
+}
+
+//Sends every pending delivery which next attempt is due with the pool of workers,
+//results of the attempts are written to the store at once
+func (d *WebhookDispatcher) Deliver(now time.Time) {
+	due := d.store.Due(now)
+	if len(due) == 0 {
+		return
+	}
+
+	deliveries := make(chan *model.WebhookDelivery)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < d.workers && i < len(due); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for delivery := range deliveries {
+				d.attempt(delivery, now)
+			}
+		}()
+	}
+
+	for _, delivery := range due {
+		deliveries <- delivery
+	}
+
+	close(deliveries)
+	wg.Wait()
+
+	if err := d.store.UpdateDeliveries(due...); err != nil {
+		log.Printf("Could not update %d webhook deliveries due to: %s", len(due), err)
+	}
+}
+
+//Sends payload of the delivery again as a new delivery
+func (d *WebhookDispatcher) Replay(key, id string) (*model.WebhookDelivery, error) {
+	delivery, err := d.store.Delivery(key, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.store.Find(key, delivery.WebhookID); err != nil {
+		return nil, err
+	}
+
+	return d.store.AddDelivery(&model.WebhookDelivery{
+		WebhookID: delivery.WebhookID,
+		Key:       delivery.Key,
+		Event:     delivery.Event,
+		Payload:   delivery.Payload,
+		Status:    model.DeliveryPending,
+		ReplayOf:  delivery.ID,
+	})
+}
+
+func (d *WebhookDispatcher) attempt(delivery *model.WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	delivery.StatusCode = 0
+	delivery.Error = ""
+
+	webhook, err := d.store.Find(delivery.Key, delivery.WebhookID)
+	if err != nil {
+		delivery.Status = model.DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	code, err := d.post(webhook, delivery, now)
+
+	delivery.StatusCode = code
+
+	if err == nil {
+		delivered := now.UTC()
+
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliveredAt = &delivered
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	delivery.Error = err.Error()
+
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = model.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	next := now.Add(d.retryDelay(delivery.Attempts)).UTC()
+	delivery.NextAttemptAt = &next
+}
+
+//Delay doubled after every failed attempt
+func (d *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+	return d.backoff * time.Duration(1<<uint(attempts-1))
+}
+
+//Posts payload signed with HMAC-SHA256 of the timestamp and the payload joined with a dot
+func (d *WebhookDispatcher) post(webhook *model.Webhook, delivery *model.WebhookDelivery, now time.Time) (int, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	signature, err := config.ComputeSignature(webhook.Secret, timestamp+"."+string(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, delivery.ID)
+	req.Header.Set(HeaderWebhookEvent, delivery.Event)
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+signature)
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	//body is drained so the connection could be reused
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("Webhook responded with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"github.com/rlaskowski/go-email/auth"
 	"github.com/rlaskowski/go-email/config"
 	"github.com/rlaskowski/go-email/grpc"
 	"github.com/rlaskowski/go-email/queue"
@@ -12,4 +13,5 @@ type Registry interface {
 	EmailRestService() *rest.EmailService
 	QueueBox() *queue.QueueBox
 	ServiceConfig() config.ServiceConfig
+	Authenticator() *auth.Authenticator
 }
@@ -1,17 +1,50 @@
 package rest
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/mail"
+	"os"
+	"time"
+
 	"github.com/rlaskowski/go-email/email"
+	"github.com/rlaskowski/go-email/model"
 	"github.com/rlaskowski/go-email/queue"
+	"github.com/rlaskowski/go-email/store"
 )
 
 type IncomingMessage struct {
-	ID      string           `json:"ID"`
-	Address Address          `json:"address"`
-	Subject string           `json:"subject"`
-	Date    string           `json:"date"`
-	Content []*email.Content `json:"content"`
-	File    []*email.File    `json:"file"`
+	ID             string                  `json:"ID"`
+	Address        Address                 `json:"address"`
+	Subject        string                  `json:"subject"`
+	Date           string                  `json:"date"`
+	Content        []*email.Content        `json:"content"`
+	File           []*email.File           `json:"file,omitempty"`
+	Attachments    []*model.AttachmentInfo `json:"attachments,omitempty"`
+	Authentication *email.Authentication   `json:"authentication"`
+	To             []Address               `json:"to"`
+	Cc             []Address               `json:"cc"`
+	ReplyTo        []Address               `json:"reply_to"`
+	InReplyTo      []string                `json:"in_reply_to"`
+	References     []string                `json:"references"`
+	ListID         string                  `json:"list_id"`
+	Headers        map[string][]string     `json:"headers"`
+	ThreadID       string                  `json:"thread_id"`
+	Bounce         *email.Bounce           `json:"bounce,omitempty"`
+	Classification *email.Classification   `json:"classification"`
+	Messages       []IncomingMessage       `json:"messages,omitempty"`
+}
+
+const (
+	StatusQueued    = "queued"
+	StatusScheduled = "scheduled"
+)
+
+//Message accepted for sending, ID is the Message-ID of the sent message
+type QueuedMessage struct {
+	MessageID string     `json:"message_id"`
+	Status    string     `json:"status"`
+	SendAt    *time.Time `json:"send_at,omitempty"`
 }
 
 type Address struct {
@@ -27,8 +60,15 @@ func NewEmailService(queueBox *queue.QueueBox) *EmailService {
 	return &EmailService{queueBox}
 }
 
-func (e *EmailService) ReceiveList(key string) ([]IncomingMessage, error) {
-	qlist, err := e.queueBox.ReceiveMessage(key)
+//Received messages with HTML content in the format raw, sanitized or text
+func (e *EmailService) ReceiveList(key, format string) ([]IncomingMessage, error) {
+	//cid: images are linked with attachment URLs of every message by the queue box
+	options, err := email.HTMLFormatOptions(format, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	qlist, err := e.queueBox.ReceiveMessage(key, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -36,18 +76,235 @@ func (e *EmailService) ReceiveList(key string) ([]IncomingMessage, error) {
 	var list []IncomingMessage
 
 	for _, m := range qlist {
-		im := IncomingMessage{
-			ID:      m.MessageId(),
-			Address: Address(*m.Sender()),
-			Subject: m.Subject(),
-			Date:    m.Date(),
+		list = append(list, incomingMessage(m))
+	}
+
+	return list, nil
+}
+
+//Received messages from the message index, the newest first
+func (e *EmailService) Messages(key string, filter *model.MessageFilter) (*model.MessagePage, error) {
+	return e.queueBox.Messages(key, filter)
+}
+
+//Received message with HTML content in the format raw, sanitized or text
+func (e *EmailService) Message(key, id, format string) (*IncomingMessage, error) {
+	options, err := email.HTMLFormatOptions(format, e.queueBox.AttachmentURL(key, id))
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := e.queueBox.Message(key, id, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	rm, err := e.queueBox.ReceivedMessage(key, id)
+	if err != nil {
+		return nil, err
+	}
+
+	im := incomingMessage(mi)
+
+	//files of indexed message are downloaded separately
+	im.File = nil
+	im.Attachments = rm.Attachments
+
+	return &im, nil
+}
+
+//Metadata and stored file of attachment of received message, caller has to close the file
+func (e *EmailService) Attachment(key, id, attachmentId string) (*model.AttachmentInfo, *os.File, error) {
+	return e.queueBox.Attachment(key, id, attachmentId)
+}
+
+//Subscribes to messages received by the account, subscription has to be closed
+func (e *EmailService) Subscribe(key string) (*queue.Subscription, error) {
+	return e.queueBox.Events().Subscribe(key)
+}
+
+func (e *EmailService) MessagesSince(key string, sequence int64) []*model.ReceivedMessage {
+	return e.queueBox.MessagesSince(key, sequence)
+}
+
+func (e *EmailService) RemoveMessage(key, id string) error {
+	return e.queueBox.RemoveMessage(key, id)
+}
+
+func incomingMessage(m *email.MessageInfo) IncomingMessage {
+	im := IncomingMessage{
+		ID:             m.MessageId(),
+		Address:        Address(*m.Sender()),
+		Subject:        m.Subject(),
+		Date:           m.Date(),
+		Authentication: m.Authentication(),
+		To:             addresses(m.To()),
+		Cc:             addresses(m.Cc()),
+		ReplyTo:        addresses(m.ReplyTo()),
+		InReplyTo:      m.InReplyTo(),
+		References:     m.References(),
+		ListID:         m.ListID(),
+		Headers:        m.Headers(),
+		ThreadID:       m.ThreadID(),
+		Bounce:         m.Bounce(),
+		Classification: m.Classification(),
+		Content:        m.Contents(),
+		File:           m.Files(),
+	}
+
+	for _, nested := range m.Messages() {
+		im.Messages = append(im.Messages, incomingMessage(nested))
+	}
+
+	return im
+}
+
+//Queues message with attachments and files streamed from multipart form,
+//the response of the first request is returned for repeated idempotency key
+func (e *EmailService) Send(message *model.Message, idempotencyKey string, files ...*model.File) (*QueuedMessage, bool, error) {
+	id, replayed, err := e.queueBox.Send(message, idempotencyKey, files...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	queued := &QueuedMessage{
+		MessageID: id,
+		Status:    StatusQueued,
+	}
+
+	if message.SendAt != nil {
+		sendAt := message.SendAt.UTC()
+
+		queued.Status = StatusScheduled
+		queued.SendAt = &sendAt
+	}
+
+	return queued, replayed, nil
+}
+
+func (e *EmailService) ScheduledList(key string) []*model.ScheduledMessage {
+	return e.queueBox.Scheduled(key)
+}
+
+func (e *EmailService) Scheduled(key, id string) (*model.ScheduledMessage, error) {
+	return e.queueBox.ScheduledMessage(key, id)
+}
+
+func (e *EmailService) Reschedule(key, id string, sendAt time.Time) (*model.ScheduledMessage, error) {
+	return e.queueBox.Reschedule(key, id, sendAt)
+}
+
+func (e *EmailService) CancelScheduled(key, id string) error {
+	return e.queueBox.CancelScheduled(key, id)
+}
+
+func (e *EmailService) ThreadList(key string) []*email.Thread {
+	return e.queueBox.Threads(key)
+}
+
+func (e *EmailService) Thread(key, id string) (*email.Thread, error) {
+	return e.queueBox.Thread(key, id)
+}
+
+func (e *EmailService) Suppressions(key string) []*model.Suppression {
+	return e.queueBox.Suppressions().List(key)
+}
+
+func (e *EmailService) Suppression(key, address string) (*model.Suppression, error) {
+	return e.queueBox.Suppressions().Find(key, address)
+}
+
+func (e *EmailService) AddSuppression(suppression *model.Suppression) (*model.Suppression, error) {
+	if len(suppression.Reason) == 0 {
+		suppression.Reason = email.SuppressionManual
+	}
+
+	return e.queueBox.Suppressions().Add(suppression)
+}
+
+func (e *EmailService) RemoveSuppression(key, address string) error {
+	return e.queueBox.Suppressions().Remove(key, address)
+}
+
+func (e *EmailService) Webhooks(key string) []*model.Webhook {
+	list := make([]*model.Webhook, 0)
+
+	for _, w := range e.queueBox.Webhooks().Store().List(key) {
+		list = append(list, withoutSecret(w))
+	}
+
+	return list
+}
+
+func (e *EmailService) Webhook(key, id string) (*model.Webhook, error) {
+	w, err := e.queueBox.Webhooks().Store().Find(key, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutSecret(w), nil
+}
+
+//Adds webhook, the secret is generated when it is not given and it is returned only once
+func (e *EmailService) AddWebhook(webhook *model.Webhook) (*model.Webhook, error) {
+	if len(webhook.Secret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
 		}
 
-		copy(im.Content, m.Contents())
-		copy(im.File, m.Files())
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	return e.queueBox.Webhooks().Store().Add(webhook)
+}
+
+func (e *EmailService) RemoveWebhook(key, id string) error {
+	return e.queueBox.Webhooks().Store().Remove(key, id)
+}
+
+//Delivery log of the webhook, the newest first
+func (e *EmailService) WebhookDeliveries(key, id string) ([]*model.WebhookDelivery, error) {
+	s := e.queueBox.Webhooks().Store()
 
-		list = append(list, im)
+	if _, err := s.Find(key, id); err != nil {
+		return nil, err
 	}
 
-	return list, nil
+	return s.Deliveries(key, id), nil
+}
+
+//Queues payload of the delivery to be posted again
+func (e *EmailService) ReplayDelivery(key, id, deliveryId string) (*model.WebhookDelivery, error) {
+	d, err := e.queueBox.Webhooks().Store().Delivery(key, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.WebhookID != id {
+		return nil, store.ErrDeliveryNotFound
+	}
+
+	return e.queueBox.Webhooks().Replay(key, deliveryId)
+}
+
+func withoutSecret(w *model.Webhook) *model.Webhook {
+	c := *w
+	c.Secret = ""
+
+	return &c
+}
+
+func (e *EmailService) Unsubscribe(token string) error {
+	return e.queueBox.Unsubscribe(token)
+}
+
+func addresses(list []*mail.Address) []Address {
+	addresses := make([]Address, 0, len(list))
+
+	for _, a := range list {
+		addresses = append(addresses, Address(*a))
+	}
+
+	return addresses
 }
@@ -0,0 +1,129 @@
+package router
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/rlaskowski/go-email/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//Scope required by every EmailService method, methods not listed are denied
+var grpcScopes = map[string]string{
+	"ReceiveMessage":    auth.ScopeReceive,
+	"ThreadList":        auth.ScopeReceive,
+	"GetThread":         auth.ScopeReceive,
+	"ListSuppressions":  auth.ScopeAdmin,
+	"GetSuppression":    auth.ScopeAdmin,
+	"AddSuppression":    auth.ScopeAdmin,
+	"RemoveSuppression": auth.ScopeAdmin,
+	"SendMessage":       auth.ScopeSend,
+	"ListScheduled":     auth.ScopeSend,
+	"RescheduleMessage": auth.ScopeSend,
+	"CancelScheduled":   auth.ScopeSend,
+}
+
+//Request of email account
+type keyRequest interface {
+	GetKey() string
+}
+
+//Authenticates unary calls and checks scope and account of the request
+func UnaryAuthInterceptor(authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !authenticator.Enabled() {
+			return handler(ctx, req)
+		}
+
+		p, err := grpcPrincipal(ctx, authenticator, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := grpcAuthorizeKey(p, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+
+		return handler(auth.NewContext(ctx, p), req)
+	}
+}
+
+//Authenticates streams, account of every received request is checked
+func StreamAuthInterceptor(authenticator *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !authenticator.Enabled() {
+			return handler(srv, ss)
+		}
+
+		p, err := grpcPrincipal(ss.Context(), authenticator, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authorizedStream{
+			ServerStream: ss,
+			principal:    p,
+			method:       info.FullMethod,
+		})
+	}
+}
+
+func grpcPrincipal(ctx context.Context, authenticator *auth.Authenticator, method string) (*auth.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	token := ""
+	if v := md.Get("authorization"); len(v) > 0 {
+		token = auth.BearerToken(v[0])
+	}
+
+	if v := md.Get(strings.ToLower(HeaderAPIKey)); len(token) == 0 && len(v) > 0 {
+		token = v[0]
+	}
+
+	p, err := authenticator.Authenticate(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+	}
+
+	scope, ok := grpcScopes[path.Base(method)]
+	if !ok || !p.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	return p, nil
+}
+
+func grpcAuthorizeKey(p *auth.Principal, method string, req interface{}) error {
+	r, ok := req.(keyRequest)
+	if !ok {
+		return nil
+	}
+
+	if err := p.Authorize(grpcScopes[path.Base(method)], r.GetKey()); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return nil
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	principal *auth.Principal
+	method    string
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return auth.NewContext(s.ServerStream.Context(), s.principal)
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return grpcAuthorizeKey(s.principal, s.method, m)
+}
@@ -26,8 +26,13 @@ func NewGrpcServer(registry registry.Registry) *GrpcServer {
 
 	sc := registry.ServiceConfig()
 
+	authenticator := registry.Authenticator()
+
 	g := &GrpcServer{
-		grpc:          grpc.NewServer(),
+		grpc: grpc.NewServer(
+			grpc.UnaryInterceptor(UnaryAuthInterceptor(authenticator)),
+			grpc.StreamInterceptor(StreamAuthInterceptor(authenticator)),
+		),
 		context:       ctx,
 		cancel:        cancel,
 		registry:      registry,
@@ -3,6 +3,7 @@ package router
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 const (
@@ -17,12 +18,18 @@ type Handler interface {
 
 	Param(key string) string
 
+	PathParam(name string) string
+
 	JSON(code int, i interface{})
 
 	Reload(rw http.ResponseWriter, r *http.Request)
 
 	Request() *http.Request
 
+	SetRequest(req *http.Request)
+
+	Response() *Response
+
 	Handler() HandlerFunc
 }
 
@@ -30,6 +37,7 @@ type Handle struct {
 	request  *http.Request
 	response *Response
 	handler  HandlerFunc
+	params   Params
 }
 
 func NewHandle(rw http.ResponseWriter, r *http.Request) *Handle {
@@ -48,6 +56,15 @@ func (h *Handle) Param(key string) string {
 	return query.Get(key)
 }
 
+//Value of named param or wildcard matched in the route path e.g. id for /receive/list/:id
+func (h *Handle) PathParam(name string) string {
+	return h.params[strings.TrimLeft(name, ":*")]
+}
+
+func (h *Handle) SetParams(params Params) {
+	h.params = params
+}
+
 func (h *Handle) Handler() HandlerFunc {
 	return h.handler
 }
@@ -59,8 +76,8 @@ func (h *Handle) writeContentType(content string) {
 
 func (h *Handle) json(code int, i interface{}) {
 	h.writeContentType(MIMEApplicationJson)
-	h.response.Status = code
-	enc := json.NewEncoder(h.response.Writer)
+	h.response.WriteHeader(code)
+	enc := json.NewEncoder(h.response)
 	enc.Encode(i)
 }
 
@@ -85,7 +102,7 @@ func (h *Handle) SetResponse(res *Response) {
 }
 
 func (h *Handle) Reload(rw http.ResponseWriter, r *http.Request) {
-	h.response.Writer = rw
+	h.response.reset(rw)
 	h.request = r
-
+	h.params = nil
 }
@@ -1,24 +1,44 @@
 package router
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/rlaskowski/go-email/auth"
 	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
 	"github.com/rlaskowski/go-email/registry"
+	"github.com/rlaskowski/go-email/store"
 )
 
 type HttpServer struct {
 	server        *http.Server
 	router        *Router
+	streams       *Router
 	context       context.Context
 	cancel        context.CancelFunc
 	registry      registry.Registry
 	serviceConfig config.ServiceConfig
 	handlePool    sync.Pool
+	middleware    []MiddlewareFunc
+}
+
+//Routes sharing path prefix and middleware
+type Group struct {
+	server     *HttpServer
+	prefix     string
+	middleware []MiddlewareFunc
 }
 
 func NewHttpServer(registry registry.Registry) *HttpServer {
@@ -30,6 +50,7 @@ func NewHttpServer(registry registry.Registry) *HttpServer {
 		context:       ctx,
 		cancel:        cancel,
 		router:        NewRouter(),
+		streams:       NewRouter(),
 		registry:      registry,
 		serviceConfig: sc,
 	}
@@ -46,9 +67,59 @@ func NewHttpServer(registry registry.Registry) *HttpServer {
 		return NewHandle(nil, nil)
 	}
 
+	h.configureMiddleware()
+
 	return h
 }
 
+func (h *HttpServer) configureMiddleware() {
+	sc := h.serviceConfig
+
+	h.Use(RequestID())
+
+	if sc.HttpAccessLog {
+		h.Use(AccessLog())
+	}
+
+	h.Use(Recover())
+
+	if len(sc.HttpCORSAllowOrigins) > 0 {
+		h.Use(CORS(CORSConfig{
+			AllowOrigins: sc.HttpCORSAllowOrigins,
+			AllowHeaders: sc.HttpCORSAllowHeaders,
+			MaxAge:       sc.HttpCORSMaxAge,
+		}))
+	}
+
+	if sc.HttpMaxBodySize > 0 {
+		h.Use(BodyLimit(sc.HttpMaxBodySize))
+	}
+
+	if sc.HttpRequestTimeout > 0 {
+		h.Use(TimeoutWithConfig(TimeoutConfig{
+			Timeout: sc.HttpRequestTimeout,
+			Skipper: h.streamed,
+		}))
+	}
+
+	if sc.HttpGzip {
+		h.Use(Gzip(gzip.DefaultCompression))
+	}
+}
+
+//Adds middleware run for every request, including not matched ones
+func (h *HttpServer) Use(middleware ...MiddlewareFunc) {
+	h.middleware = append(h.middleware, middleware...)
+}
+
+func (h *HttpServer) Group(prefix string, middleware ...MiddlewareFunc) *Group {
+	return &Group{
+		server:     h,
+		prefix:     prefix,
+		middleware: middleware,
+	}
+}
+
 func (h *HttpServer) Start() error {
 	go func() {
 		h.configureEndpoints()
@@ -76,10 +147,59 @@ func (h *HttpServer) Stop() error {
 }
 
 func (h *HttpServer) configureEndpoints() {
-	//h.Post("/file/send", h.SendWithFile)
-	//h.Post("/send", h.Send)
-	h.Get("/receive/list", h.ReceiveList)
-	h.Get("/receive/list/:id", h.ReceiveByID)
+	authenticator := h.registry.Authenticator()
+
+	//routes reading account key from JSON body
+	h.Group("/send", AuthorizeBody(authenticator, auth.ScopeSend)).Post("", h.Send)
+	h.Group("/webhooks", AuthorizeBody(authenticator, auth.ScopeWebhooks)).Post("", h.AddWebhook)
+	h.Group("", AuthorizeBody(authenticator, auth.ScopeAdmin)).Post("/suppression", h.AddSuppression)
+
+	send := h.Group("/send", Authorize(authenticator, auth.ScopeSend))
+	send.Post("/multipart", h.SendWithFile)
+	send.Get("/scheduled", h.ScheduledList)
+	send.Get("/scheduled/:id", h.Scheduled)
+	send.Put("/scheduled/:id", h.Reschedule)
+	send.Delete("/scheduled/:id", h.CancelScheduled)
+
+	receive := h.Group("/receive", Authorize(authenticator, auth.ScopeReceive))
+	receive.Get("/list", h.ReceiveList)
+	receive.Get("/list/:id", h.ReceiveByID)
+	receive.Get("/threads", h.ThreadList)
+	receive.Get("/thread", h.Thread)
+
+	messages := h.Group("/messages", Authorize(authenticator, auth.ScopeReceive))
+	messages.Get("", h.MessageList)
+	messages.Stream("/stream", h.MessageStream)
+	messages.Get("/:id", h.Message)
+	messages.Delete("/:id", h.RemoveMessage)
+	messages.Get("/:id/attachments/:attachmentId", h.Attachment)
+
+	webhooks := h.Group("/webhooks", Authorize(authenticator, auth.ScopeWebhooks))
+	webhooks.Get("", h.WebhookList)
+	webhooks.Get("/:id", h.Webhook)
+	webhooks.Delete("/:id", h.RemoveWebhook)
+	webhooks.Get("/:id/deliveries", h.WebhookDeliveries)
+	webhooks.Post("/:id/deliveries/:deliveryId/replay", h.ReplayDelivery)
+
+	admin := h.Group("", Authorize(authenticator, auth.ScopeAdmin))
+	admin.Get("/suppressions", h.SuppressionList)
+	admin.Get("/suppression", h.Suppression)
+	admin.Delete("/suppression", h.RemoveSuppression)
+
+	//called by mail clients with the signed token only
+	h.Post("/unsubscribe", h.Unsubscribe)
+}
+
+//Checks access to the account not passed as key form value, writes 403 when denied
+func (h *HttpServer) canAccess(handler Handler, key string) bool {
+	p := auth.FromContext(handler.Request().Context())
+	if p == nil || p.CanAccess(key) {
+		return true
+	}
+
+	handler.JSON(http.StatusForbidden, auth.ErrForbidden.Error())
+
+	return false
 }
 
 func (h *HttpServer) add(method, path string, handler HandlerFunc) {
@@ -118,153 +238,673 @@ func (h *HttpServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	handle.Reload(rw, r)
 
-	handlerFunc := h.router.FindHandle(r.Method, r.URL.Path)
+	applyMiddleware(h.dispatch, h.middleware)(handle)
+}
+
+func (h *HttpServer) dispatch(handler Handler) {
+	r := handler.Request()
+
+	handlerFunc, params, allowed := h.router.Find(r.Method, r.URL.Path)
 
-	if !(handlerFunc == nil) {
-		handlerFunc(handle)
+	switch {
+	case handlerFunc != nil:
+		if handle, ok := handler.(*Handle); ok {
+			handle.SetParams(params)
+		}
+		handlerFunc(handler)
+	case len(allowed) > 0:
+		handler.Response().Header().Set("Allow", strings.Join(allowed, ", "))
+		handler.JSON(http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	default:
+		handler.JSON(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+}
+
+//Adds middleware run only for routes of the group
+func (g *Group) Use(middleware ...MiddlewareFunc) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+func (g *Group) Group(prefix string, middleware ...MiddlewareFunc) *Group {
+	return &Group{
+		server:     g.server,
+		prefix:     g.prefix + prefix,
+		middleware: append(append([]MiddlewareFunc{}, g.middleware...), middleware...),
 	}
 }
 
+func (g *Group) add(method, path string, handlerFunc HandlerFunc) {
+	//middleware is applied per request so Use could be called after adding routes
+	g.server.add(method, g.prefix+path, func(handler Handler) {
+		applyMiddleware(handlerFunc, g.middleware)(handler)
+	})
+}
+
+func (g *Group) Get(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodGet, path, handlerFunc)
+}
+
+func (g *Group) Post(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodPost, path, handlerFunc)
+}
+
+func (g *Group) Put(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodPut, path, handlerFunc)
+}
+
+func (g *Group) Delete(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodDelete, path, handlerFunc)
+}
+
+func (g *Group) Options(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodOptions, path, handlerFunc)
+}
+
+func (g *Group) Head(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodHead, path, handlerFunc)
+}
+
+//Adds GET route of long-lived response, which is not limited by the request timeout
+func (g *Group) Stream(path string, handlerFunc HandlerFunc) {
+	g.add(http.MethodGet, path, handlerFunc)
+	g.server.streams.Add(http.MethodGet, g.prefix+path, handlerFunc)
+}
+
+//Checks if request is routed to the stream
+func (h *HttpServer) streamed(r *http.Request) bool {
+	return h.streams.FindHandle(r.Method, r.URL.Path) != nil
+}
+
 func (h *HttpServer) ReceiveList(handler Handler) {
 	key := handler.FormValue("key")
+	format := handler.FormValue("format")
 
 	es := h.registry.EmailRestService()
 
-	list, err := es.ReceiveList(key)
+	list, err := es.ReceiveList(key, format)
 	if err != nil {
-		handler.JSON(http.StatusBadRequest, err)
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
 	}
 
 	handler.JSON(http.StatusOK, list)
 }
 
+//Received message by ID from the message index
 func (h *HttpServer) ReceiveByID(handler Handler) {
-	id := handler.Param(":id")
+	h.Message(handler)
+}
+
+//Page of received messages filtered by sender, recipient, subject, date range and attachments
+func (h *HttpServer) MessageList(handler Handler) {
+	key := handler.FormValue("key")
+
+	filter, err := messageFilter(handler)
+	if err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	es := h.registry.EmailRestService()
+
+	page, err := es.Messages(key, filter)
+	if err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
 
-	fmt.Println(id)
+	handler.JSON(http.StatusOK, page)
 }
 
-func (h *HttpServer) SendWithFile(rw http.ResponseWriter, r *http.Request) {
-	/*var result error
+//Streams received messages with Server-Sent Events, messages missed since Last-Event-ID
+//header or last_event_id param are sent first. Stream is not limited by the server timeouts,
+//it is closed when the client disconnects or the server stops and the client resumes it from the last event
+func (h *HttpServer) MessageStream(handler Handler) {
+	key := handler.FormValue("key")
+	if len(key) == 0 {
+		handler.JSON(http.StatusBadRequest, "key is required")
+		return
+	}
 
-	multipartReader, err := r.MultipartReader()
+	filter, err := messageFilter(handler)
 	if err != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
+		handler.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	//c := r.Context()
 
-	multipartController := h.acquireMultipart(multipartReader)
+	lastEventId := handler.Request().Header.Get(HeaderLastEventID)
+	if len(lastEventId) == 0 {
+		lastEventId = handler.Param("last_event_id")
+	}
 
-	message, err := multipartController.Message()
+	stream := &messageStream{
+		response:  handler.Response(),
+		filter:    filter,
+		heartbeat: h.serviceConfig.HttpStreamHeartbeat,
+	}
+
+	if len(lastEventId) > 0 {
+		last, err := strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil || last < 0 {
+			handler.JSON(http.StatusBadRequest, fmt.Sprintf("Last event ID %q is not valid", lastEventId))
+			return
+		}
+
+		stream.last = last
+	}
+
+	if stream.heartbeat <= 0 {
+		stream.heartbeat = config.DefaultServiceConfig.HttpStreamHeartbeat
+	}
+
+	es := h.registry.EmailRestService()
+
+	//subscribed before the index is read, so no message is lost between them
+	sub, err := es.Subscribe(key)
 	if err != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	defer sub.Close()
+
+	var missed []*model.ReceivedMessage
+	if len(lastEventId) > 0 {
+		missed = es.MessagesSince(key, stream.last)
+	}
+
+	stream.serve(handler.Request(), sub, missed)
+}
+
+func messageFilter(handler Handler) (*model.MessageFilter, error) {
+	filter := &model.MessageFilter{
+		Sender:    handler.Param("sender"),
+		Recipient: handler.Param("recipient"),
+		Subject:   handler.Param("subject"),
+		Cursor:    handler.Param("cursor"),
+	}
+
+	if v := handler.Param("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("Limit %q is not a positive number", v)
+		}
+
+		filter.Limit = limit
+	}
+
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		v := handler.Param(name)
+		if len(v) == 0 {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse %s due to: %s", name, err)
+		}
+
+		*t = parsed
+	}
+
+	if v := handler.Param("has_attachment"); len(v) > 0 {
+		hasAttachment, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse has_attachment due to: %s", err)
+		}
+
+		filter.HasAttachment = &hasAttachment
+	}
+
+	return filter, nil
+}
+
+func (h *HttpServer) Message(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+	format := handler.FormValue("format")
+
+	es := h.registry.EmailRestService()
+
+	m, err := es.Message(key, id, format)
+	switch err {
+	case nil:
+		handler.JSON(http.StatusOK, m)
+	case store.ErrMessageNotFound:
+		handler.JSON(http.StatusNotFound, err.Error())
+	default:
+		handler.JSON(http.StatusBadRequest, err.Error())
+	}
+}
+
+//Streams attachment of received message, Range, If-Range and If-None-Match requests are handled by ServeContent
+func (h *HttpServer) Attachment(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+	attachmentId := handler.PathParam("attachmentId")
+
+	es := h.registry.EmailRestService()
+
+	a, file, err := es.Attachment(key, id, attachmentId)
+	switch err {
+	case nil:
+	case store.ErrMessageNotFound, store.ErrAttachmentNotFound:
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
+	default:
+		handler.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer file.Close()
+
+	contentType := a.ContentType
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+
+	header := handler.Response().Header()
+	header.Set(HeaderContentType, contentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	header.Set("ETag", fmt.Sprintf("%q", a.Checksum))
+
+	//checksum ETag is used for conditional requests, so modification time is not sent
+	http.ServeContent(handler.Response(), handler.Request(), "", time.Time{}, file)
+}
+
+func (h *HttpServer) RemoveMessage(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+
+	es := h.registry.EmailRestService()
+
+	if err := es.RemoveMessage(key, id); err != nil {
+		handler.JSON(http.StatusNotFound, err.Error())
 		return
 	}
 
-	file, err := multipartController.File()
+	handler.JSON(http.StatusOK, map[string]string{
+		"result": "Message removed successfully",
+	})
+}
+
+func (h *HttpServer) ThreadList(handler Handler) {
+	key := handler.FormValue("key")
+
+	es := h.registry.EmailRestService()
+
+	handler.JSON(http.StatusOK, es.ThreadList(key))
+}
+
+func (h *HttpServer) Thread(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.FormValue("id")
+
+	es := h.registry.EmailRestService()
+
+	thread, err := es.Thread(key, id)
 	if err != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	handler.JSON(http.StatusOK, thread)
+}
+
+func (h *HttpServer) SuppressionList(handler Handler) {
+	key := handler.FormValue("key")
+
+	es := h.registry.EmailRestService()
+
+	handler.JSON(http.StatusOK, es.Suppressions(key))
+}
+
+func (h *HttpServer) Suppression(handler Handler) {
+	key := handler.FormValue("key")
+	address := handler.FormValue("address")
+
+	es := h.registry.EmailRestService()
+
+	s, err := es.Suppression(key, address)
+	if err != nil {
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	handler.JSON(http.StatusOK, s)
+}
+
+func (h *HttpServer) AddSuppression(handler Handler) {
+	suppression := new(model.Suppression)
+
+	if err := json.NewDecoder(handler.Request().Body).Decode(suppression); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
 	}
 
-	que, err := h.registries.QueueFactory.GetOrCreate(queue.EmailQueueType)
+	if !h.canAccess(handler, suppression.Key) {
+		return
+	}
+
+	es := h.registry.EmailRestService()
+
+	s, err := es.AddSuppression(suppression)
 	if err != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
+		handler.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	 if err := que.Publish(queue.SubjectSending, message, file); err != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
+	handler.JSON(http.StatusCreated, s)
+}
+
+func (h *HttpServer) RemoveSuppression(handler Handler) {
+	key := handler.FormValue("key")
+	address := handler.FormValue("address")
+
+	es := h.registry.EmailRestService()
+
+	if err := es.RemoveSuppression(key, address); err != nil {
+		handler.JSON(http.StatusNotFound, err.Error())
 		return
 	}
 
-	if result != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
-	} else {
-		h.json(rw, map[string]string{
-			"result": "Message published successfully",
-		})
-		rw.WriteHeader(http.StatusOK)
-	}*/
+	handler.JSON(http.StatusOK, map[string]string{
+		"result": "Suppression removed successfully",
+	})
+}
+
+func (h *HttpServer) WebhookList(handler Handler) {
+	key := handler.FormValue("key")
+
+	es := h.registry.EmailRestService()
 
+	handler.JSON(http.StatusOK, es.Webhooks(key))
 }
 
-func (h *HttpServer) Send(rw http.ResponseWriter, r *http.Request) {
-	/*var result error
+func (h *HttpServer) Webhook(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
 
-	messageForm := r.FormValue("message")
+	es := h.registry.EmailRestService()
 
-	message := new(model.Message)
+	w, err := es.Webhook(key, id)
+	if err != nil {
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	handler.JSON(http.StatusOK, w)
+}
+
+//Adds webhook of the account, the response contains the secret payloads are signed with
+func (h *HttpServer) AddWebhook(handler Handler) {
+	webhook := new(model.Webhook)
 
-	if err := json.Unmarshal([]byte(messageForm), message); err != nil {
-		result = h.multiFailure(err.Error())
+	if err := json.NewDecoder(handler.Request().Body).Decode(webhook); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := webhook.Validate(); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.canAccess(handler, webhook.Key) {
+		return
 	}
 
-	 que, err := h.registries.QueueFactory.GetOrCreate(queue.EmailQueueType)
+	es := h.registry.EmailRestService()
+
+	w, err := es.AddWebhook(webhook)
 	if err != nil {
-		result = h.multiFailure(err.Error())
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if err := que.Publish(queue.SubjectSending, message); err != nil {
-		result = h.multiFailure(err.Error())
+	handler.JSON(http.StatusCreated, w)
+}
+
+func (h *HttpServer) RemoveWebhook(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+
+	es := h.registry.EmailRestService()
+
+	if err := es.RemoveWebhook(key, id); err != nil {
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
 	}
 
-	if result != nil {
-		rw.WriteHeader(http.StatusBadRequest)
-		rw.Write([]byte(err.Error()))
-	} else {
-		h.json(rw, map[string]string{
-			"result": "Message published successfully",
-		})
-		rw.WriteHeader(http.StatusOK)
-	}*/
+	handler.JSON(http.StatusOK, map[string]string{
+		"result": "Webhook removed successfully",
+	})
+}
+
+func (h *HttpServer) WebhookDeliveries(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+
+	es := h.registry.EmailRestService()
+
+	list, err := es.WebhookDeliveries(key, id)
+	if err != nil {
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	handler.JSON(http.StatusOK, list)
+}
+
+//Posts payload of the delivery again, the new delivery is sent with the next attempts
+func (h *HttpServer) ReplayDelivery(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+	deliveryId := handler.PathParam("deliveryId")
+
+	es := h.registry.EmailRestService()
+
+	d, err := es.ReplayDelivery(key, id, deliveryId)
+	switch err {
+	case nil:
+		handler.JSON(http.StatusAccepted, d)
+	case store.ErrWebhookNotFound, store.ErrDeliveryNotFound:
+		handler.JSON(http.StatusNotFound, err.Error())
+	default:
+		handler.JSON(http.StatusInternalServerError, err.Error())
+	}
+}
+
+//One-click unsubscribe (RFC 8058) requested by mail client with List-Unsubscribe=One-Click body
+func (h *HttpServer) Unsubscribe(handler Handler) {
+	token := handler.Request().URL.Query().Get("token")
 
+	es := h.registry.EmailRestService()
+
+	if err := es.Unsubscribe(token); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	handler.JSON(http.StatusOK, map[string]string{
+		"result": "Unsubscribed successfully",
+	})
 }
 
-/* func (h *HttpServer) storeFile(multipartController *controller.MutlipartController) (string, error) {
-	file, err := multipartController.File()
+//Sends message with attachments, the message form is followed by file forms which are read one by one
+func (h *HttpServer) SendWithFile(handler Handler) {
+	reader, err := handler.Request().MultipartReader()
 	if err != nil {
-		return "", err
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
 	}
 
-	fileStore := store.NewFileStore(config.FileStorePath)
+	multipartController := &MutlipartController{Reader: reader}
 
-	fileuuid, err := fileStore.Store(file)
+	message, err := multipartController.Message()
 	if err != nil {
-		return "", err
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.canAccess(handler, message.Key) {
+		return
+	}
+
+	files := make([]*model.File, 0)
+
+	for {
+		file, err := multipartController.NextFile()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			handler.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		data, err := ioutil.ReadAll(file.Reader)
+		if err != nil {
+			handler.JSON(http.StatusBadRequest, fmt.Sprintf("Could not read file %s due to: %s", file.Name, err))
+			return
+		}
+
+		file.Data = data
+		file.Size = int64(len(data))
+
+		files = append(files, file)
+	}
+
+	h.send(handler, message, files...)
+}
+
+//Sends message from JSON body, attachments data is base64 encoded
+func (h *HttpServer) Send(handler Handler) {
+	message := new(model.Message)
+
+	if err := json.NewDecoder(handler.Request().Body).Decode(message); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := message.Validate(); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.canAccess(handler, message.Key) {
+		return
+	}
+
+	h.send(handler, message)
+}
+
+//Sends message once per Idempotency-Key header, the original response is returned for repeated requests
+func (h *HttpServer) send(handler Handler, message *model.Message, files ...*model.File) {
+	idempotencyKey := handler.Request().Header.Get(HeaderIdempotencyKey)
+
+	es := h.registry.EmailRestService()
+
+	queued, replayed, err := es.Send(message, idempotencyKey, files...)
+	switch err {
+	case nil:
+	case store.ErrIdempotencyKeyReused:
+		handler.JSON(http.StatusUnprocessableEntity, err.Error())
+		return
+	case store.ErrIdempotencyInProgress:
+		handler.JSON(http.StatusConflict, err.Error())
+		return
+	default:
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if replayed {
+		handler.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	}
+
+	handler.JSON(http.StatusAccepted, queued)
+}
+
+func (h *HttpServer) ScheduledList(handler Handler) {
+	key := handler.FormValue("key")
+	if len(key) == 0 {
+		handler.JSON(http.StatusBadRequest, "key is required")
+		return
+	}
+
+	if !h.canAccess(handler, key) {
+		return
 	}
 
-	return fileuuid, nil
-} */
+	es := h.registry.EmailRestService()
 
-/* func (h *HttpServer) multiFailure(err string) error {
-	return fmt.Errorf("%s\r\n", err)
+	handler.JSON(http.StatusOK, es.ScheduledList(key))
 }
 
-func (h *HttpServer) json(rw http.ResponseWriter, i interface{}) {
-	rw.Header().Add("Content-Type", "application/json")
+func (h *HttpServer) Scheduled(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
 
-	marshal, err := json.Marshal(i)
+	es := h.registry.EmailRestService()
+
+	m, err := es.Scheduled(key, id)
 	if err != nil {
-		rw.Write([]byte(err.Error()))
+		handler.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	handler.JSON(http.StatusOK, m)
+}
+
+//Moves scheduled message to send_at time from JSON body
+func (h *HttpServer) Reschedule(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
+
+	body := struct {
+		SendAt time.Time `json:"send_at"`
+	}{}
+
+	if err := json.NewDecoder(handler.Request().Body).Decode(&body); err != nil {
+		handler.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if body.SendAt.IsZero() {
+		handler.JSON(http.StatusBadRequest, "send_at is required")
+		return
+	}
+
+	es := h.registry.EmailRestService()
+
+	m, err := es.Reschedule(key, id, body.SendAt)
+	switch err {
+	case nil:
+		handler.JSON(http.StatusOK, m)
+	case store.ErrScheduledReleased:
+		handler.JSON(http.StatusConflict, err.Error())
+	default:
+		handler.JSON(http.StatusNotFound, err.Error())
 	}
-	rw.Write(marshal)
 }
 
-func (h *HttpServer) acquireMultipart(reader *multipart.Reader) *controller.MutlipartController {
-	m := h.multipartPool.Get().(*controller.MutlipartController)
-	defer h.multipartPool.Put(m)
+func (h *HttpServer) CancelScheduled(handler Handler) {
+	key := handler.FormValue("key")
+	id := handler.PathParam("id")
 
-	m.Reader = reader
+	es := h.registry.EmailRestService()
 
-	return m
-} */
+	switch err := es.CancelScheduled(key, id); err {
+	case nil:
+		handler.JSON(http.StatusOK, map[string]string{
+			"result": "Scheduled message cancelled successfully",
+		})
+	case store.ErrScheduledReleased:
+		handler.JSON(http.StatusConflict, err.Error())
+	default:
+		handler.JSON(http.StatusNotFound, err.Error())
+	}
+}
 
 /* func (h *HttpServer) BME280(rw http.ResponseWriter, r *http.Request) {
 	driver, err := h.registries.RaspiDriver.BME280Driver()
@@ -0,0 +1,488 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rlaskowski/go-email/auth"
+)
+
+const (
+	HeaderRequestID       = "X-Request-ID"
+	HeaderAPIKey          = "X-API-Key"
+	HeaderAcceptEncoding  = "Accept-Encoding"
+	HeaderContentEncoding = "Content-Encoding"
+	HeaderVary            = "Vary"
+	HeaderAcceptRanges    = "Accept-Ranges"
+
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+//Wraps handler with behaviour shared by many routes
+type MiddlewareFunc func(next HandlerFunc) HandlerFunc
+
+//Wraps handler with middleware, the first one is the outermost
+func applyMiddleware(handler HandlerFunc, middleware []MiddlewareFunc) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+//Responds with 500 instead of dropping the connection when handler panics
+func Recover() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Recovered from panic in %s %s: %v\n%s", h.Request().Method, h.Request().URL.Path, r, debug.Stack())
+
+					if !h.Response().Committed {
+						h.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+					}
+				}
+			}()
+
+			next(h)
+		}
+	}
+}
+
+//Passes X-Request-ID from the client or generates a new one, the ID is returned in the response
+func RequestID() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			id := h.Request().Header.Get(HeaderRequestID)
+			if len(id) == 0 || len(id) > 128 {
+				id = uuid.New().String()
+				h.Request().Header.Set(HeaderRequestID, id)
+			}
+
+			h.Response().Header().Set(HeaderRequestID, id)
+
+			next(h)
+		}
+	}
+}
+
+func AccessLog() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			start := time.Now()
+			r := h.Request()
+
+			defer func() {
+				res := h.Response()
+				log.Printf("%s %s %d %d bytes %s, remote %s, request %s", r.Method, r.URL.RequestURI(), res.Status, res.Size, time.Since(start), r.RemoteAddr, r.Header.Get(HeaderRequestID))
+			}()
+
+			next(h)
+		}
+	}
+}
+
+type CORSConfig struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+//Allows browsers from configured origins to call the API, preflight requests are answered directly
+func CORS(config CORSConfig) MiddlewareFunc {
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			origin := h.Request().Header.Get("Origin")
+			header := h.Response().Header()
+
+			header.Add(HeaderVary, "Origin")
+
+			if len(origin) == 0 || !config.allowed(origin) {
+				next(h)
+				return
+			}
+
+			allowOrigin := origin
+			if config.wildcard() && !config.AllowCredentials {
+				allowOrigin = "*"
+			}
+
+			header.Set("Access-Control-Allow-Origin", allowOrigin)
+			header.Set("Access-Control-Expose-Headers", HeaderRequestID)
+
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := h.Request().Method == http.MethodOptions && len(h.Request().Header.Get("Access-Control-Request-Method")) > 0
+			if !preflight {
+				next(h)
+				return
+			}
+
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+			if len(config.AllowHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowHeaders, ", "))
+			}
+
+			if config.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+
+			h.Response().WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func (c CORSConfig) allowed(origin string) bool {
+	for _, o := range c.AllowOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c CORSConfig) wildcard() bool {
+	for _, o := range c.AllowOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Rejects requests with body larger than limit bytes
+func BodyLimit(limit int64) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			r := h.Request()
+
+			if r.ContentLength > limit {
+				h.JSON(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is larger than %d bytes", limit))
+				return
+			}
+
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(h.Response(), r.Body, limit)
+			}
+
+			next(h)
+		}
+	}
+}
+
+type TimeoutConfig struct {
+	Timeout time.Duration
+	//Skips requests which are not limited e.g. streams, nil limits every request
+	Skipper func(r *http.Request) bool
+}
+
+//Runs handler with buffered response, which is sent when handler returns in time. Otherwise
+//request context is cancelled, 503 is sent and later writes of the handler are discarded
+func Timeout(timeout time.Duration) MiddlewareFunc {
+	return TimeoutWithConfig(TimeoutConfig{Timeout: timeout})
+}
+
+func TimeoutWithConfig(config TimeoutConfig) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			if config.Skipper != nil && config.Skipper(h.Request()) {
+				next(h)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(h.Request().Context(), config.Timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: h.Response().Header().Clone()}
+
+			//handler could run after the timeout, so it gets own handle instead of the pooled one
+			th := NewHandle(tw, h.Request().WithContext(ctx))
+			if handle, ok := h.(*Handle); ok {
+				th.SetParams(handle.params)
+			}
+
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						panicked <- r
+					}
+				}()
+
+				next(th)
+				close(done)
+			}()
+
+			select {
+			case r := <-panicked:
+				//raised again, so it is handled by Recover
+				panic(r)
+			case <-done:
+				tw.writeTo(h.Response())
+			case <-ctx.Done():
+				tw.timeout()
+
+				if ctx.Err() == context.DeadlineExceeded {
+					h.JSON(http.StatusServiceUnavailable, "Request timed out")
+				}
+			}
+		}
+	}
+}
+
+//Buffers response of the handler limited by the Timeout, writes after the timeout fail
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (t *timeoutWriter) Header() http.Header {
+	return t.header
+}
+
+func (t *timeoutWriter) WriteHeader(code int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timedOut || t.code != 0 {
+		return
+	}
+
+	t.code = code
+}
+
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if t.code == 0 {
+		t.code = http.StatusOK
+	}
+
+	return t.buf.Write(b)
+}
+
+func (t *timeoutWriter) timeout() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timedOut = true
+}
+
+//Sends buffered response of the handler
+func (t *timeoutWriter) writeTo(res *Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	header := res.Header()
+	for k := range header {
+		delete(header, k)
+	}
+
+	for k, v := range t.header {
+		header[k] = v
+	}
+
+	if t.code == 0 {
+		return
+	}
+
+	res.WriteHeader(t.code)
+
+	if _, err := res.Write(t.buf.Bytes()); err != nil {
+		log.Printf("Could not write response due to: %s", err)
+	}
+}
+
+//Compresses response body when client accepts gzip encoding
+func Gzip(level int) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			h.Response().Header().Add(HeaderVary, HeaderAcceptEncoding)
+
+			if h.Request().Method == http.MethodHead || !acceptsGzip(h.Request().Header.Get(HeaderAcceptEncoding)) {
+				next(h)
+				return
+			}
+
+			res := h.Response()
+			gw := &gzipWriter{ResponseWriter: res.Writer, level: level}
+			res.Writer = gw
+
+			defer func() {
+				res.Writer = gw.ResponseWriter
+				gw.Close()
+			}()
+
+			next(h)
+		}
+	}
+}
+
+func acceptsGzip(accept string) bool {
+	for _, e := range strings.Split(accept, ",") {
+		e = strings.TrimSpace(e)
+		if e == "gzip" || (strings.HasPrefix(e, "gzip;") && !strings.HasSuffix(strings.ReplaceAll(e, " ", ""), "q=0")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Starts compression on the first write, so empty responses are sent without gzip framing
+type gzipWriter struct {
+	http.ResponseWriter
+	level    int
+	compress bool
+	writer   *gzip.Writer
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	//already encoded body is passed through, ranges refer to not compressed body
+	if code != http.StatusNoContent && code != http.StatusNotModified && code != http.StatusPartialContent &&
+		len(g.Header().Get(HeaderContentEncoding)) == 0 && len(g.Header().Get(HeaderAcceptRanges)) == 0 {
+		g.compress = true
+		g.Header().Set(HeaderContentEncoding, "gzip")
+		g.Header().Del("Content-Length")
+	}
+
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+	if g.writer == nil {
+		if !g.compress {
+			return g.ResponseWriter.Write(b)
+		}
+
+		w, err := gzip.NewWriterLevel(g.ResponseWriter, g.level)
+		if err != nil {
+			return 0, err
+		}
+
+		g.writer = w
+	}
+
+	return g.writer.Write(b)
+}
+
+func (g *gzipWriter) Flush() {
+	if g.writer != nil {
+		g.writer.Flush()
+	}
+
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipWriter) Close() error {
+	if g.writer == nil {
+		return nil
+	}
+
+	return g.writer.Close()
+}
+
+//Account key from query or urlencoded form, multipart body is not parsed so handler could stream it
+func accountKey(h Handler) string {
+	if strings.HasPrefix(h.Request().Header.Get(HeaderContentType), "multipart/") {
+		return h.Param("key")
+	}
+
+	return h.FormValue("key")
+}
+
+//Requires API key or JWT with the scope, access to account from key form value is checked too
+func Authorize(authenticator *auth.Authenticator, scope string) MiddlewareFunc {
+	return authorize(authenticator, scope, false)
+}
+
+//Authorize for routes reading account key from JSON body, when key form value is missing
+//only the scope is checked and the handler has to check the key with canAccess
+func AuthorizeBody(authenticator *auth.Authenticator, scope string) MiddlewareFunc {
+	return authorize(authenticator, scope, true)
+}
+
+func authorize(authenticator *auth.Authenticator, scope string, keyInBody bool) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(h Handler) {
+			if !authenticator.Enabled() {
+				next(h)
+				return
+			}
+
+			r := h.Request()
+
+			token := auth.BearerToken(r.Header.Get("Authorization"))
+			if len(token) == 0 {
+				token = r.Header.Get(HeaderAPIKey)
+			}
+
+			p, err := authenticator.Authenticate(token)
+			if err != nil {
+				h.Response().Header().Set("WWW-Authenticate", `Bearer realm="go-email"`)
+				h.JSON(http.StatusUnauthorized, auth.ErrUnauthenticated.Error())
+				return
+			}
+
+			key := accountKey(h)
+
+			//key of JSON body is checked by the handler with canAccess after the body is decoded
+			if len(key) == 0 && keyInBody {
+				err = nil
+				if !p.HasScope(scope) {
+					err = auth.ErrForbidden
+				}
+			} else {
+				err = p.Authorize(scope, key)
+			}
+
+			if err != nil {
+				h.JSON(http.StatusForbidden, err.Error())
+				return
+			}
+
+			h.SetRequest(r.WithContext(auth.NewContext(r.Context(), p)))
+
+			next(h)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package router
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/auth"
+	"github.com/rlaskowski/go-email/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer() *HttpServer {
+	h := &HttpServer{router: NewRouter(), streams: NewRouter()}
+	h.handlePool.New = func() interface{} {
+		return NewHandle(nil, nil)
+	}
+
+	return h
+}
+
+func TestRecoverAndRequestID(t *testing.T) {
+	h := newTestServer()
+	h.Use(RequestID(), Recover())
+
+	h.Get("/panic", func(handler Handler) {
+		panic("broken handler")
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(HeaderRequestID))
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(HeaderRequestID, "client-id")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, "client-id", rec.Header().Get(HeaderRequestID))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := newTestServer()
+	h.Use(CORS(CORSConfig{
+		AllowOrigins: []string{"https://app.golang.org"},
+		AllowHeaders: []string{"Content-Type"},
+		MaxAge:       time.Minute,
+	}))
+
+	h.Post("/suppression", func(handler Handler) {
+		handler.JSON(http.StatusCreated, "created")
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/suppression", nil)
+	req.Header.Set("Origin", "https://app.golang.org")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.golang.org", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Content-Type", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "60", rec.Header().Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest(http.MethodPost, "/suppression", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestGzip(t *testing.T) {
+	h := newTestServer()
+	h.Use(Gzip(gzip.BestSpeed))
+
+	h.Get("/list", func(handler Handler) {
+		handler.JSON(http.StatusOK, strings.Repeat("message ", 100))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/list", nil)
+	req.Header.Set(HeaderAcceptEncoding, "br, gzip")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, "gzip", rec.Header().Get(HeaderContentEncoding))
+
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `"`+strings.Repeat("message ", 100)+`"`+"\n", string(body))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/list", nil))
+
+	assert.Empty(t, rec.Header().Get(HeaderContentEncoding))
+}
+
+func TestBodyLimitInGroup(t *testing.T) {
+	h := newTestServer()
+
+	g := h.Group("/api")
+	g.Post("/upload", func(handler Handler) {
+		if _, err := ioutil.ReadAll(handler.Request().Body); err != nil {
+			handler.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		handler.JSON(http.StatusOK, "uploaded")
+	})
+	g.Use(BodyLimit(8))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader("small")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader("too large body")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestTimeout(t *testing.T) {
+	h := newTestServer()
+	h.Use(Timeout(10 * time.Millisecond))
+
+	h.Get("/slow", func(handler Handler) {
+		<-handler.Request().Context().Done()
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestTimeoutDiscardsLateWrites(t *testing.T) {
+	h := newTestServer()
+	h.Use(Recover(), Timeout(20*time.Millisecond))
+
+	written := make(chan error, 1)
+
+	h.Get("/late", func(handler Handler) {
+		time.Sleep(50 * time.Millisecond)
+
+		_, err := handler.Response().Write([]byte("late"))
+		written <- err
+	})
+	h.Get("/fast/:id", func(handler Handler) {
+		handler.Response().Header().Set("X-Id", handler.PathParam("id"))
+		handler.JSON(http.StatusCreated, "created")
+	})
+	h.Get("/panic", func(handler Handler) {
+		panic("handler failed")
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/late", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, http.ErrHandlerTimeout, <-written)
+	assert.NotContains(t, rec.Body.String(), "late")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast/1", nil))
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Id"))
+	assert.Contains(t, rec.Body.String(), "created")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestAuthorize(t *testing.T) {
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "api_keys.yaml")
+	data := fmt.Sprintf("- id: reader\n  hash: %s\n  scopes: [receive]\n  keys: [acme]\n", hash)
+
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := auth.NewAuthenticator(config.ServiceConfig{APIKeysPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestServer()
+	h.Group("/receive", Authorize(authenticator, auth.ScopeReceive)).Get("/list", func(handler Handler) {
+		handler.JSON(http.StatusOK, auth.FromContext(handler.Request().Context()).Subject)
+	})
+	h.Group("", Authorize(authenticator, auth.ScopeAdmin)).Get("/suppressions", func(handler Handler) {
+		handler.JSON(http.StatusOK, "suppressions")
+	})
+	h.Group("/webhooks", Authorize(authenticator, auth.ScopeWebhooks)).Get("", func(handler Handler) {
+		handler.JSON(http.StatusOK, "webhooks")
+	})
+
+	tests := []struct {
+		path   string
+		header string
+		value  string
+		code   int
+	}{
+		{"/receive/list?key=acme", "", "", http.StatusUnauthorized},
+		{"/receive/list?key=acme", "Authorization", "Bearer wrong", http.StatusUnauthorized},
+		{"/receive/list?key=acme", "Authorization", "Bearer " + key, http.StatusOK},
+		{"/receive/list?key=acme", HeaderAPIKey, key, http.StatusOK},
+		{"/receive/list?key=other", HeaderAPIKey, key, http.StatusForbidden},
+		{"/receive/list", HeaderAPIKey, key, http.StatusForbidden},
+		{"/receive/list?key=", HeaderAPIKey, key, http.StatusForbidden},
+		{"/suppressions?key=acme", HeaderAPIKey, key, http.StatusForbidden},
+		{"/webhooks?key=acme", HeaderAPIKey, key, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if len(test.header) > 0 {
+			req.Header.Set(test.header, test.value)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, test.code, rec.Code, test.path+" "+test.value)
+	}
+
+	h.Group("/receive", AuthorizeBody(authenticator, auth.ScopeReceive)).Post("/body", func(handler Handler) {
+		body := struct {
+			Key string `json:"key"`
+		}{}
+
+		json.NewDecoder(handler.Request().Body).Decode(&body)
+
+		if h.canAccess(handler, body.Key) {
+			handler.JSON(http.StatusOK, body.Key)
+		}
+	})
+
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		//JSON content type does not skip the key check of routes without JSON body
+		{http.MethodGet, "/receive/list", "", http.StatusForbidden},
+		{http.MethodPost, "/receive/body", `{"key":"acme"}`, http.StatusOK},
+		{http.MethodPost, "/receive/body", `{"key":"other"}`, http.StatusForbidden},
+		{http.MethodPost, "/receive/body", `{}`, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		req.Header.Set(HeaderAPIKey, key)
+		req.Header.Set(HeaderContentType, MIMEApplicationJson)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, test.code, rec.Code, test.method+" "+test.path+" "+test.body)
+	}
+}
+
+func TestGzipSkipsRanges(t *testing.T) {
+	h := newTestServer()
+	h.Use(Gzip(gzip.BestSpeed))
+
+	h.Get("/file", func(handler Handler) {
+		handler.Response().Header().Set("ETag", `"checksum"`)
+		http.ServeContent(handler.Response(), handler.Request(), "", time.Time{}, strings.NewReader("attachment data"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+	req.Header.Set("Range", "bytes=11-")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderContentEncoding))
+	assert.Equal(t, "data", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+	req.Header.Set("If-None-Match", `"checksum"`)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+}
@@ -6,13 +6,12 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
-	"path/filepath"
-	"strings"
 
-	"github.com/RussellLuo/validating/v2"
 	"github.com/rlaskowski/go-email/model"
 )
 
+//Reads multipart form part by part, so files are not buffered on disk or in memory before the handler.
+//The message form has to precede file forms
 type MutlipartController struct {
 	Reader *multipart.Reader
 }
@@ -57,22 +56,45 @@ func (m *MutlipartController) File() (*model.File, error) {
 	return file, nil
 }
 
+//Next file form, io.EOF is returned when there are no more files
+func (m *MutlipartController) NextFile() (*model.File, error) {
+	fileForm, err := m.next("file")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.validateFileForm(fileForm); err != nil {
+		return nil, err
+	}
+
+	file := model.NewFile(fileForm.FileName())
+
+	file.ContentType = fileForm.Header.Get("Content-Type")
+	file.Reader = fileForm
+
+	return file, nil
+}
+
 func (m *MutlipartController) walk(name string) (*multipart.Part, error) {
+	part, err := m.next(name)
+	if err == io.EOF {
+		return nil, fmt.Errorf("Could not find %s form data", name)
+	}
+
+	return part, err
+}
+
+func (m *MutlipartController) next(name string) (*multipart.Part, error) {
 	for {
-		part, err := m.Reader.NextRawPart()
+		part, err := m.Reader.NextPart()
 		if err != nil {
-			if err != io.EOF {
-				return nil, err
-			}
-			break
+			return nil, err
 		}
 
-		if strings.Contains(name, part.FormName()) {
+		if part.FormName() == name {
 			return part, nil
 		}
 	}
-
-	return nil, fmt.Errorf("Could not find %s form data", name)
 }
 
 func (m *MutlipartController) unmarshalMessage(data []byte) (*model.Message, error) {
@@ -83,28 +105,13 @@ func (m *MutlipartController) unmarshalMessage(data []byte) (*model.Message, err
 		return nil, err
 	}
 
-	validateErr := validating.Validate(validating.Schema{
-		validating.F("Sender", &message.Sender):       validating.Nonzero(),
-		validating.F("Recipient", &message.Recipient): validating.Nonzero(),
-		validating.F("Subject", &message.Subject):     validating.Nonzero(),
-		validating.F("Content", &message.Content):     validating.Nonzero(),
-	})
-
-	if validateErr != nil {
-		return nil, validateErr
+	if err := message.Validate(); err != nil {
+		return nil, err
 	}
+
 	return message, nil
 }
 
 func (m *MutlipartController) validateFileForm(fileForm *multipart.Part) error {
-	if !(len(fileForm.FileName()) > 0) {
-		return fmt.Errorf("File name not found")
-	}
-
-	name := strings.TrimSuffix(fileForm.FileName(), filepath.Ext(fileForm.FileName()))
-	if len(name) > 50 {
-		return fmt.Errorf("File name include more than 50 characters")
-	}
-
-	return nil
+	return model.ValidateFileName(fileForm.FileName())
 }
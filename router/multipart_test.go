@@ -0,0 +1,61 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartController(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	mw.WriteField("message", `{"key":"account","to":["gopher@golang.org"],"subject":"Report","text":"See attached"}`)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="report.csv"`)
+	h.Set("Content-Type", "text/csv")
+
+	w, _ := mw.CreatePart(h)
+	w.Write([]byte("a,b\n1,2\n"))
+
+	w, _ = mw.CreateFormFile("file", "notes.txt")
+	w.Write([]byte("notes"))
+
+	mw.Close()
+
+	m := &MutlipartController{Reader: multipart.NewReader(body, mw.Boundary())}
+
+	message, err := m.Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Report", message.Subject)
+
+	file, err := m.NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(file.Reader)
+
+	assert.Equal(t, "report.csv", file.Name)
+	assert.Equal(t, "text/csv", file.ContentType)
+	assert.Equal(t, "a,b\n1,2\n", string(data))
+
+	file, err = m.NextFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "notes.txt", file.Name)
+
+	_, err = m.NextFile()
+	assert.Equal(t, io.EOF, err)
+}
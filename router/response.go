@@ -1,10 +1,15 @@
 package router
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 type Response struct {
-	Status int
-	Writer http.ResponseWriter
+	Status    int
+	Size      int64
+	Committed bool
+	Writer    http.ResponseWriter
 }
 
 func NewResponse(w http.ResponseWriter) *Response {
@@ -15,15 +20,73 @@ func (r *Response) Header() http.Header {
 	return r.Writer.Header()
 }
 
+//Writes status code once, later calls are ignored
 func (r *Response) WriteHeader(code int) {
+	if r.Committed {
+		return
+	}
+
+	r.Status = code
+	r.Committed = true
 	r.Writer.WriteHeader(code)
 }
 
-func (r *Response) Write(b []byte) {
-	if r.Status == 0 {
-		r.Status = http.StatusOK
+func (r *Response) Write(b []byte) (int, error) {
+	if !r.Committed {
+		if r.Status == 0 {
+			r.Status = http.StatusOK
+		}
+		r.WriteHeader(r.Status)
 	}
-	r.WriteHeader(r.Status)
 
-	r.Writer.Write(b)
+	n, err := r.Writer.Write(b)
+	r.Size += int64(n)
+
+	return n, err
+}
+
+func (r *Response) reset(w http.ResponseWriter) {
+	r.Writer = w
+	r.Status = 0
+	r.Size = 0
+	r.Committed = false
+}
+
+//Writer wrapped by the response
+func (r *Response) Unwrap() http.ResponseWriter {
+	return r.Writer
+}
+
+//Removes read and write deadlines set by the server timeouts, so long-lived response is not closed.
+//Wrapped writers are unwrapped until the connection writer is found
+func (r *Response) clearDeadlines() error {
+	var w http.ResponseWriter = r
+
+	for {
+		switch t := w.(type) {
+		case deadliner:
+			if err := t.SetReadDeadline(time.Time{}); err != nil {
+				return err
+			}
+
+			return t.SetWriteDeadline(time.Time{})
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return http.ErrNotSupported
+		}
+	}
+}
+
+//Implemented by the writer of the server connection
+type deadliner interface {
+	SetReadDeadline(deadline time.Time) error
+	SetWriteDeadline(deadline time.Time) error
+}
+
+//Sends buffered data to the client, used by streamed responses
+func (r *Response) Flush() {
+	if f, ok := r.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
 }
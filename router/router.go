@@ -1,24 +1,172 @@
 package router
 
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	paramPrefix    = ':'
+	wildcardPrefix = '*'
+)
+
+//Routes requests by method and path, paths could contain named params (/list/:id)
+//and a trailing wildcard (/files/*path)
 type Router struct {
+	root *node
+}
+
+type node struct {
+	segment  string
+	static   map[string]*node
+	param    *node
+	wildcard *node
 	handlers map[string]HandlerFunc
 }
 
+//Values of named params and wildcards matched in the request path
+type Params map[string]string
+
 func NewRouter() *Router {
 	return &Router{
+		root: newNode(""),
+	}
+}
+
+func newNode(segment string) *node {
+	return &node{
+		segment:  segment,
+		static:   make(map[string]*node),
 		handlers: make(map[string]HandlerFunc),
 	}
 }
 
+//Adds route handler, the first handler added for method and path wins
 func (r *Router) Add(method, path string, handler HandlerFunc) {
-	if _, ok := r.handlers[method+path]; !ok {
-		r.handlers[method+path] = handler
+	n := r.root
+
+	for _, s := range splitPath(path) {
+		switch s[0] {
+		case paramPrefix:
+			if n.param == nil {
+				n.param = newNode(s)
+			}
+			n = n.param
+		case wildcardPrefix:
+			if n.wildcard == nil {
+				n.wildcard = newNode(s)
+			}
+			n = n.wildcard
+		default:
+			c, ok := n.static[s]
+			if !ok {
+				c = newNode(s)
+				n.static[s] = c
+			}
+			n = c
+		}
+
+		//wildcard consumes the rest of the path
+		if n.segment[0] == wildcardPrefix {
+			break
+		}
+	}
+
+	if _, ok := n.handlers[method]; !ok {
+		n.handlers[method] = handler
 	}
 }
 
+//Handler of the route, nil when path or method does not match
 func (r *Router) FindHandle(method, path string) HandlerFunc {
-	if hf, ok := r.handlers[method+path]; ok {
-		return hf
+	handler, _, _ := r.Find(method, path)
+	return handler
+}
+
+//Finds handler with path params, when only method does not match the allowed methods are returned
+func (r *Router) Find(method, path string) (HandlerFunc, Params, []string) {
+	params := make(Params)
+
+	n := r.root.match(splitPath(path), params)
+	if n == nil {
+		return nil, nil, nil
 	}
+
+	if h, ok := n.handlers[method]; ok {
+		return h, params, nil
+	}
+
+	if h, ok := n.handlers[http.MethodGet]; ok && method == http.MethodHead {
+		return h, params, nil
+	}
+
+	return nil, params, n.allowed()
+}
+
+//Depth first match preferring static segments over params and params over wildcards
+func (n *node) match(segments []string, params Params) *node {
+	if len(segments) == 0 {
+		if len(n.handlers) > 0 {
+			return n
+		}
+
+		//wildcard matches empty rest of the path too
+		if n.wildcard != nil && len(n.wildcard.handlers) > 0 {
+			params[n.wildcard.segment[1:]] = ""
+			return n.wildcard
+		}
+
+		return nil
+	}
+
+	if c, ok := n.static[segments[0]]; ok {
+		if m := c.match(segments[1:], params); m != nil {
+			return m
+		}
+	}
+
+	if n.param != nil {
+		if m := n.param.match(segments[1:], params); m != nil {
+			params[n.param.segment[1:]] = segments[0]
+			return m
+		}
+	}
+
+	if n.wildcard != nil && len(n.wildcard.handlers) > 0 {
+		params[n.wildcard.segment[1:]] = strings.Join(segments, "/")
+		return n.wildcard
+	}
+
 	return nil
 }
+
+func (n *node) allowed() []string {
+	methods := make([]string, 0, len(n.handlers)+1)
+
+	for m := range n.handlers {
+		methods = append(methods, m)
+	}
+
+	if _, ok := n.handlers[http.MethodGet]; ok {
+		if _, ok := n.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
+
+func splitPath(path string) []string {
+	segments := make([]string, 0)
+
+	for _, s := range strings.Split(path, "/") {
+		if len(s) > 0 {
+			segments = append(segments, s)
+		}
+	}
+
+	return segments
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func named(name string) HandlerFunc {
+	return func(h Handler) {
+		h.JSON(http.StatusOK, name)
+	}
+}
+
+func TestRouterFind(t *testing.T) {
+	r := NewRouter()
+	r.Add(http.MethodGet, "/receive/list", named("list"))
+	r.Add(http.MethodGet, "/receive/list/:id", named("id"))
+	r.Add(http.MethodGet, "/receive/list/latest", named("latest"))
+	r.Add(http.MethodDelete, "/receive/list/:id", named("delete"))
+	r.Add(http.MethodGet, "/files/*path", named("files"))
+
+	tests := []struct {
+		method string
+		path   string
+		params Params
+	}{
+		{http.MethodGet, "/receive/list", Params{}},
+		{http.MethodGet, "/receive/list/", Params{}},
+		{http.MethodGet, "/receive/list/42", Params{"id": "42"}},
+		{http.MethodGet, "/receive/list/latest", Params{}},
+		{http.MethodHead, "/receive/list/42", Params{"id": "42"}},
+		{http.MethodGet, "/files/2021/report.pdf", Params{"path": "2021/report.pdf"}},
+		{http.MethodGet, "/files", Params{"path": ""}},
+	}
+
+	for _, test := range tests {
+		h, params, _ := r.Find(test.method, test.path)
+		if assert.NotNil(t, h, test.path) {
+			assert.Equal(t, test.params, params, test.path)
+		}
+	}
+
+	h, _, allowed := r.Find(http.MethodPost, "/receive/list/42")
+	assert.Nil(t, h)
+	assert.Equal(t, []string{http.MethodDelete, http.MethodGet, http.MethodHead}, allowed)
+
+	h, _, allowed = r.Find(http.MethodGet, "/receive/unknown")
+	assert.Nil(t, h)
+	assert.Empty(t, allowed)
+}
+
+func TestServeNotFoundAndNotAllowed(t *testing.T) {
+	h := newTestServer()
+
+	h.Get("/receive/list/:id", func(handler Handler) {
+		handler.JSON(http.StatusOK, handler.PathParam("id"))
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/receive/list/7", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "\"7\"\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/receive/list/7", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rlaskowski/go-email/model"
+	"github.com/rlaskowski/go-email/queue"
+)
+
+const (
+	HeaderLastEventID   = "Last-Event-ID"
+	MIMETextEventStream = "text/event-stream"
+
+	//Delay in milliseconds the client waits before it reconnects
+	streamRetry = 1000
+)
+
+//Server-Sent Events stream of received messages, event ID is the sequence of the message index
+type messageStream struct {
+	response  *Response
+	filter    *model.MessageFilter
+	heartbeat time.Duration
+	last      int64
+}
+
+//Writes messages missed since the last event and then messages published to the subscription,
+//stream ends when the request is done or the subscription is closed
+func (s *messageStream) serve(req *http.Request, sub *queue.Subscription, missed []*model.ReceivedMessage) {
+	header := s.response.Header()
+	header.Set(HeaderContentType, MIMETextEventStream)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+
+	if err := s.response.clearDeadlines(); err != nil {
+		log.Printf("Could not clear deadlines of the stream due to: %s", err)
+	}
+
+	s.response.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(s.response, "retry: %d\n\n", streamRetry); err != nil {
+		return
+	}
+
+	for _, m := range missed {
+		if err := s.write(m); err != nil {
+			return
+		}
+	}
+
+	s.response.Flush()
+
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(s.response, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			if event.Type != model.EventMessageReceived {
+				continue
+			}
+
+			if err := s.write(event.Message); err != nil {
+				return
+			}
+		}
+
+		s.response.Flush()
+	}
+}
+
+func (s *messageStream) write(m *model.ReceivedMessage) error {
+	//message replayed from the index could be published again
+	if m.Sequence <= s.last || !s.filter.Match(m) {
+		return nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.response, "id: %d\nevent: message\ndata: %s\n\n", m.Sequence, data); err != nil {
+		return err
+	}
+
+	s.last = m.Sequence
+
+	return nil
+}
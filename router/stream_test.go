@@ -0,0 +1,108 @@
+package router
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/model"
+	"github.com/rlaskowski/go-email/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageStream(t *testing.T) {
+	hub := queue.NewEventHub()
+	sub, err := hub.Subscribe("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+
+	stream := &messageStream{
+		response:  NewResponse(rec),
+		filter:    &model.MessageFilter{Subject: "report"},
+		heartbeat: time.Hour,
+		last:      1,
+	}
+
+	missed := []*model.ReceivedMessage{
+		{ID: "id2", Key: "account", Subject: "Report 2", Sequence: 2},
+		{ID: "id3", Key: "account", Subject: "Invoice", Sequence: 3},
+	}
+
+	//message already sent from the index and message not matching the filter are skipped
+	for _, m := range []*model.ReceivedMessage{
+		missed[0],
+		{ID: "id4", Key: "account", Subject: "Invoice", Sequence: 4},
+		{ID: "id5", Key: "account", Subject: "Report 5", Sequence: 5},
+	} {
+		hub.Publish(&model.Event{Type: model.EventMessageReceived, Key: "account", Message: m})
+	}
+
+	sub.Close()
+
+	stream.serve(httptest.NewRequest(http.MethodGet, "/messages/stream", nil), sub, missed)
+
+	assert.Equal(t, MIMETextEventStream, rec.Header().Get(HeaderContentType))
+	body := rec.Body.String()
+
+	assert.True(t, strings.HasPrefix(body, "retry: 1000\n\n"))
+	assert.Equal(t, 2, strings.Count(body, "event: message\n"))
+	assert.Contains(t, body, "id: 2\nevent: message\ndata: {\"id\":\"id2\"")
+	assert.Contains(t, body, "id: 5\nevent: message\ndata: {\"id\":\"id5\"")
+}
+
+func TestMessageStreamRequiresKey(t *testing.T) {
+	h := newTestServer()
+	h.Get("/messages/stream", h.MessageStream)
+
+	for _, path := range []string{"/messages/stream", "/messages/stream?key="} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+	}
+}
+
+func TestStreamWithoutTimeouts(t *testing.T) {
+	h := newTestServer()
+	h.Use(TimeoutWithConfig(TimeoutConfig{Timeout: 10 * time.Millisecond, Skipper: h.streamed}))
+	h.Use(Gzip(-1))
+
+	h.Group("/messages").Stream("/stream", func(handler Handler) {
+		res := handler.Response()
+		if err := res.clearDeadlines(); err != nil {
+			t.Error(err)
+		}
+
+		res.WriteHeader(http.StatusOK)
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+			res.Write([]byte("event\n"))
+			res.Flush()
+		}
+	})
+
+	server := httptest.NewUnstartedServer(h)
+	server.Config.ReadTimeout = 50 * time.Millisecond
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/messages/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "event\nevent\nevent\n", string(body))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/rlaskowski/go-email/auth"
 	"github.com/rlaskowski/go-email/config"
 	"github.com/rlaskowski/go-email/grpc"
 	"github.com/rlaskowski/go-email/queue"
@@ -20,6 +21,7 @@ type Service struct {
 	emailService     *grpc.EmailService
 	emailRestService *rest.EmailService
 	serviceConfig    config.ServiceConfig
+	authenticator    *auth.Authenticator
 }
 
 func NewService() *Service {
@@ -37,6 +39,13 @@ func newService(serviceConfig config.ServiceConfig) *Service {
 		serviceConfig: serviceConfig,
 	}
 
+	authenticator, err := auth.NewAuthenticator(serviceConfig)
+	if err != nil {
+		log.Fatalf("Could not configure authentication: %s", err)
+	}
+
+	s.authenticator = authenticator
+
 	s.emailService = grpc.NewEmailService(s.queueBox)
 	s.emailRestService = rest.NewEmailService(s.queueBox)
 	s.http = router.NewHttpServer(s)
@@ -101,3 +110,7 @@ func (s *Service) QueueBox() *queue.QueueBox {
 func (s *Service) ServiceConfig() config.ServiceConfig {
 	return s.serviceConfig
 }
+
+func (s *Service) Authenticator() *auth.Authenticator {
+	return s.authenticator
+}
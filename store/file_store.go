@@ -148,6 +148,23 @@ func (f *FileStore) store(path string, reader io.Reader) error {
 	return nil
 }
 
+//Opens stored file for reading, caller has to close it
+func (f *FileStore) Open(id string) (*os.File, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("File ID %s is not valid", id)
+	}
+
+	return os.Open(filepath.Join(f.ControllDir(id), id))
+}
+
+func (f *FileStore) RemoveByUUID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("File ID %s is not valid", id)
+	}
+
+	return f.Remove(filepath.Join(f.ControllDir(id), id))
+}
+
 func (f *FileStore) Remove(file string) error {
 	err := os.Remove(file)
 	if err != nil {
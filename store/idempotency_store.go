@@ -0,0 +1,174 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
+)
+
+//Maximum length of the idempotency key
+const MaxIdempotencyKeySize = 255
+
+var (
+	ErrIdempotencyKeySize    = fmt.Errorf("Idempotency key is longer than %d characters", MaxIdempotencyKeySize)
+	ErrIdempotencyKeyReused  = errors.New("Idempotency key was already used with a different request")
+	ErrIdempotencyInProgress = errors.New("Request with the same idempotency key is still in progress")
+)
+
+//Idempotency keys of send requests kept in JSON file for the window duration,
+//only in memory when path is empty
+type IdempotencyStore struct {
+	path    string
+	window  time.Duration
+	mutex   sync.Mutex
+	records map[string]*model.IdempotencyRecord
+}
+
+func NewIdempotencyStore(path string, window time.Duration) (*IdempotencyStore, error) {
+	s := &IdempotencyStore{
+		path:    path,
+		window:  window,
+		records: make(map[string]*model.IdempotencyRecord),
+	}
+
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.IdempotencyRecord, 0)
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	for _, r := range list {
+		s.records[s.id(r.Key, r.IdempotencyKey)] = r
+	}
+
+	s.expire(time.Now())
+
+	return s, nil
+}
+
+//Reserves the key for the request, record of the completed request is returned when the key was used before.
+//Reserved key has to be completed or released
+func (s *IdempotencyStore) Begin(key, idempotencyKey, requestHash string) (*model.IdempotencyRecord, error) {
+	if len(idempotencyKey) > MaxIdempotencyKeySize {
+		return nil, ErrIdempotencyKeySize
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire(time.Now())
+
+	id := s.id(key, idempotencyKey)
+
+	if r, ok := s.records[id]; ok {
+		if r.RequestHash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+
+		if !r.Completed() {
+			return nil, ErrIdempotencyInProgress
+		}
+
+		return r, nil
+	}
+
+	s.records[id] = &model.IdempotencyRecord{
+		Key:            key,
+		IdempotencyKey: idempotencyKey,
+		RequestHash:    requestHash,
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	return nil, nil
+}
+
+//Stores result of the request, repeated requests get the same message ID until the window passes
+func (s *IdempotencyStore) Complete(key, idempotencyKey, messageID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.records[s.id(key, idempotencyKey)]
+	if !ok {
+		return errors.New("Idempotency key was not reserved")
+	}
+
+	r.MessageID = messageID
+
+	return s.save()
+}
+
+//Releases key of the failed request, so it could be retried
+func (s *IdempotencyStore) Release(key, idempotencyKey string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := s.id(key, idempotencyKey)
+
+	if r, ok := s.records[id]; ok && !r.Completed() {
+		delete(s.records, id)
+	}
+}
+
+func (s *IdempotencyStore) expire(now time.Time) {
+	if s.window <= 0 {
+		return
+	}
+
+	for id, r := range s.records {
+		if r.Completed() && now.Sub(r.CreatedAt) > s.window {
+			delete(s.records, id)
+		}
+	}
+}
+
+func (s *IdempotencyStore) id(key, idempotencyKey string) string {
+	return key + "\n" + idempotencyKey
+}
+
+//Writes completed requests to temporary file replacing the store file at once
+func (s *IdempotencyStore) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	list := make([]*model.IdempotencyRecord, 0, len(s.records))
+	for _, r := range s.records {
+		if r.Completed() {
+			list = append(list, r)
+		}
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+
+	if err := ioutil.WriteFile(tmp, data, config.FilePermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
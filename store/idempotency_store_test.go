@@ -0,0 +1,80 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "idempotency.json")
+
+	s, err := NewIdempotencyStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Begin("account", "retry-1", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	_, err = s.Begin("account", "retry-1", "hash")
+	assert.Equal(t, ErrIdempotencyInProgress, err)
+
+	assert.NoError(t, s.Complete("account", "retry-1", "id@golang.org"))
+
+	//reopened store reads completed requests
+	s, err = NewIdempotencyStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = s.Begin("account", "retry-1", "hash")
+	if assert.NoError(t, err) && assert.NotNil(t, r) {
+		assert.Equal(t, "id@golang.org", r.MessageID)
+	}
+
+	_, err = s.Begin("account", "retry-1", "other hash")
+	assert.Equal(t, ErrIdempotencyKeyReused, err)
+
+	//the same key of other account is independent
+	r, err = s.Begin("other", "retry-1", "other hash")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	s.Release("other", "retry-1")
+
+	r, err = s.Begin("other", "retry-1", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	_, err = s.Begin("account", strings.Repeat("k", MaxIdempotencyKeySize+1), "hash")
+	assert.Equal(t, ErrIdempotencyKeySize, err)
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	s, err := NewIdempotencyStore("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Begin("account", "retry-1", "hash")
+	s.Complete("account", "retry-1", "id@golang.org")
+
+	s.records[s.id("account", "retry-1")].CreatedAt = time.Now().Add(-2 * time.Hour)
+
+	r, err := s.Begin("account", "retry-1", "other hash")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+}
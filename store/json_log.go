@@ -0,0 +1,146 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rlaskowski/go-email/config"
+)
+
+//Number of records the log could have before it is compacted
+const logCompactRecords = 1000
+
+//Append-only file of JSON records, one record per line. Records are replayed when
+//the store is opened, so every change costs one write instead of rewriting the store
+type jsonLog struct {
+	path    string
+	records int
+}
+
+func newJSONLog(path string) *jsonLog {
+	return &jsonLog{
+		path: path,
+	}
+}
+
+//Decodes every record of the log, last record truncated by a crash is removed,
+//so records appended later start on the new line
+func (l *jsonLog) read(decode func(data []byte) error) error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var offset int64
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) == 0 {
+				return nil
+			}
+
+			log.Printf("Removed truncated record at the end of %s", l.path)
+
+			return os.Truncate(l.path, offset)
+		}
+
+		offset += int64(len(line))
+
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		if err := decode(line); err != nil {
+			return err
+		}
+
+		l.records++
+	}
+}
+
+//Appends records at the end of the log
+func (l *jsonLog) append(records ...interface{}) error {
+	data, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, config.FilePermissions)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	l.records += len(records)
+
+	return nil
+}
+
+//Checks if most of the records are outdated by the later ones
+func (l *jsonLog) outdated(live int) bool {
+	return l.records > logCompactRecords && l.records > 2*live
+}
+
+//Replaces the log with the current records at once
+func (l *jsonLog) compact(records []interface{}) error {
+	data, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(l.path), "."+filepath.Base(l.path)+".tmp")
+
+	if err := ioutil.WriteFile(tmp, data, config.FilePermissions); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+
+	l.records = len(records)
+
+	return nil
+}
+
+func encodeRecords(records []interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
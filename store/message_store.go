@@ -0,0 +1,445 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+
+	messageLogFile     = "index.jsonl"
+	messageIndexFile   = "index.json"
+	messageDeletedFile = "deleted.json"
+	messageFileExt     = ".eml"
+)
+
+var (
+	ErrMessageNotFound    = errors.New("Message was not found")
+	ErrInvalidCursor      = errors.New("Cursor is not valid")
+	ErrAttachmentNotFound = errors.New("Attachment was not found")
+)
+
+//Index of received messages with raw messages kept in the directory,
+//only in memory when path is empty. Added and removed messages are appended
+//to the index log. IDs of removed messages are kept, so messages left
+//on the server are not received again
+type MessageStore struct {
+	path     string
+	log      *jsonLog
+	mutex    sync.RWMutex
+	messages map[string]*model.ReceivedMessage
+	raw      map[string][]byte
+	deleted  map[string]time.Time
+	sequence int64
+}
+
+//Record of the index log, message is added or removed with the time of removal
+type messageRecord struct {
+	Message   *model.ReceivedMessage `json:"message,omitempty"`
+	Removed   string                 `json:"removed,omitempty"`
+	RemovedAt time.Time              `json:"removedAt,omitempty"`
+}
+
+func NewMessageStore(path string) (*MessageStore, error) {
+	s := &MessageStore{
+		path:     path,
+		messages: make(map[string]*model.ReceivedMessage),
+		raw:      make(map[string][]byte),
+		deleted:  make(map[string]time.Time),
+	}
+
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(path, config.FilePermissions); err != nil {
+		return nil, err
+	}
+
+	s.log = newJSONLog(filepath.Join(path, messageLogFile))
+
+	//index written before the index log
+	list := make([]*model.ReceivedMessage, 0)
+
+	if err := readJSON(filepath.Join(path, messageIndexFile), &list); err != nil {
+		return nil, err
+	}
+
+	if err := readJSON(filepath.Join(path, messageDeletedFile), &s.deleted); err != nil {
+		return nil, err
+	}
+
+	for _, m := range list {
+		s.messages[m.ID] = m
+	}
+
+	err := s.log.read(func(data []byte) error {
+		r := &messageRecord{}
+
+		if err := json.Unmarshal(data, r); err != nil {
+			return err
+		}
+
+		if r.Message != nil {
+			s.messages[r.Message.ID] = r.Message
+		} else {
+			delete(s.messages, r.Removed)
+			s.deleted[r.Removed] = r.RemovedAt
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range s.messages {
+		if m.Sequence > s.sequence {
+			s.sequence = m.Sequence
+		}
+	}
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *MessageStore) Exists(id string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.messages[id]
+
+	return ok
+}
+
+//Reports whether message with the ID was removed
+func (s *MessageStore) Deleted(id string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.deleted[id]
+
+	return ok
+}
+
+//Adds message with the raw data, message already stored or removed with the same ID is skipped
+func (s *MessageStore) Add(message *model.ReceivedMessage, raw []byte) error {
+	if len(message.ID) == 0 || len(message.Key) == 0 {
+		return errors.New("Message ID and key are required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.messages[message.ID]; ok {
+		return nil
+	}
+
+	if _, ok := s.deleted[message.ID]; ok {
+		return nil
+	}
+
+	if err := s.writeRaw(message.ID, raw); err != nil {
+		return err
+	}
+
+	s.sequence++
+
+	message.Sequence = s.sequence
+	message.Size = len(raw)
+
+	if message.ReceivedAt.IsZero() {
+		message.ReceivedAt = time.Now().UTC()
+	}
+
+	s.messages[message.ID] = message
+
+	if err := s.write(&messageRecord{Message: message}); err != nil {
+		delete(s.messages, message.ID)
+		s.removeRaw(message.ID)
+		return err
+	}
+
+	return nil
+}
+
+//Message of the account
+func (s *MessageStore) Find(key, id string) (*model.ReceivedMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	m, ok := s.messages[id]
+	if !ok || m.Key != key {
+		return nil, ErrMessageNotFound
+	}
+
+	return m, nil
+}
+
+//Attachment metadata of the message of the account
+func (s *MessageStore) Attachment(key, id, attachmentId string) (*model.AttachmentInfo, error) {
+	m, err := s.Find(key, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		if a.ID == attachmentId {
+			return a, nil
+		}
+	}
+
+	return nil, ErrAttachmentNotFound
+}
+
+//Raw data of the message of the account
+func (s *MessageStore) Raw(key, id string) ([]byte, error) {
+	if _, err := s.Find(key, id); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if len(s.path) == 0 {
+		return s.raw[id], nil
+	}
+
+	return ioutil.ReadFile(s.rawPath(id))
+}
+
+//Messages of the account matching the filter, the newest first
+func (s *MessageStore) List(key string, filter *model.MessageFilter) (*model.MessagePage, error) {
+	after, err := decodeCursor(filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.ReceivedMessage, 0)
+
+	for _, m := range s.messages {
+		if m.Key != key || (after > 0 && m.Sequence >= after) || !filter.Match(m) {
+			continue
+		}
+
+		list = append(list, m)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Sequence > list[j].Sequence
+	})
+
+	page := &model.MessagePage{
+		Messages: list,
+	}
+
+	if len(list) > limit {
+		page.Messages = list[:limit]
+		page.NextCursor = encodeCursor(page.Messages[limit-1].Sequence)
+	}
+
+	return page, nil
+}
+
+//Messages of every account, the oldest first
+func (s *MessageStore) All() []*model.ReceivedMessage {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.ReceivedMessage, 0, len(s.messages))
+
+	for _, m := range s.messages {
+		list = append(list, m)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Sequence < list[j].Sequence
+	})
+
+	return list
+}
+
+//Messages of the account added after the sequence, the oldest first
+func (s *MessageStore) Since(key string, sequence int64) []*model.ReceivedMessage {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.ReceivedMessage, 0)
+
+	for _, m := range s.messages {
+		if m.Key == key && m.Sequence > sequence {
+			list = append(list, m)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Sequence < list[j].Sequence
+	})
+
+	return list
+}
+
+func (s *MessageStore) Remove(key, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.messages[id]
+	if !ok || m.Key != key {
+		return ErrMessageNotFound
+	}
+
+	removedAt := time.Now().UTC()
+
+	delete(s.messages, id)
+	s.deleted[id] = removedAt
+
+	if err := s.write(&messageRecord{Removed: id, RemovedAt: removedAt}); err != nil {
+		s.messages[id] = m
+		delete(s.deleted, id)
+		return err
+	}
+
+	s.removeRaw(id)
+
+	return nil
+}
+
+//Cursor points to the sequence of the last message on the page
+func encodeCursor(sequence int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(sequence, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	if len(cursor) == 0 {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	sequence, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || sequence <= 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return sequence, nil
+}
+
+func (s *MessageStore) rawPath(id string) string {
+	return filepath.Join(s.path, id+messageFileExt)
+}
+
+func (s *MessageStore) writeRaw(id string, raw []byte) error {
+	if len(s.path) == 0 {
+		s.raw[id] = raw
+		return nil
+	}
+
+	return ioutil.WriteFile(s.rawPath(id), raw, config.FilePermissions)
+}
+
+func (s *MessageStore) removeRaw(id string) {
+	if len(s.path) == 0 {
+		delete(s.raw, id)
+		return
+	}
+
+	os.Remove(s.rawPath(id))
+}
+
+//Appends record to the index log. Messages are not changed and removed IDs are kept,
+//so the log has at most two records per message and it is not compacted
+func (s *MessageStore) write(record *messageRecord) error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	return s.log.append(record)
+}
+
+//Rewrites the log with the current messages and removed IDs
+func (s *MessageStore) compact() error {
+	records := make([]interface{}, 0, len(s.messages)+len(s.deleted))
+
+	for _, m := range s.messages {
+		records = append(records, &messageRecord{Message: m})
+	}
+
+	for id, removedAt := range s.deleted {
+		records = append(records, &messageRecord{Removed: id, RemovedAt: removedAt})
+	}
+
+	return s.log.compact(records)
+}
+
+//Moves index and removed IDs written before the index log to the log
+func (s *MessageStore) migrate() error {
+	index := filepath.Join(s.path, messageIndexFile)
+	deleted := filepath.Join(s.path, messageDeletedFile)
+
+	if !fileExists(index) && !fileExists(deleted) {
+		return nil
+	}
+
+	if err := s.compact(); err != nil {
+		return err
+	}
+
+	for _, f := range []string{index, deleted} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+//Reads JSON file to v, missing file is skipped
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, s.Add(&model.ReceivedMessage{
+			ID:             fmt.Sprintf("id%d", i),
+			Key:            "account",
+			Sender:         fmt.Sprintf("sender%d@golang.org", i%2),
+			To:             []string{"Gopher <gopher@golang.org>"},
+			Subject:        fmt.Sprintf("Report %d", i),
+			Date:           date.Add(time.Duration(i) * time.Hour),
+			HasAttachments: i == 3,
+		}, []byte(fmt.Sprintf("Subject: Report %d\r\n\r\nBody", i))))
+	}
+
+	assert.NoError(t, s.Add(&model.ReceivedMessage{ID: "other", Key: "other"}, []byte("Subject: Other\r\n\r\n")))
+
+	//message with the same ID is kept
+	assert.NoError(t, s.Add(&model.ReceivedMessage{ID: "id1", Key: "account", Subject: "Duplicate"}, []byte("Subject: Duplicate\r\n\r\n")))
+
+	//reopened store reads the index
+	s, err = NewMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := s.List("account", &model.MessageFilter{Limit: 2})
+	if assert.NoError(t, err) && assert.Len(t, page.Messages, 2) {
+		assert.Equal(t, "id5", page.Messages[0].ID)
+		assert.Equal(t, "id4", page.Messages[1].ID)
+		assert.NotEmpty(t, page.NextCursor)
+	}
+
+	page, err = s.List("account", &model.MessageFilter{Limit: 2, Cursor: page.NextCursor})
+	if assert.NoError(t, err) && assert.Len(t, page.Messages, 2) {
+		assert.Equal(t, "id3", page.Messages[0].ID)
+	}
+
+	page, err = s.List("account", &model.MessageFilter{Limit: 2, Cursor: page.NextCursor})
+	if assert.NoError(t, err) && assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, "Report 1", page.Messages[0].Subject)
+		assert.Empty(t, page.NextCursor)
+	}
+
+	page, _ = s.List("account", &model.MessageFilter{Sender: "SENDER0", Subject: "report"})
+	assert.Len(t, page.Messages, 2)
+
+	page, _ = s.List("account", &model.MessageFilter{Recipient: "gopher", Since: date.Add(2 * time.Hour), Until: date.Add(4 * time.Hour)})
+	assert.Len(t, page.Messages, 2)
+
+	hasAttachment := true
+	page, _ = s.List("account", &model.MessageFilter{HasAttachment: &hasAttachment})
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, "id3", page.Messages[0].ID)
+	}
+
+	_, err = s.List("account", &model.MessageFilter{Cursor: "not a cursor"})
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	raw, err := s.Raw("account", "id2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Subject: Report 2\r\n\r\nBody", string(raw))
+	}
+
+	_, err = s.Raw("other", "id2")
+	assert.Equal(t, ErrMessageNotFound, err)
+
+	since := s.Since("account", 3)
+	if assert.Len(t, since, 2) {
+		assert.Equal(t, "id4", since[0].ID)
+		assert.Equal(t, "id5", since[1].ID)
+	}
+
+	assert.NoError(t, s.Remove("account", "id2"))
+	assert.Equal(t, ErrMessageNotFound, s.Remove("account", "id2"))
+	assert.False(t, s.Exists("id2"))
+	assert.True(t, s.Deleted("id2"))
+
+	//removed message is not added again
+	assert.NoError(t, s.Add(&model.ReceivedMessage{ID: "id2", Key: "account"}, []byte("Subject: Report 2\r\n\r\nBody")))
+	assert.False(t, s.Exists("id2"))
+
+	page, _ = s.List("account", &model.MessageFilter{})
+	assert.Len(t, page.Messages, 4)
+
+	//reopened store reads removed IDs
+	s, err = NewMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, s.Deleted("id2"))
+}
+
+func TestMessageIndexLog(t *testing.T) {
+	dir := t.TempDir()
+
+	//index and removed IDs written before the index log
+	index := `[{"id":"old","key":"account","subject":"Report","sequence":7}]`
+	deleted := `{"removed":"2021-06-01T08:00:00Z"}`
+
+	if err := ioutil.WriteFile(filepath.Join(dir, messageIndexFile), []byte(index), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, messageDeletedFile), []byte(deleted), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, s.Exists("old"))
+	assert.True(t, s.Deleted("removed"))
+	assert.NoFileExists(t, filepath.Join(dir, messageIndexFile))
+	assert.NoFileExists(t, filepath.Join(dir, messageDeletedFile))
+
+	assert.NoError(t, s.Add(&model.ReceivedMessage{ID: "new", Key: "account"}, []byte("Subject: New\r\n\r\n")))
+	assert.NoError(t, s.Remove("account", "old"))
+
+	//record truncated by a crash is skipped
+	f, err := os.OpenFile(filepath.Join(dir, messageLogFile), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteString(`{"message":{"id":"trunc`)
+	f.Close()
+
+	s, err = NewMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, s.Exists("old"))
+	assert.True(t, s.Deleted("old"))
+	assert.True(t, s.Deleted("removed"))
+
+	m, err := s.Find("account", "new")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(8), m.Sequence)
+	}
+
+	//record appended after the truncated one is read
+	assert.NoError(t, s.Add(&model.ReceivedMessage{ID: "next", Key: "account"}, []byte("Subject: Next\r\n\r\n")))
+
+	s, err = NewMessageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, s.Exists("next"))
+	assert.Equal(t, 5, s.log.records)
+}
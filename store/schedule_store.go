@@ -0,0 +1,278 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
+)
+
+var (
+	ErrScheduledNotFound = errors.New("Scheduled message was not found")
+	ErrScheduledReleased = errors.New("Scheduled message was already released to sending")
+)
+
+//Messages scheduled for future delivery kept in JSON file,
+//only in memory when path is empty. Messages are returned as copies,
+//so they could be released or retried while they are read
+type ScheduleStore struct {
+	path     string
+	mutex    sync.RWMutex
+	messages map[string]*model.ScheduledMessage
+}
+
+func NewScheduleStore(path string) (*ScheduleStore, error) {
+	s := &ScheduleStore{
+		path:     path,
+		messages: make(map[string]*model.ScheduledMessage),
+	}
+
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.ScheduledMessage, 0)
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	for _, m := range list {
+		s.messages[m.ID] = m
+	}
+
+	return s, nil
+}
+
+func (s *ScheduleStore) Add(message *model.ScheduledMessage) error {
+	if len(message.ID) == 0 || len(message.Key) == 0 {
+		return errors.New("Scheduled message ID and key are required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.messages[message.ID]; ok {
+		return errors.New("Message with the same ID is already scheduled")
+	}
+
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now().UTC()
+	}
+
+	s.messages[message.ID] = copyScheduled(message)
+
+	if err := s.save(); err != nil {
+		delete(s.messages, message.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (s *ScheduleStore) Get(id string) (*model.ScheduledMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	m, ok := s.messages[id]
+	if !ok {
+		return nil, ErrScheduledNotFound
+	}
+
+	return copyScheduled(m), nil
+}
+
+//Scheduled message of the account
+func (s *ScheduleStore) Find(key, id string) (*model.ScheduledMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	m, ok := s.messages[id]
+	if !ok || m.Key != key {
+		return nil, ErrScheduledNotFound
+	}
+
+	return copyScheduled(m), nil
+}
+
+//Scheduled messages of the account, the earliest first
+func (s *ScheduleStore) List(key string) []*model.ScheduledMessage {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.ScheduledMessage, 0)
+
+	for _, m := range s.messages {
+		if m.Key == key {
+			list = append(list, copyScheduled(m))
+		}
+	}
+
+	sortScheduled(list)
+
+	return list
+}
+
+//Scheduled messages of every account, the earliest first
+func (s *ScheduleStore) All() []*model.ScheduledMessage {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.ScheduledMessage, 0, len(s.messages))
+
+	for _, m := range s.messages {
+		list = append(list, copyScheduled(m))
+	}
+
+	sortScheduled(list)
+
+	return list
+}
+
+//Copy of the scheduled message, released time and delivered recipients
+//are replaced and never changed in place
+func copyScheduled(m *model.ScheduledMessage) *model.ScheduledMessage {
+	c := *m
+	return &c
+}
+
+func sortScheduled(list []*model.ScheduledMessage) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].SendAt.Equal(list[j].SendAt) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].SendAt.Before(list[j].SendAt)
+	})
+}
+
+//Changes send time of the message which was not released yet
+func (s *ScheduleStore) Reschedule(key, id string, sendAt time.Time) (*model.ScheduledMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.messages[id]
+	if !ok || m.Key != key {
+		return nil, ErrScheduledNotFound
+	}
+
+	if m.ReleasedAt != nil {
+		return nil, ErrScheduledReleased
+	}
+
+	previous := m.SendAt
+	m.SendAt = sendAt
+
+	if err := s.save(); err != nil {
+		m.SendAt = previous
+		return nil, err
+	}
+
+	return copyScheduled(m), nil
+}
+
+//Marks the message as moved to the sending queue
+func (s *ScheduleStore) Release(id string, releasedAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.messages[id]
+	if !ok {
+		return ErrScheduledNotFound
+	}
+
+	previous := m.ReleasedAt
+	m.ReleasedAt = &releasedAt
+
+	if err := s.save(); err != nil {
+		m.ReleasedAt = previous
+		return err
+	}
+
+	return nil
+}
+
+//Returns released message which could not be sent to waiting for the next attempt at sendAt,
+//recipients delivered by the attempt are added to the delivered ones
+func (s *ScheduleStore) Retry(id string, sendAt time.Time, delivered []string) (*model.ScheduledMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.messages[id]
+	if !ok {
+		return nil, ErrScheduledNotFound
+	}
+
+	previous := *m
+
+	m.SendAt = sendAt
+	m.ReleasedAt = nil
+	m.Attempts++
+	m.Delivered = append(append([]string{}, m.Delivered...), delivered...)
+
+	if err := s.save(); err != nil {
+		*m = previous
+		return nil, err
+	}
+
+	return copyScheduled(m), nil
+}
+
+func (s *ScheduleStore) Remove(key, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.messages[id]
+	if !ok || m.Key != key {
+		return ErrScheduledNotFound
+	}
+
+	delete(s.messages, id)
+
+	if err := s.save(); err != nil {
+		s.messages[id] = m
+		return err
+	}
+
+	return nil
+}
+
+//Writes all scheduled messages to temporary file replacing the store file at once
+func (s *ScheduleStore) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	list := make([]*model.ScheduledMessage, 0, len(s.messages))
+	for _, m := range s.messages {
+		list = append(list, m)
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+
+	if err := ioutil.WriteFile(tmp, data, config.FilePermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
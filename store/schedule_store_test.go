@@ -0,0 +1,81 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheduled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "scheduled.json")
+
+	s, err := NewScheduleStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendAt := time.Date(2021, 6, 1, 6, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, s.Add(&model.ScheduledMessage{
+		ID:      "reminder@golang.org",
+		Key:     "account",
+		SendAt:  sendAt,
+		Message: &model.Message{Subject: "Reminder", Attachments: []*model.Attachment{{Name: "agenda.txt", Data: []byte("agenda")}}},
+	}))
+	assert.NoError(t, s.Add(&model.ScheduledMessage{ID: "earlier@golang.org", Key: "account", SendAt: sendAt.Add(-time.Hour), Message: &model.Message{}}))
+	assert.Error(t, s.Add(&model.ScheduledMessage{ID: "reminder@golang.org", Key: "account", Message: &model.Message{}}))
+
+	//reopened store reads the file
+	s, err = NewScheduleStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := s.List("account")
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, "earlier@golang.org", list[0].ID)
+		assert.Equal(t, []byte("agenda"), list[1].Message.Attachments[0].Data)
+	}
+
+	_, err = s.Find("other", "reminder@golang.org")
+	assert.Equal(t, ErrScheduledNotFound, err)
+
+	m, err := s.Reschedule("account", "reminder@golang.org", sendAt.Add(-2*time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "reminder@golang.org", s.List("account")[0].ID)
+		assert.True(t, m.SendAt.Equal(sendAt.Add(-2*time.Hour)))
+	}
+
+	released := sendAt.Add(-time.Hour)
+	assert.NoError(t, s.Release("reminder@golang.org", released))
+
+	//messages are returned as copies
+	assert.Nil(t, m.ReleasedAt)
+
+	_, err = s.Reschedule("account", "reminder@golang.org", sendAt)
+	assert.Equal(t, ErrScheduledReleased, err)
+
+	m, err = s.Retry("reminder@golang.org", sendAt, []string{"gopher@golang.org"})
+	if assert.NoError(t, err) {
+		assert.Nil(t, m.ReleasedAt)
+		assert.Equal(t, 1, m.Attempts)
+		assert.Equal(t, []string{"gopher@golang.org"}, m.Delivered)
+		assert.True(t, m.SendAt.Equal(sendAt))
+	}
+
+	assert.NoError(t, s.Remove("account", "reminder@golang.org"))
+	assert.Equal(t, ErrScheduledNotFound, s.Remove("account", "reminder@golang.org"))
+	assert.Len(t, s.All(), 1)
+	assert.Empty(t, s.List(""))
+}
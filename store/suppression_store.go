@@ -0,0 +1,199 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
+)
+
+var ErrSuppressionNotFound = errors.New("Suppression was not found")
+
+//Suppressed addresses of every account kept in JSON file,
+//only in memory when path is empty
+type SuppressionStore struct {
+	path         string
+	mutex        sync.RWMutex
+	suppressions map[string]*model.Suppression
+}
+
+func NewSuppressionStore(path string) (*SuppressionStore, error) {
+	s := &SuppressionStore{
+		path:         path,
+		suppressions: make(map[string]*model.Suppression),
+	}
+
+	if len(path) == 0 || !s.exists() {
+		return s, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.Suppression, 0)
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	for _, m := range list {
+		s.suppressions[s.id(m.Key, m.Address)] = m
+	}
+
+	return s, nil
+}
+
+//Adds the address, reason and time of already suppressed address are kept
+func (s *SuppressionStore) Suppress(key, address, reason string) error {
+	_, err := s.Add(&model.Suppression{
+		Key:     key,
+		Address: address,
+		Reason:  reason,
+	})
+
+	return err
+}
+
+func (s *SuppressionStore) IsSuppressed(key, address string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.suppressions[s.id(key, address)]
+
+	return ok
+}
+
+func (s *SuppressionStore) Add(suppression *model.Suppression) (*model.Suppression, error) {
+	if len(suppression.Key) == 0 || len(suppression.Address) == 0 {
+		return nil, errors.New("Suppression key and address are required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := s.id(suppression.Key, suppression.Address)
+
+	if existing, ok := s.suppressions[id]; ok {
+		return existing, nil
+	}
+
+	m := &model.Suppression{
+		Key:       suppression.Key,
+		Address:   strings.ToLower(suppression.Address),
+		Reason:    suppression.Reason,
+		CreatedAt: suppression.CreatedAt,
+	}
+
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+
+	s.suppressions[id] = m
+
+	if err := s.save(); err != nil {
+		delete(s.suppressions, id)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *SuppressionStore) Find(key, address string) (*model.Suppression, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	m, ok := s.suppressions[s.id(key, address)]
+	if !ok {
+		return nil, ErrSuppressionNotFound
+	}
+
+	return m, nil
+}
+
+//Suppressions of the account, the oldest first
+func (s *SuppressionStore) List(key string) []*model.Suppression {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.Suppression, 0)
+
+	for _, m := range s.suppressions {
+		if m.Key == key {
+			list = append(list, m)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].Address < list[j].Address
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	return list
+}
+
+func (s *SuppressionStore) Remove(key, address string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := s.id(key, address)
+
+	m, ok := s.suppressions[id]
+	if !ok {
+		return ErrSuppressionNotFound
+	}
+
+	delete(s.suppressions, id)
+
+	if err := s.save(); err != nil {
+		s.suppressions[id] = m
+		return err
+	}
+
+	return nil
+}
+
+func (s *SuppressionStore) id(key, address string) string {
+	return key + "\n" + strings.ToLower(address)
+}
+
+func (s *SuppressionStore) exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+//Writes all suppressions to temporary file replacing the store file at once
+func (s *SuppressionStore) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	list := make([]*model.Suppression, 0, len(s.suppressions))
+	for _, m := range s.suppressions {
+		list = append(list, m)
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+
+	if err := ioutil.WriteFile(tmp, data, config.FilePermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rlaskowski/go-email/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "suppressions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "suppressions.json")
+
+	s, err := NewSuppressionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, s.Suppress("account", "Bounced@golang.org", "hard_bounce"))
+	assert.NoError(t, s.Suppress("account", "bounced@golang.org", "unsubscribe"))
+
+	_, err = s.Add(&model.Suppression{Key: "other", Address: "user@golang.org", Reason: "manual"})
+	assert.NoError(t, err)
+
+	_, err = s.Add(&model.Suppression{Key: "other"})
+	assert.Error(t, err)
+
+	//reopened store reads the file
+	s, err = NewSuppressionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, s.IsSuppressed("account", "BOUNCED@golang.org"))
+	assert.False(t, s.IsSuppressed("other", "bounced@golang.org"))
+
+	m, err := s.Find("account", "bounced@golang.org")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hard_bounce", m.Reason)
+		assert.False(t, m.CreatedAt.IsZero())
+	}
+
+	assert.Len(t, s.List("account"), 1)
+
+	assert.NoError(t, s.Remove("account", "bounced@golang.org"))
+	assert.Equal(t, ErrSuppressionNotFound, s.Remove("account", "bounced@golang.org"))
+
+	s, err = NewSuppressionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(t, s.List("account"))
+	assert.Len(t, s.List("other"), 1)
+}
@@ -0,0 +1,510 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rlaskowski/go-email/config"
+	"github.com/rlaskowski/go-email/model"
+)
+
+const (
+	//Number of finished deliveries kept in the log of every webhook
+	DeliveryLogSize = 100
+	//Number of pending deliveries of every webhook, the oldest ones are dropped above it
+	MaxPendingDeliveries = 1000
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("Webhook was not found")
+	ErrDeliveryNotFound = errors.New("Webhook delivery was not found")
+)
+
+//Webhooks of every account kept in JSON file with the log of their deliveries appended
+//to the file next to it, only in memory when path is empty. Deliveries are returned
+//as copies, so they could be updated by the dispatcher while the log is read
+type WebhookStore struct {
+	path       string
+	mutex      sync.RWMutex
+	webhooks   map[string]*model.Webhook
+	deliveries map[string]*model.WebhookDelivery
+	log        *jsonLog
+}
+
+type webhookFile struct {
+	Webhooks []*model.Webhook `json:"webhooks"`
+	//deliveries of the store written before the delivery log
+	Deliveries []*model.WebhookDelivery `json:"deliveries,omitempty"`
+}
+
+//Record of the delivery log, the last record of the delivery replaces the previous ones
+type deliveryRecord struct {
+	Delivery *model.WebhookDelivery `json:"delivery,omitempty"`
+	Removed  string                 `json:"removed,omitempty"`
+}
+
+func NewWebhookStore(path string) (*WebhookStore, error) {
+	s := &WebhookStore{
+		path:       path,
+		webhooks:   make(map[string]*model.Webhook),
+		deliveries: make(map[string]*model.WebhookDelivery),
+	}
+
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	s.log = newJSONLog(strings.TrimSuffix(path, filepath.Ext(path)) + "-deliveries.jsonl")
+
+	file := &webhookFile{}
+
+	if err := readJSON(path, file); err != nil {
+		return nil, err
+	}
+
+	for _, w := range file.Webhooks {
+		s.webhooks[w.ID] = w
+	}
+
+	for _, d := range file.Deliveries {
+		s.deliveries[d.ID] = d
+	}
+
+	err := s.log.read(func(data []byte) error {
+		r := &deliveryRecord{}
+
+		if err := json.Unmarshal(data, r); err != nil {
+			return err
+		}
+
+		if r.Delivery != nil {
+			s.deliveries[r.Delivery.ID] = r.Delivery
+		} else {
+			delete(s.deliveries, r.Removed)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	//deliveries of webhooks removed before their records were written
+	for id, d := range s.deliveries {
+		if _, ok := s.webhooks[d.WebhookID]; !ok {
+			delete(s.deliveries, id)
+		}
+	}
+
+	if len(file.Deliveries) > 0 {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *WebhookStore) Add(webhook *model.Webhook) (*model.Webhook, error) {
+	if len(webhook.Key) == 0 || len(webhook.URL) == 0 {
+		return nil, errors.New("Webhook key and URL are required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w := &model.Webhook{
+		ID:        uuid.New().String(),
+		Key:       webhook.Key,
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		Secret:    webhook.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.webhooks[w.ID] = w
+
+	if err := s.save(); err != nil {
+		delete(s.webhooks, w.ID)
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (s *WebhookStore) Find(key, id string) (*model.Webhook, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	w, ok := s.webhooks[id]
+	if !ok || w.Key != key {
+		return nil, ErrWebhookNotFound
+	}
+
+	return w, nil
+}
+
+//Webhooks of the account, the oldest first
+func (s *WebhookStore) List(key string) []*model.Webhook {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.Webhook, 0)
+
+	for _, w := range s.webhooks {
+		if w.Key == key {
+			list = append(list, w)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	return list
+}
+
+//Webhooks of the account subscribed to the event
+func (s *WebhookStore) Subscribed(key, event string) []*model.Webhook {
+	list := make([]*model.Webhook, 0)
+
+	for _, w := range s.List(key) {
+		if w.Subscribed(event) {
+			list = append(list, w)
+		}
+	}
+
+	return list
+}
+
+//Removes the webhook with its delivery log
+func (s *WebhookStore) Remove(key, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w, ok := s.webhooks[id]
+	if !ok || w.Key != key {
+		return ErrWebhookNotFound
+	}
+
+	delete(s.webhooks, id)
+
+	removed := make([]*model.WebhookDelivery, 0)
+
+	for _, d := range s.deliveries {
+		if d.WebhookID == id {
+			removed = append(removed, d)
+			delete(s.deliveries, d.ID)
+		}
+	}
+
+	if err := s.save(); err != nil {
+		s.webhooks[id] = w
+
+		for _, d := range removed {
+			s.deliveries[d.ID] = d
+		}
+
+		return err
+	}
+
+	//deliveries left in the log are skipped when the store is opened
+	if err := s.writeDeliveries(nil, removed); err != nil {
+		log.Printf("Could not remove deliveries of webhook %s due to: %s", id, err)
+	}
+
+	return nil
+}
+
+//Adds delivery to the log, the oldest pending deliveries above the limit fail
+//and the oldest finished deliveries of the webhook are dropped
+func (s *WebhookStore) AddDelivery(delivery *model.WebhookDelivery) (*model.WebhookDelivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d := *delivery
+	d.ID = uuid.New().String()
+
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+
+	s.deliveries[d.ID] = &d
+
+	failed := s.limitPending(d.WebhookID)
+	dropped := s.trim(d.WebhookID)
+
+	changed := []*model.WebhookDelivery{&d}
+
+	for _, o := range failed {
+		if f, ok := s.deliveries[o.ID]; ok {
+			changed = append(changed, f)
+		}
+	}
+
+	if err := s.writeDeliveries(changed, dropped); err != nil {
+		delete(s.deliveries, d.ID)
+
+		//dropped deliveries are restored first, they could be the failed ones
+		for _, o := range append(dropped, failed...) {
+			s.deliveries[o.ID] = o
+		}
+
+		return nil, err
+	}
+
+	c := d
+
+	return &c, nil
+}
+
+//Replaces deliveries in the log with the results of the attempts,
+//deliveries removed in the meantime are skipped
+func (s *WebhookStore) UpdateDeliveries(deliveries ...*model.WebhookDelivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := make([]*model.WebhookDelivery, 0, len(deliveries))
+	changed := make([]*model.WebhookDelivery, 0, len(deliveries))
+	webhooks := make(map[string]bool)
+
+	for _, delivery := range deliveries {
+		old, ok := s.deliveries[delivery.ID]
+		if !ok {
+			continue
+		}
+
+		previous = append(previous, old)
+		webhooks[old.WebhookID] = true
+
+		d := *delivery
+		s.deliveries[d.ID] = &d
+		changed = append(changed, &d)
+	}
+
+	if len(previous) == 0 {
+		return nil
+	}
+
+	dropped := make([]*model.WebhookDelivery, 0)
+
+	for id := range webhooks {
+		dropped = append(dropped, s.trim(id)...)
+	}
+
+	if err := s.writeDeliveries(changed, dropped); err != nil {
+		for _, o := range append(dropped, previous...) {
+			s.deliveries[o.ID] = o
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *WebhookStore) Delivery(key, id string) (*model.WebhookDelivery, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	d, ok := s.deliveries[id]
+	if !ok || d.Key != key {
+		return nil, ErrDeliveryNotFound
+	}
+
+	c := *d
+
+	return &c, nil
+}
+
+//Deliveries of the webhook, the newest first
+func (s *WebhookStore) Deliveries(key, webhookId string) []*model.WebhookDelivery {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.WebhookDelivery, 0)
+
+	for _, d := range s.deliveries {
+		if d.Key == key && d.WebhookID == webhookId {
+			c := *d
+			list = append(list, &c)
+		}
+	}
+
+	sortDeliveries(list)
+
+	return list
+}
+
+//Pending deliveries which next attempt is due, the oldest first
+func (s *WebhookStore) Due(now time.Time) []*model.WebhookDelivery {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*model.WebhookDelivery, 0)
+
+	for _, d := range s.deliveries {
+		if d.Status != model.DeliveryPending || (d.NextAttemptAt != nil && d.NextAttemptAt.After(now)) {
+			continue
+		}
+
+		c := *d
+		list = append(list, &c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	return list
+}
+
+//Fails the oldest pending deliveries of the webhook above the limit, returns them as they were
+func (s *WebhookStore) limitPending(webhookId string) []*model.WebhookDelivery {
+	pending := make([]*model.WebhookDelivery, 0)
+
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookId && d.Status == model.DeliveryPending {
+			pending = append(pending, d)
+		}
+	}
+
+	if len(pending) <= MaxPendingDeliveries {
+		return nil
+	}
+
+	sortDeliveries(pending)
+
+	failed := pending[MaxPendingDeliveries:]
+
+	for _, o := range failed {
+		d := *o
+		d.Status = model.DeliveryFailed
+		d.Error = "Too many pending deliveries, the delivery was dropped"
+		d.NextAttemptAt = nil
+
+		s.deliveries[d.ID] = &d
+	}
+
+	return failed
+}
+
+func (s *WebhookStore) trim(webhookId string) []*model.WebhookDelivery {
+	finished := make([]*model.WebhookDelivery, 0)
+
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookId && d.Status != model.DeliveryPending {
+			finished = append(finished, d)
+		}
+	}
+
+	if len(finished) <= DeliveryLogSize {
+		return nil
+	}
+
+	sortDeliveries(finished)
+
+	dropped := finished[DeliveryLogSize:]
+
+	for _, d := range dropped {
+		delete(s.deliveries, d.ID)
+	}
+
+	return dropped
+}
+
+func sortDeliveries(list []*model.WebhookDelivery) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].ID > list[j].ID
+		}
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+}
+
+//Writes webhooks to temporary file replacing the store file at once
+func (s *WebhookStore) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	file := &webhookFile{
+		Webhooks: make([]*model.Webhook, 0, len(s.webhooks)),
+	}
+
+	for _, w := range s.webhooks {
+		file.Webhooks = append(file.Webhooks, w)
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+
+	if err := ioutil.WriteFile(tmp, data, config.FilePermissions); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+//Appends changed and removed deliveries to the log, which is compacted
+//when most of its records are outdated
+func (s *WebhookStore) writeDeliveries(changed, removed []*model.WebhookDelivery) error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	records := make([]interface{}, 0, len(changed)+len(removed))
+
+	for _, d := range changed {
+		records = append(records, &deliveryRecord{Delivery: d})
+	}
+
+	//removal is written last, delivery could be changed and dropped at once
+	for _, d := range removed {
+		records = append(records, &deliveryRecord{Removed: d.ID})
+	}
+
+	if err := s.log.append(records...); err != nil {
+		return err
+	}
+
+	if s.log.outdated(len(s.deliveries)) {
+		if err := s.compact(); err != nil {
+			log.Printf("Could not compact webhook delivery log due to: %s", err)
+		}
+	}
+
+	return nil
+}
+
+//Rewrites the log with the current deliveries
+func (s *WebhookStore) compact() error {
+	records := make([]interface{}, 0, len(s.deliveries))
+
+	for _, d := range s.deliveries {
+		records = append(records, &deliveryRecord{Delivery: d})
+	}
+
+	return s.log.compact(records)
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rlaskowski/go-email/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "webhooks.json")
+
+	s, err := NewWebhookStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, err := s.Add(&model.Webhook{Key: "account", URL: "https://golang.org/hook", Events: []string{model.EventMessageReceived}, Secret: "secret"})
+	assert.NoError(t, err)
+
+	all, err := s.Add(&model.Webhook{Key: "account", URL: "https://golang.org/all", Secret: "secret"})
+	assert.NoError(t, err)
+
+	_, err = s.Add(&model.Webhook{Key: "account"})
+	assert.Error(t, err)
+
+	assert.Len(t, s.Subscribed("account", model.EventMessageReceived), 2)
+	assert.Len(t, s.Subscribed("account", model.EventMessageSent), 1)
+	assert.Empty(t, s.Subscribed("other", model.EventMessageReceived))
+
+	created := time.Now().Add(-time.Hour)
+
+	for i := 0; i < DeliveryLogSize+2; i++ {
+		_, err := s.AddDelivery(&model.WebhookDelivery{
+			WebhookID: received.ID,
+			Key:       "account",
+			Status:    model.DeliveryDelivered,
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+		})
+		assert.NoError(t, err)
+	}
+
+	pending, err := s.AddDelivery(&model.WebhookDelivery{WebhookID: all.ID, Key: "account", Status: model.DeliveryPending})
+	assert.NoError(t, err)
+
+	//reopened store reads webhooks and deliveries
+	s, err = NewWebhookStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, s.List("account"), 2)
+
+	list := s.Deliveries("account", received.ID)
+	if assert.Len(t, list, DeliveryLogSize) {
+		assert.Equal(t, created.Add((DeliveryLogSize+1)*time.Second).Unix(), list[0].CreatedAt.Unix())
+	}
+
+	due := s.Due(time.Now())
+	if assert.Len(t, due, 1) {
+		assert.Equal(t, pending.ID, due[0].ID)
+	}
+
+	next := time.Now().Add(time.Minute)
+	due[0].NextAttemptAt = &next
+	assert.NoError(t, s.UpdateDeliveries(due[0]))
+	assert.Empty(t, s.Due(time.Now()))
+
+	_, err = s.Delivery("other", pending.ID)
+	assert.Equal(t, ErrDeliveryNotFound, err)
+
+	assert.NoError(t, s.Remove("account", all.ID))
+	assert.Equal(t, ErrWebhookNotFound, s.Remove("account", all.ID))
+
+	_, err = s.Delivery("account", pending.ID)
+	assert.Equal(t, ErrDeliveryNotFound, err)
+}
+
+func TestWebhookStoreLimitsPendingDeliveries(t *testing.T) {
+	s, _ := NewWebhookStore("")
+
+	w, err := s.Add(&model.Webhook{Key: "account", URL: "https://golang.org/hook", Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Now().Add(-time.Hour)
+
+	for i := 0; i <= MaxPendingDeliveries; i++ {
+		_, err := s.AddDelivery(&model.WebhookDelivery{
+			WebhookID: w.ID,
+			Key:       "account",
+			Status:    model.DeliveryPending,
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, s.Due(time.Now()), MaxPendingDeliveries)
+
+	//the oldest delivery fails
+	list := s.Deliveries("account", w.ID)
+	if assert.Len(t, list, MaxPendingDeliveries+1) {
+		assert.Equal(t, model.DeliveryFailed, list[MaxPendingDeliveries].Status)
+		assert.Equal(t, created.Unix(), list[MaxPendingDeliveries].CreatedAt.Unix())
+	}
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webhooks.json")
+
+	//store written before the delivery log kept deliveries in the webhooks file
+	old := `{"webhooks":[{"id":"hook","key":"account","url":"https://golang.org/hook"}],` +
+		`"deliveries":[{"id":"old","webhook_id":"hook","key":"account","status":"pending"},` +
+		`{"id":"orphan","webhook_id":"removed","key":"account","status":"pending"}]}`
+
+	if err := ioutil.WriteFile(path, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewWebhookStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, s.Due(time.Now()), 1) {
+		assert.Equal(t, "old", s.Due(time.Now())[0].ID)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	assert.NotContains(t, string(data), "deliveries")
+
+	added, err := s.AddDelivery(&model.WebhookDelivery{WebhookID: "hook", Key: "account", Status: model.DeliveryPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added.Status = model.DeliveryDelivered
+	assert.NoError(t, s.UpdateDeliveries(added))
+
+	//record truncated by a crash is skipped
+	f, err := os.OpenFile(filepath.Join(dir, "webhooks-deliveries.jsonl"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteString(`{"delivery":{"id":"trunc`)
+	f.Close()
+
+	s, err = NewWebhookStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delivery, err := s.Delivery("account", added.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+	}
+
+	assert.Len(t, s.Deliveries("account", "hook"), 2)
+
+	//record appended after the truncated one is read
+	assert.NoError(t, s.UpdateDeliveries(delivery))
+
+	s, err = NewWebhookStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//log is compacted when most of its records are outdated
+	for i := 0; i < logCompactRecords; i++ {
+		assert.NoError(t, s.UpdateDeliveries(delivery))
+	}
+
+	assert.True(t, s.log.records <= logCompactRecords)
+
+	s, err = NewWebhookStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, s.Deliveries("account", "hook"), 2)
+}